@@ -18,6 +18,8 @@ type serverConfig struct {
 	PresentationDefinition exchange.PresentationDefinition
 	UniversalResolverURL   string
 	CustomHandlers         map[string]gate.CustomHandler
+	HandlerRegistry        *gate.HandlerRegistry
+	Handlers               map[string]gate.HandlerReference
 }
 
 type adminDID struct {
@@ -42,6 +44,10 @@ func newCredentialGateServerConfig() (*serverConfig, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "expanding admin did key")
 	}
+	registry := gate.NewHandlerRegistry()
+	if err = RegisterGitHubHandler(registry); err != nil {
+		return nil, errors.Wrap(err, "registering GitHub handler")
+	}
 	return &serverConfig{
 		AdminDID: adminDID{
 			DID:      didKey.String(),
@@ -54,6 +60,10 @@ func newCredentialGateServerConfig() (*serverConfig, error) {
 		CustomHandlers:         map[string]gate.CustomHandler{
 			// register custom handlers here
 		},
+		HandlerRegistry: registry,
+		Handlers:        map[string]gate.HandlerReference{
+			// reference handlers from the registry here, e.g. {Handler: GitHubHandlerName}
+		},
 	}, nil
 }
 
@@ -15,6 +15,9 @@ import (
 
 const (
 	GitHubCredentialType string = "GitHubCredential"
+
+	// GitHubHandlerName is the name the GitHub handler is registered under in a handler registry
+	GitHubHandlerName string = "github"
 )
 
 // NewGitHubHandler returns a new GitHub handler
@@ -44,7 +47,15 @@ func NewGitHubHandler(inputDescriptorID string) gate.CustomHandler {
 	}
 }
 
-func githubHandler(_ context.Context, vsd exchange.VerifiedSubmissionData) (bool, error) {
+// RegisterGitHubHandler registers the GitHub handler, which takes no parameters, so it can be referenced by name
+// from a gate's config
+func RegisterGitHubHandler(registry *gate.HandlerRegistry) error {
+	return registry.Register(GitHubHandlerName, func(_ context.Context, inputDescriptorID string, _ gate.HandlerParams) (gate.CustomHandler, error) {
+		return NewGitHubHandler(inputDescriptorID), nil
+	})
+}
+
+func githubHandler(ctx context.Context, vsd exchange.VerifiedSubmissionData) (bool, error) {
 	_, _, cred, err := credential.ToCredential(vsd.Claim)
 	if err != nil {
 		return false, errors.Wrap(err, "failed to parse credential before checking invalid after")
@@ -66,7 +77,12 @@ func githubHandler(_ context.Context, vsd exchange.VerifiedSubmissionData) (bool
 		return false, errors.New("credential subject does not have gist property")
 	}
 
-	resp, err := http.Get(gistURL)
+	// the gate cancels the request once another custom handler fails
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, gistURL, nil)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to create gist request")
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return false, errors.Wrap(err, "failed to get gist")
 	}
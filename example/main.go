@@ -3,6 +3,7 @@ package main
 import (
 	"net/http"
 
+	"github.com/TBD54566975/ssi-sdk/crypto/jwx"
 	"github.com/TBD54566975/ssi-sdk/schema"
 	"github.com/sirupsen/logrus"
 
@@ -26,11 +27,19 @@ func main() {
 	if err != nil {
 		logrus.WithError(err).Fatal("error creating credential gate server")
 	}
+	adminSigner, err := jwx.NewJWXSigner(config.AdminDID.DID, config.AdminDID.KeyID, config.AdminDID.Key)
+	if err != nil {
+		logrus.WithError(err).Fatal("error creating admin signer")
+	}
 	credGate, err := gate.NewCredentialGate(gate.CredentialGateConfig{
 		AdminDID:               config.AdminDID.DID,
+		AdminSigner:            adminSigner,
 		UniversalResolverURL:   config.UniversalResolverURL,
 		PresentationDefinition: config.PresentationDefinition,
 		CustomHandlers:         config.CustomHandlers,
+		HandlerRegistry:        config.HandlerRegistry,
+		Handlers:               config.Handlers,
+		AccessToken:            &gate.AccessTokenConfig{},
 	})
 	if err != nil {
 		logrus.WithError(err).Fatal("error creating credential gate")
@@ -52,8 +52,12 @@ func (s *server) configGetter(w http.ResponseWriter, _ *http.Request) {
 }
 
 type gateResponse struct {
-	AccessGranted bool   `json:"accessGranted"`
-	Message       string `json:"message"`
+	AccessGranted bool            `json:"accessGranted"`
+	Message       string          `json:"message"`
+	Reason        *gate.Reason    `json:"reason,omitempty"`
+	AccessToken   string          `json:"accessToken,omitempty"`
+	Attributes    gate.Attributes `json:"attributes,omitempty"`
+	Trace         *gate.Trace     `json:"trace,omitempty"`
 }
 
 func (s *server) gateHandler(w http.ResponseWriter, r *http.Request) {
@@ -63,14 +67,23 @@ func (s *server) gateHandler(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	var opts []gate.ValidateOption
+	if r.URL.Query().Get("explain") == "true" {
+		opts = append(opts, gate.WithTrace())
+	}
+	if definition := r.URL.Query().Get("definition"); definition != "" {
+		opts = append(opts, gate.WithDefinition(definition))
+	}
 	var gr gateResponse
-	result, err := s.gate.ValidatePresentationSubmission(r.Context(), string(body))
+	result, err := s.gate.ValidatePresentation(r.Context(), body, opts...)
 	if err != nil {
 		logrus.WithError(err).Error("error validating presentation submission")
 		w.WriteHeader(http.StatusBadRequest)
 		gr = gateResponse{
 			AccessGranted: false,
 			Message:       fmt.Sprintf("error validating presentation submission: %s", err.Error()),
+			Reason:        result.Reason,
+			Trace:         result.Trace,
 		}
 	} else {
 		var msg string
@@ -78,14 +91,18 @@ func (s *server) gateHandler(w http.ResponseWriter, r *http.Request) {
 			msg = "access granted"
 		} else {
 			msg = "access denied"
-			if result.Reason != "" {
-				msg = fmt.Sprintf("%s: %s", msg, result.Reason)
+			if result.Reason != nil {
+				msg = fmt.Sprintf("%s: %s", msg, result.Reason.Code)
 			}
 		}
 		logrus.Info(msg)
 		gr = gateResponse{
 			AccessGranted: result.Valid,
 			Message:       msg,
+			Reason:        result.Reason,
+			AccessToken:   result.AccessToken,
+			Attributes:    result.Attributes,
+			Trace:         result.Trace,
 		}
 	}
 
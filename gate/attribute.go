@@ -0,0 +1,175 @@
+package gate
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/oliveagle/jsonpath"
+	"github.com/pkg/errors"
+)
+
+// AttributeHeaderPrefix is the prefix of the headers Attributes.Headers forwards attributes in by default
+const AttributeHeaderPrefix = "X-Credential-Gate-"
+
+// ClaimMapping maps a claim of the credentials submitted for an input descriptor to an attribute of the result
+type ClaimMapping struct {
+	// Path is a JSONPath into the credential, in the VC data model, such as $.credentialSubject.email, or into the
+	// disclosed claims of an SD-JWT credential, such as $.email
+	Path string `json:"path" validate:"required"`
+
+	// Attribute is the name of the attribute the claim is mapped to
+	Attribute string `json:"attribute" validate:"required"`
+
+	// Type is the type the claim must have, as it is represented in JSON
+	// If empty, claims of any type are mapped
+	Type ParameterType `json:"type,omitempty"`
+
+	// Required denies submissions whose credentials do not have the claim
+	// If false, the attribute is left unset
+	Required bool `json:"required,omitempty"`
+}
+
+// ClaimMappings maps claims of the credentials submitted for each input descriptor, by its ID, to attributes
+type ClaimMappings map[string][]ClaimMapping
+
+// IsValid checks each mapping has a path, an attribute name no other mapping uses, and a known type
+func (m ClaimMappings) IsValid() error {
+	attributes := make(map[string]string)
+	for id, mappings := range m {
+		for _, mapping := range mappings {
+			if mapping.Path == "" || mapping.Attribute == "" {
+				return errors.Errorf("claim mapping of input descriptor ID %s requires a path and an attribute", id)
+			}
+			if mapping.Type != "" && !mapping.Type.isKnown() {
+				return errors.Errorf("attribute<%s> has unknown type: %s", mapping.Attribute, mapping.Type)
+			}
+			if otherID, ok := attributes[mapping.Attribute]; ok {
+				return errors.Errorf("attribute<%s> is mapped for both input descriptor IDs %s and %s", mapping.Attribute, otherID, id)
+			}
+			attributes[mapping.Attribute] = id
+		}
+	}
+	return nil
+}
+
+// Attributes are the claims of verified credentials mapped to attributes by name, holding values as they are
+// represented in JSON
+type Attributes map[string]any
+
+// String returns the value of a string attribute, or the empty string if it is not set
+func (a Attributes) String(name string) string {
+	return HandlerParams(a).String(name)
+}
+
+// Number returns the value of a number attribute, or zero if it is not set
+func (a Attributes) Number(name string) float64 {
+	return HandlerParams(a).Number(name)
+}
+
+// Bool returns the value of a boolean attribute, or false if it is not set
+func (a Attributes) Bool(name string) bool {
+	return HandlerParams(a).Bool(name)
+}
+
+// Strings returns the string values of an array attribute
+func (a Attributes) Strings(name string) []string {
+	return HandlerParams(a).Strings(name)
+}
+
+// Headers returns the attributes as headers to forward to a service, each named by the prefix followed by the
+// attribute name, or AttributeHeaderPrefix if the prefix is empty. String values are forwarded as they are, and
+// others JSON serialized.
+func (a Attributes) Headers(prefix string) (http.Header, error) {
+	if prefix == "" {
+		prefix = AttributeHeaderPrefix
+	}
+	names := make([]string, 0, len(a))
+	for name := range a {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	headers := make(http.Header, len(a))
+	for _, name := range names {
+		value, ok := a[name].(string)
+		if !ok {
+			valueBytes, err := json.Marshal(a[name])
+			if err != nil {
+				return nil, errors.Wrapf(err, "marshalling attribute<%s>", name)
+			}
+			value = string(valueBytes)
+		}
+		headers.Set(prefix+name, value)
+	}
+	return headers, nil
+}
+
+// mapClaims maps the claims of the submitted credentials to attributes, taking each claim from the first credential
+// submitted for its input descriptor which has it. A required claim no credential has, or a claim of the wrong type,
+// is a denial.
+func mapClaims(mappings ClaimMappings, submitted []submittedCredential) (Attributes, error) {
+	attributes := make(Attributes)
+	if len(mappings) == 0 {
+		return attributes, nil
+	}
+	credentials := make(map[string][]map[string]any)
+	for _, sc := range submitted {
+		if _, ok := mappings[sc.inputDescriptorID]; !ok {
+			continue
+		}
+		cred, err := sc.claims()
+		if err != nil {
+			return nil, newInputDescriptorDenial(ReasonInvalidSubmission, sc.inputDescriptorID, nil, err)
+		}
+		credentials[sc.inputDescriptorID] = append(credentials[sc.inputDescriptorID], cred)
+	}
+	// input descriptors are mapped in order of their IDs, so the same submission is always denied for the same claim
+	ids := make([]string, 0, len(mappings))
+	for id := range mappings {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		for _, mapping := range mappings[id] {
+			value := lookupClaim(credentials[id], mapping.Path)
+			if value == nil {
+				if mapping.Required {
+					return nil, newInputDescriptorDenial(ReasonConstraintFailed, id, []string{mapping.Path},
+						errors.Errorf("no credential for input descriptor ID %s has the claim of attribute<%s>", id, mapping.Attribute))
+				}
+				continue
+			}
+			if mapping.Type != "" && !mapping.Type.matches(value) {
+				return nil, newInputDescriptorDenial(ReasonConstraintFailed, id, []string{mapping.Path},
+					errors.Errorf("claim of attribute<%s> is not of type %s", mapping.Attribute, mapping.Type))
+			}
+			attributes[mapping.Attribute] = value
+		}
+	}
+	return attributes, nil
+}
+
+// lookupClaim returns the value at the path of the first credential which has one
+func lookupClaim(credentials []map[string]any, path string) any {
+	for _, cred := range credentials {
+		if value, err := jsonpath.JsonPathLookup(cred, path); err == nil && value != nil {
+			return value
+		}
+	}
+	return nil
+}
+
+type attributesKey struct{}
+
+// withAttributes makes the mapped attributes available to the custom handlers run with the context
+func withAttributes(ctx context.Context, attributes Attributes) context.Context {
+	return context.WithValue(ctx, attributesKey{}, attributes)
+}
+
+// AttributesFromContext returns the attributes mapped from the verified credentials of the submission a custom
+// handler is run for
+func AttributesFromContext(ctx context.Context) Attributes {
+	attributes, _ := ctx.Value(attributesKey{}).(Attributes)
+	return attributes
+}
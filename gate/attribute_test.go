@@ -0,0 +1,211 @@
+package gate
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/TBD54566975/ssi-sdk/credential"
+	"github.com/TBD54566975/ssi-sdk/credential/exchange"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClaimMappings(t *testing.T) {
+	admin := newTestSigner(t)
+	def := exchange.PresentationDefinition{
+		ID: "profile-definition",
+		InputDescriptors: []exchange.InputDescriptor{
+			{
+				ID:          "email",
+				Constraints: &exchange.Constraints{Fields: []exchange.Field{{Path: []string{"$.vc.credentialSubject.email"}}}},
+			},
+			{
+				ID:          "age",
+				Constraints: &exchange.Constraints{Fields: []exchange.Field{{Path: []string{"$.vc.credentialSubject.age"}}}},
+			},
+		},
+	}
+	mappings := ClaimMappings{
+		"email": {{Path: "$.credentialSubject.email", Attribute: "verifiedEmail", Type: ParameterString, Required: true}},
+		"age": {
+			{Path: "$.credentialSubject.age", Attribute: "verifiedAge", Type: ParameterNumber},
+			{Path: "$.credentialSubject.nickname", Attribute: "nickname"},
+		},
+	}
+
+	submitter := newTestSigner(t)
+	vcJWT := func(tt *testing.T, subject map[string]any) []byte {
+		subject["id"] = submitter.ID
+		signed, err := credential.SignVerifiableCredentialJWT(submitter, credential.VerifiableCredential{
+			Context:           []any{"https://www.w3.org/2018/credentials/v1"},
+			Type:              []string{"VerifiableCredential"},
+			Issuer:            submitter.ID,
+			IssuanceDate:      time.Now().Format(time.RFC3339),
+			CredentialSubject: subject,
+		})
+		require.NoError(tt, err)
+		return signed
+	}
+	submission := func(tt *testing.T, email, age any) string {
+		return buildTestSubmissionJWT(tt, submitter, admin.ID, def, [][]byte{
+			vcJWT(tt, map[string]any{"email": email}),
+			vcJWT(tt, map[string]any{"age": age}),
+		}, nil)
+	}
+
+	t.Run("attributes on result and visible to handlers", func(tt *testing.T) {
+		var handlerAttributes Attributes
+		gate, err := NewCredentialGate(CredentialGateConfig{
+			AdminDID:               admin.ID,
+			PresentationDefinition: def,
+			ClaimMappings:          mappings,
+			CustomHandlers: map[string]CustomHandler{
+				"age": {
+					InputDescriptorID: "age",
+					Handler: func(ctx context.Context, _ exchange.VerifiedSubmissionData) (bool, error) {
+						handlerAttributes = AttributesFromContext(ctx)
+						return handlerAttributes.Number("verifiedAge") >= 21, nil
+					},
+				},
+			},
+		})
+		require.NoError(tt, err)
+
+		result, err := gate.ValidatePresentationSubmission(context.Background(), submission(tt, "satoshi@example.com", 30))
+		require.NoError(tt, err)
+		assert.True(tt, result.Valid)
+		assert.Equal(tt, Attributes{"verifiedEmail": "satoshi@example.com", "verifiedAge": float64(30)}, result.Attributes)
+		assert.Equal(tt, "satoshi@example.com", result.Attributes.String("verifiedEmail"))
+		assert.Equal(tt, result.Attributes, handlerAttributes)
+
+		result, err = gate.ValidatePresentationSubmission(context.Background(), submission(tt, "satoshi@example.com", 18))
+		require.NoError(tt, err)
+		assert.False(tt, result.Valid)
+		assert.Empty(tt, result.Attributes)
+	})
+
+	t.Run("required and typed claims", func(tt *testing.T) {
+		gate, err := NewCredentialGate(CredentialGateConfig{
+			AdminDID:               admin.ID,
+			PresentationDefinition: def,
+			ClaimMappings: ClaimMappings{
+				"email": {{Path: "$.credentialSubject.phone", Attribute: "phone", Required: true}},
+				"age":   mappings["age"],
+			},
+		})
+		require.NoError(tt, err)
+		result, err := gate.ValidatePresentationSubmission(context.Background(), submission(tt, "satoshi@example.com", 30))
+		assert.Error(tt, err)
+		assert.False(tt, result.Valid)
+		assert.Equal(tt, ReasonConstraintFailed, result.Reason.Code)
+		assert.Equal(tt, "email", result.Reason.InputDescriptorID)
+		assert.Equal(tt, []string{"$.credentialSubject.phone"}, result.Reason.FieldPath)
+
+		// with several required claims missing, the same one is always reported
+		gate, err = NewCredentialGate(CredentialGateConfig{
+			AdminDID:               admin.ID,
+			PresentationDefinition: def,
+			ClaimMappings: ClaimMappings{
+				"email": {{Path: "$.credentialSubject.phone", Attribute: "phone", Required: true}},
+				"age":   {{Path: "$.credentialSubject.birthDate", Attribute: "birthDate", Required: true}},
+			},
+		})
+		require.NoError(tt, err)
+		for i := 0; i < 20; i++ {
+			result, err = gate.ValidatePresentationSubmission(context.Background(), submission(tt, "satoshi@example.com", 30))
+			assert.Error(tt, err)
+			assert.Equal(tt, "age", result.Reason.InputDescriptorID)
+			assert.Equal(tt, []string{"$.credentialSubject.birthDate"}, result.Reason.FieldPath)
+		}
+
+		gate, err = NewCredentialGate(CredentialGateConfig{AdminDID: admin.ID, PresentationDefinition: def, ClaimMappings: mappings})
+		require.NoError(tt, err)
+		result, err = gate.ValidatePresentationSubmission(context.Background(), submission(tt, "satoshi@example.com", "thirty"))
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonConstraintFailed, result.Reason.Code)
+		assert.Contains(tt, result.Reason.Message, "not of type number")
+	})
+
+	t.Run("claims outside the VP are not mapped", func(tt *testing.T) {
+		gate, err := NewCredentialGate(CredentialGateConfig{AdminDID: admin.ID, PresentationDefinition: def, ClaimMappings: mappings})
+		require.NoError(tt, err)
+
+		// the age submitted is an unsigned credential outside the VP's credentials
+		submissionJWT := signTestPresentationJWT(tt, submitter, admin.ID, map[string]any{
+			"verifiableCredential": []any{string(vcJWT(tt, map[string]any{"email": "satoshi@example.com"}))},
+			"proof": map[string]any{
+				"@context":          []any{"https://www.w3.org/2018/credentials/v1"},
+				"type":              []any{"VerifiableCredential"},
+				"issuer":            submitter.ID,
+				"issuanceDate":      time.Now().Format(time.RFC3339),
+				"credentialSubject": map[string]any{"id": submitter.ID, "age": 99},
+			},
+			"presentation_submission": map[string]any{
+				"id":            "forged-submission",
+				"definition_id": def.ID,
+				"descriptor_map": []any{
+					map[string]any{"id": "email", "format": exchange.JWTVC.String(), "path": "$.verifiableCredential[0]"},
+					map[string]any{"id": "age", "format": exchange.LDPVC.String(), "path": "$.proof"},
+				},
+			},
+		})
+		result, err := gate.ValidatePresentationSubmission(context.Background(), submissionJWT)
+		assert.Error(tt, err)
+		assert.False(tt, result.Valid)
+		assert.Equal(tt, ReasonInvalidSubmission, result.Reason.Code)
+		assert.Empty(tt, result.Attributes)
+	})
+
+	t.Run("copied into access token", func(tt *testing.T) {
+		gate, err := NewCredentialGate(CredentialGateConfig{
+			AdminDID:               admin.ID,
+			AdminSigner:            &admin,
+			PresentationDefinition: def,
+			ClaimMappings:          mappings,
+			AccessToken: &AccessTokenConfig{
+				Attributes: true,
+				Claims:     map[string]ClaimSelector{"verifiedAge": {InputDescriptorID: "age", Path: "$.type"}},
+			},
+		})
+		require.NoError(tt, err)
+		result, err := gate.ValidatePresentationSubmission(context.Background(), submission(tt, "satoshi@example.com", 30))
+		require.NoError(tt, err)
+		token, err := gate.VerifyAccessToken(context.Background(), result.AccessToken, "")
+		require.NoError(tt, err)
+		assert.Equal(tt, "satoshi@example.com", token.Claims["verifiedEmail"])
+		// selected claims take precedence over attributes
+		assert.Equal(tt, []any{"VerifiableCredential"}, token.Claims["verifiedAge"])
+	})
+
+	t.Run("forwarded headers", func(tt *testing.T) {
+		headers, err := Attributes{"email": "satoshi@example.com", "age": float64(30), "roles": []any{"admin"}}.Headers("")
+		require.NoError(tt, err)
+		assert.Equal(tt, http.Header{
+			"X-Credential-Gate-Email": {"satoshi@example.com"},
+			"X-Credential-Gate-Age":   {"30"},
+			"X-Credential-Gate-Roles": {`["admin"]`},
+		}, headers)
+
+		headers, err = Attributes{"email": "satoshi@example.com"}.Headers("X-User-")
+		require.NoError(tt, err)
+		assert.Equal(tt, "satoshi@example.com", headers.Get("X-User-Email"))
+	})
+
+	t.Run("invalid mappings", func(tt *testing.T) {
+		for name, invalid := range map[string]ClaimMappings{
+			"not found in presentation definition": {"phone": {{Path: "$.credentialSubject.phone", Attribute: "phone"}}},
+			"requires a path and an attribute":     {"email": {{Path: "$.credentialSubject.email"}}},
+			"unknown type":                         {"email": {{Path: "$.credentialSubject.email", Attribute: "email", Type: "date"}}},
+			"is mapped for both": {
+				"email": {{Path: "$.credentialSubject.email", Attribute: "email"}},
+				"age":   {{Path: "$.credentialSubject.email", Attribute: "email"}},
+			},
+		} {
+			_, err := NewCredentialGate(CredentialGateConfig{AdminDID: admin.ID, PresentationDefinition: def, ClaimMappings: invalid})
+			assert.Error(tt, err)
+			assert.Contains(tt, err.Error(), name)
+		}
+	})
+}
@@ -0,0 +1,145 @@
+package gate
+
+import (
+	"context"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+const boltOpenTimeout = time.Second
+
+var (
+	submissionsBucket = []byte("submissions")
+	noncesBucket      = []byte("nonces")
+)
+
+// BoltStore is a ReplayStore and NonceStore persisted to a local BoltDB file, so that a restarted gate
+// remembers which submissions it has accepted and which challenges are outstanding. Expired entries
+// are evicted as the store is written to.
+type BoltStore struct {
+	db *bolt.DB
+
+	sweepMu   sync.Mutex
+	lastSweep map[string]time.Time
+}
+
+var (
+	_ ReplayStore = (*BoltStore)(nil)
+	_ NonceStore  = (*BoltStore)(nil)
+)
+
+// NewBoltStore opens, or creates, a BoltStore at the given file path
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: boltOpenTimeout})
+	if err != nil {
+		return nil, errors.Wrapf(err, "opening bolt db at %s", path)
+	}
+	if err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{submissionsBucket, noncesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return errors.Wrapf(err, "creating bucket %s", bucket)
+			}
+		}
+		return nil
+	}); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &BoltStore{db: db, lastSweep: make(map[string]time.Time)}, nil
+}
+
+// Close closes the underlying BoltDB file
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *BoltStore) CheckAndStore(_ context.Context, id string, expiry time.Time) (bool, error) {
+	fresh := false
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(submissionsBucket)
+		now := time.Now()
+		if err := s.sweep(b, submissionsBucket, now); err != nil {
+			return err
+		}
+		if existing := b.Get([]byte(id)); existing != nil && now.Before(decodeExpiry(existing)) {
+			return nil
+		}
+		fresh = true
+		return b.Put([]byte(id), encodeExpiry(expiry))
+	})
+	if err != nil {
+		return false, errors.Wrap(err, "storing submission ID")
+	}
+	return fresh, nil
+}
+
+func (s *BoltStore) Put(_ context.Context, nonce string, expiry time.Time) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(noncesBucket)
+		if err := s.sweep(b, noncesBucket, time.Now()); err != nil {
+			return err
+		}
+		return b.Put([]byte(nonce), encodeExpiry(expiry))
+	})
+	return errors.Wrap(err, "storing nonce")
+}
+
+func (s *BoltStore) Consume(_ context.Context, nonce string) (bool, error) {
+	valid := false
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(noncesBucket)
+		existing := b.Get([]byte(nonce))
+		if existing == nil {
+			return nil
+		}
+		valid = time.Now().Before(decodeExpiry(existing))
+		return b.Delete([]byte(nonce))
+	})
+	if err != nil {
+		return false, errors.Wrap(err, "consuming nonce")
+	}
+	return valid, nil
+}
+
+// sweep evicts expired entries from the bucket, at most once per sweep interval
+func (s *BoltStore) sweep(b *bolt.Bucket, name []byte, now time.Time) error {
+	s.sweepMu.Lock()
+	defer s.sweepMu.Unlock()
+	bucket := string(name)
+	if last, ok := s.lastSweep[bucket]; ok && now.Sub(last) < storeSweepInterval {
+		return nil
+	}
+	var expired [][]byte
+	if err := b.ForEach(func(k, v []byte) error {
+		if !now.Before(decodeExpiry(v)) {
+			expired = append(expired, append([]byte(nil), k...))
+		}
+		return nil
+	}); err != nil {
+		return errors.Wrap(err, "scanning for expired entries")
+	}
+	for _, k := range expired {
+		if err := b.Delete(k); err != nil {
+			return errors.Wrap(err, "evicting expired entry")
+		}
+	}
+	s.lastSweep[bucket] = now
+	return nil
+}
+
+func encodeExpiry(expiry time.Time) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(expiry.UnixNano()))
+	return buf
+}
+
+func decodeExpiry(b []byte) time.Time {
+	if len(b) != 8 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(b)))
+}
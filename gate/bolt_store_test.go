@@ -0,0 +1,117 @@
+package gate
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/TBD54566975/ssi-sdk/credential/exchange"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestBoltStore(t *testing.T) {
+	t.Run("bad path", func(tt *testing.T) {
+		_, err := NewBoltStore(filepath.Join(tt.TempDir(), "missing", "gate.db"))
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "opening bolt db")
+	})
+
+	t.Run("submission IDs survive a restart", func(tt *testing.T) {
+		path := filepath.Join(tt.TempDir(), "gate.db")
+		store, err := NewBoltStore(path)
+		require.NoError(tt, err)
+
+		id := uuid.NewString()
+		fresh, err := store.CheckAndStore(context.Background(), id, time.Now().Add(time.Hour))
+		assert.NoError(tt, err)
+		assert.True(tt, fresh)
+		require.NoError(tt, store.Close())
+
+		store, err = NewBoltStore(path)
+		require.NoError(tt, err)
+		defer store.Close()
+
+		fresh, err = store.CheckAndStore(context.Background(), id, time.Now().Add(time.Hour))
+		assert.NoError(tt, err)
+		assert.False(tt, fresh)
+	})
+
+	t.Run("put and consume", func(tt *testing.T) {
+		store, err := NewBoltStore(filepath.Join(tt.TempDir(), "gate.db"))
+		require.NoError(tt, err)
+		defer store.Close()
+
+		nonce := uuid.NewString()
+		assert.NoError(tt, store.Put(context.Background(), nonce, time.Now().Add(time.Hour)))
+		consumed, err := store.Consume(context.Background(), nonce)
+		assert.NoError(tt, err)
+		assert.True(tt, consumed)
+
+		consumed, err = store.Consume(context.Background(), nonce)
+		assert.NoError(tt, err)
+		assert.False(tt, consumed)
+
+		assert.NoError(tt, store.Put(context.Background(), nonce, time.Now().Add(-time.Second)))
+		consumed, err = store.Consume(context.Background(), nonce)
+		assert.NoError(tt, err)
+		assert.False(tt, consumed)
+	})
+
+	t.Run("expired entries are evicted", func(tt *testing.T) {
+		store, err := NewBoltStore(filepath.Join(tt.TempDir(), "gate.db"))
+		require.NoError(tt, err)
+		defer store.Close()
+
+		for i := 0; i < 10; i++ {
+			_, err = store.CheckAndStore(context.Background(), uuid.NewString(), time.Now().Add(-time.Second))
+			assert.NoError(tt, err)
+		}
+
+		// force the next write to sweep the bucket
+		store.lastSweep[string(submissionsBucket)] = time.Now().Add(-2 * storeSweepInterval)
+		_, err = store.CheckAndStore(context.Background(), uuid.NewString(), time.Now().Add(time.Hour))
+		assert.NoError(tt, err)
+
+		var n int
+		assert.NoError(tt, store.db.View(func(tx *bolt.Tx) error {
+			n = tx.Bucket(submissionsBucket).Stats().KeyN
+			return nil
+		}))
+		assert.Equal(tt, 1, n)
+	})
+
+	t.Run("gate with a bolt store", func(tt *testing.T) {
+		store, err := NewBoltStore(filepath.Join(tt.TempDir(), "gate.db"))
+		require.NoError(tt, err)
+		defer store.Close()
+
+		gate, err := NewCredentialGate(CredentialGateConfig{
+			AdminDID: "did:test:admin",
+			PresentationDefinition: exchange.PresentationDefinition{
+				ID: uuid.NewString(),
+				InputDescriptors: []exchange.InputDescriptor{
+					{
+						ID: uuid.NewString(),
+						Constraints: &exchange.Constraints{
+							Fields: []exchange.Field{{Path: []string{"$.iss"}}},
+						},
+					},
+				},
+			},
+			RequireChallenge: true,
+			NonceStore:       store,
+			ReplayStore:      store,
+		})
+		require.NoError(tt, err)
+
+		challenge, err := gate.NewChallenge(context.Background())
+		assert.NoError(tt, err)
+		consumed, err := store.Consume(context.Background(), challenge.Nonce)
+		assert.NoError(tt, err)
+		assert.True(tt, consumed)
+	})
+}
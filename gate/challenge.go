@@ -0,0 +1,85 @@
+package gate
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultChallengeTTL = 5 * time.Minute
+	defaultReplayTTL    = 24 * time.Hour
+)
+
+// Challenge is a short-lived nonce issued by the gate. A presentation submission answers a challenge by
+// setting the challenge's nonce as either the `nonce` or the `jti` of the VP JWT, or as the `challenge` of
+// the proof of a JSON-LD VP.
+type Challenge struct {
+	Nonce     string    `json:"nonce"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// NewChallenge issues a new challenge which may be answered by a single presentation submission
+// before it expires
+func (cg *CredentialGate) NewChallenge(ctx context.Context) (*Challenge, error) {
+	ttl := cg.config.ChallengeTTL
+	if ttl == 0 {
+		ttl = defaultChallengeTTL
+	}
+	clock := cg.validityClock()
+	challenge := Challenge{
+		Nonce:     uuid.NewString(),
+		ExpiresAt: clock.now().Add(ttl),
+	}
+	if err := cg.nonceStore.Put(ctx, challenge.Nonce, clock.systemExpiry(challenge.ExpiresAt)); err != nil {
+		return nil, errors.Wrap(err, "storing challenge")
+	}
+	return &challenge, nil
+}
+
+// checkChallenge makes sure the VP answers an outstanding challenge. Challenges are single use, so a matched
+// challenge is consumed.
+func (cg *CredentialGate) checkChallenge(ctx context.Context, p *presentation) error {
+	if !cg.config.RequireChallenge {
+		return nil
+	}
+	for _, candidate := range p.challenges {
+		answered, err := cg.nonceStore.Consume(ctx, candidate)
+		if err != nil {
+			return errors.Wrap(err, "consuming challenge")
+		}
+		if answered {
+			return nil
+		}
+	}
+	return newDenial(ReasonChallengeFailed, errors.New("presentation submission does not answer an outstanding challenge"))
+}
+
+// checkReplay records the ID of the VP, the jti of a VP JWT or the id of a JSON-LD VP, in the replay store,
+// failing if it has been seen before. The ID is remembered until the VP expires, or for a default window if
+// it has no expiry. If a replay store is configured, a VP without an ID is denied, since it could be replayed.
+func (cg *CredentialGate) checkReplay(ctx context.Context, p *presentation) error {
+	id := p.id
+	if id == "" {
+		if cg.config.ReplayStore != nil {
+			return newDenial(ReasonInvalidSubmission, errors.New("presentation submission has no ID to protect it against replay"))
+		}
+		return nil
+	}
+	// the ID is remembered for as long as the gate accepts the VP, allowing for clock skew
+	clock := cg.validityClock()
+	expiry := clock.systemExpiry(p.expiry.Add(clock.skew))
+	if p.expiry.IsZero() {
+		expiry = time.Now().Add(defaultReplayTTL)
+	}
+	fresh, err := cg.replayStore.CheckAndStore(ctx, id, expiry)
+	if err != nil {
+		return errors.Wrap(err, "checking replay store")
+	}
+	if !fresh {
+		return newDenial(ReasonReplayed, errors.Errorf("presentation submission<%s> has already been used", id))
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package gate
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/TBD54566975/ssi-sdk/credential"
+	"github.com/TBD54566975/ssi-sdk/credential/exchange"
+	"github.com/TBD54566975/ssi-sdk/crypto"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChallenge(t *testing.T) {
+	requesterID := "did:test:admin"
+	presentationDefinition := exchange.PresentationDefinition{
+		ID: uuid.New().String(),
+		InputDescriptors: []exchange.InputDescriptor{
+			{
+				ID: uuid.New().String(),
+				Format: &exchange.ClaimFormat{
+					JWTVC: &exchange.JWTType{Alg: []crypto.SignatureAlgorithm{crypto.EdDSA}},
+				},
+				Constraints: &exchange.Constraints{
+					Fields: []exchange.Field{
+						{
+							Path: []string{"$.vc.credentialSubject.name"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	signer := newTestSigner(t)
+	testCredential := credential.VerifiableCredential{
+		Context:      []any{"https://www.w3.org/2018/credentials/v1"},
+		Type:         []string{"VerifiableCredential"},
+		Issuer:       signer.ID,
+		IssuanceDate: time.Now().Format(time.RFC3339),
+		CredentialSubject: map[string]any{
+			"id":   signer.ID,
+			"name": "Satoshi",
+		},
+	}
+	testVCJWT, err := credential.SignVerifiableCredentialJWT(signer, testCredential)
+	require.NoError(t, err)
+	vcJWTs := [][]byte{testVCJWT}
+
+	t.Run("challenge required but not answered", func(tt *testing.T) {
+		gate, err := NewCredentialGate(CredentialGateConfig{
+			AdminDID:               requesterID,
+			PresentationDefinition: presentationDefinition,
+			RequireChallenge:       true,
+		})
+		assert.NoError(tt, err)
+
+		submissionJWT := buildTestSubmissionJWT(tt, signer, requesterID, presentationDefinition, vcJWTs,
+			map[string]any{"nonce": uuid.NewString()})
+		result, err := gate.ValidatePresentationSubmission(context.Background(), submissionJWT)
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "does not answer an outstanding challenge")
+		assert.False(tt, result.Valid)
+	})
+
+	t.Run("challenge answered with nonce cannot be reused", func(tt *testing.T) {
+		gate, err := NewCredentialGate(CredentialGateConfig{
+			AdminDID:               requesterID,
+			PresentationDefinition: presentationDefinition,
+			RequireChallenge:       true,
+		})
+		assert.NoError(tt, err)
+
+		challenge, err := gate.NewChallenge(context.Background())
+		assert.NoError(tt, err)
+		assert.NotEmpty(tt, challenge.Nonce)
+		assert.True(tt, challenge.ExpiresAt.After(time.Now()))
+
+		submissionJWT := buildTestSubmissionJWT(tt, signer, requesterID, presentationDefinition, vcJWTs,
+			map[string]any{"nonce": challenge.Nonce})
+		result, err := gate.ValidatePresentationSubmission(context.Background(), submissionJWT)
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+
+		// a second submission answering the same challenge is rejected
+		submissionJWT = buildTestSubmissionJWT(tt, signer, requesterID, presentationDefinition, vcJWTs,
+			map[string]any{"nonce": challenge.Nonce})
+		result, err = gate.ValidatePresentationSubmission(context.Background(), submissionJWT)
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "does not answer an outstanding challenge")
+		assert.False(tt, result.Valid)
+	})
+
+	t.Run("challenge answered with jti", func(tt *testing.T) {
+		gate, err := NewCredentialGate(CredentialGateConfig{
+			AdminDID:               requesterID,
+			PresentationDefinition: presentationDefinition,
+			RequireChallenge:       true,
+		})
+		assert.NoError(tt, err)
+
+		challenge, err := gate.NewChallenge(context.Background())
+		assert.NoError(tt, err)
+
+		submissionJWT := buildTestSubmissionJWT(tt, signer, requesterID, presentationDefinition, vcJWTs,
+			map[string]any{"jti": challenge.Nonce})
+		result, err := gate.ValidatePresentationSubmission(context.Background(), submissionJWT)
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+		assert.Equal(tt, challenge.Nonce, result.SubmissionID)
+	})
+
+	t.Run("expired challenge", func(tt *testing.T) {
+		gate, err := NewCredentialGate(CredentialGateConfig{
+			AdminDID:               requesterID,
+			PresentationDefinition: presentationDefinition,
+			RequireChallenge:       true,
+			ChallengeTTL:           time.Millisecond,
+		})
+		assert.NoError(tt, err)
+
+		challenge, err := gate.NewChallenge(context.Background())
+		assert.NoError(tt, err)
+		time.Sleep(10 * time.Millisecond)
+
+		submissionJWT := buildTestSubmissionJWT(tt, signer, requesterID, presentationDefinition, vcJWTs,
+			map[string]any{"nonce": challenge.Nonce})
+		result, err := gate.ValidatePresentationSubmission(context.Background(), submissionJWT)
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "does not answer an outstanding challenge")
+		assert.False(tt, result.Valid)
+	})
+
+	t.Run("replayed submission is rejected", func(tt *testing.T) {
+		gate, err := NewCredentialGate(CredentialGateConfig{
+			AdminDID:               requesterID,
+			PresentationDefinition: presentationDefinition,
+		})
+		assert.NoError(tt, err)
+
+		submissionJWT := buildTestSubmissionJWT(tt, signer, requesterID, presentationDefinition, vcJWTs,
+			map[string]any{"jti": uuid.NewString()})
+		result, err := gate.ValidatePresentationSubmission(context.Background(), submissionJWT)
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+
+		result, err = gate.ValidatePresentationSubmission(context.Background(), submissionJWT)
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "has already been used")
+		assert.False(tt, result.Valid)
+	})
+
+	t.Run("custom replay store", func(tt *testing.T) {
+		store := NewMemoryStore(0)
+		jti := uuid.NewString()
+		fresh, err := store.CheckAndStore(context.Background(), jti, time.Now().Add(time.Hour))
+		assert.NoError(tt, err)
+		assert.True(tt, fresh)
+
+		gate, err := NewCredentialGate(CredentialGateConfig{
+			AdminDID:               requesterID,
+			PresentationDefinition: presentationDefinition,
+			ReplayStore:            store,
+		})
+		assert.NoError(tt, err)
+
+		submissionJWT := buildTestSubmissionJWT(tt, signer, requesterID, presentationDefinition, vcJWTs,
+			map[string]any{"jti": jti})
+		result, err := gate.ValidatePresentationSubmission(context.Background(), submissionJWT)
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "has already been used")
+		assert.False(tt, result.Valid)
+	})
+	t.Run("submission without jti", func(tt *testing.T) {
+		// without a configured replay store, a submission without a jti is accepted each time it is submitted
+		gate, err := NewCredentialGate(CredentialGateConfig{
+			AdminDID:               requesterID,
+			PresentationDefinition: presentationDefinition,
+		})
+		require.NoError(tt, err)
+		submissionJWT := buildTestSubmissionJWT(tt, signer, requesterID, presentationDefinition, vcJWTs, nil)
+		for i := 0; i < 2; i++ {
+			result, err := gate.ValidatePresentationSubmission(context.Background(), submissionJWT)
+			assert.NoError(tt, err)
+			assert.True(tt, result.Valid)
+		}
+
+		gate, err = NewCredentialGate(CredentialGateConfig{
+			AdminDID:               requesterID,
+			PresentationDefinition: presentationDefinition,
+			ReplayStore:            NewMemoryStore(0),
+		})
+		require.NoError(tt, err)
+		for i := 0; i < 2; i++ {
+			result, err := gate.ValidatePresentationSubmission(context.Background(), submissionJWT)
+			assert.Error(tt, err)
+			assert.False(tt, result.Valid)
+			assert.Equal(tt, ReasonInvalidSubmission, result.Reason.Code)
+			assert.Contains(tt, result.Reason.Message, "no ID to protect it against replay")
+		}
+	})
+}
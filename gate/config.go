@@ -0,0 +1,187 @@
+package gate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/TBD54566975/ssi-sdk/credential/exchange"
+	didsdk "github.com/TBD54566975/ssi-sdk/did"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFile is the contents of a gate config file, which configures a CredentialGateConfig declaratively. Custom
+// handlers are referenced by the name they are registered under in a HandlerRegistry.
+type ConfigFile struct {
+	AdminDID                    string                   `json:"adminDid"`
+	SupportedDIDMethods         []didsdk.Method          `json:"supportedDidMethods,omitempty"`
+	PresentationKeyRelationship VerificationRelationship `json:"presentationKeyRelationship,omitempty"`
+	UniversalResolverURL        string                   `json:"universalResolverUrl,omitempty"`
+
+	PresentationDefinition  *exchange.PresentationDefinition      `json:"presentationDefinition,omitempty"`
+	Handlers                map[string]HandlerReference           `json:"handlers,omitempty"`
+	PresentationDefinitions map[string]PresentationDefinitionFile `json:"presentationDefinitions,omitempty"`
+	HandlerParallelism      int                                   `json:"handlerParallelism,omitempty"`
+
+	HolderBinding  HolderBindingPolicy `json:"holderBinding,omitempty"`
+	TrustedIssuers TrustedIssuers      `json:"trustedIssuers,omitempty"`
+	ClaimMappings  ClaimMappings       `json:"claimMappings,omitempty"`
+
+	RequireChallenge bool `json:"requireChallenge,omitempty"`
+	// ChallengeTTL is a duration such as "5m"
+	ChallengeTTL string `json:"challengeTtl,omitempty"`
+
+	// ClockSkew and MaxPresentationAge are durations such as "30s"
+	ClockSkew          string `json:"clockSkew,omitempty"`
+	MaxPresentationAge string `json:"maxPresentationAge,omitempty"`
+
+	AccessToken *AccessTokenFile `json:"accessToken,omitempty"`
+
+	JSONLDContexts map[string]json.RawMessage `json:"jsonLdContexts,omitempty"`
+}
+
+// AccessTokenFile is an AccessTokenConfig in a config file, with its TTL given as a duration such as "5m"
+type AccessTokenFile struct {
+	TTL        string                   `json:"ttl,omitempty"`
+	Audience   []string                 `json:"audience,omitempty"`
+	Scopes     map[string][]string      `json:"scopes,omitempty"`
+	Claims     map[string]ClaimSelector `json:"claims,omitempty"`
+	Attributes bool                     `json:"attributes,omitempty"`
+}
+
+// PresentationDefinitionFile is a presentation definition in a config file along with references to its custom
+// handlers
+type PresentationDefinitionFile struct {
+	PresentationDefinition exchange.PresentationDefinition `json:"presentationDefinition"`
+	Handlers               map[string]HandlerReference     `json:"handlers,omitempty"`
+}
+
+// LoadConfig loads a gate config from a JSON or YAML file, chosen by its extension, creating the handlers it
+// references from the given registry, which are closed with the gate created from the config. The loaded config is
+// validated before any handler is created, and any error names the file and, for handler references, the offending
+// field. The config's AdminSigner, which webhook handlers and access tokens require, is left to the caller to set.
+func LoadConfig(filePath string, registry *HandlerRegistry) (*CredentialGateConfig, error) {
+	configBytes, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading config file %s", filePath)
+	}
+	var configFile ConfigFile
+	switch ext := strings.ToLower(filepath.Ext(filePath)); ext {
+	case ".json":
+		err = unmarshalConfigJSON(configBytes, &configFile)
+	case ".yaml", ".yml":
+		err = unmarshalConfigYAML(configBytes, &configFile)
+	default:
+		return nil, errors.Errorf("unsupported config file extension<%s> of %s", ext, filePath)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "unmarshalling config file %s", filePath)
+	}
+	config, err := configFile.toConfig(registry)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid config file %s", filePath)
+	}
+	// the admin signer is not part of the file, so handlers and access tokens requiring it are checked by the gate
+	if err = config.isValid(false); err != nil {
+		return nil, errors.Wrapf(err, "invalid config file %s", filePath)
+	}
+	created, err := config.withRegisteredHandlers(context.Background())
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid config file %s", filePath)
+	}
+	return &created, nil
+}
+
+// unmarshalConfigJSON unmarshals a config file, rejecting fields it does not know, so typos in policy are not
+// silently ignored
+func unmarshalConfigJSON(configBytes []byte, configFile *ConfigFile) error {
+	decoder := json.NewDecoder(bytes.NewReader(configBytes))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(configFile)
+}
+
+// unmarshalConfigYAML converts a YAML config file to JSON, so the JSON names of the config and presentation
+// exchange types apply to both formats
+func unmarshalConfigYAML(configBytes []byte, configFile *ConfigFile) error {
+	var document any
+	if err := yaml.Unmarshal(configBytes, &document); err != nil {
+		return err
+	}
+	jsonBytes, err := json.Marshal(document)
+	if err != nil {
+		return errors.Wrap(err, "converting YAML to JSON")
+	}
+	return unmarshalConfigJSON(jsonBytes, configFile)
+}
+
+// toConfig creates the config described by the file, whose handlers are created from the registry
+func (f ConfigFile) toConfig(registry *HandlerRegistry) (*CredentialGateConfig, error) {
+	config := CredentialGateConfig{
+		AdminDID:                    f.AdminDID,
+		SupportedDIDMethods:         f.SupportedDIDMethods,
+		PresentationKeyRelationship: f.PresentationKeyRelationship,
+		UniversalResolverURL:        f.UniversalResolverURL,
+		Handlers:                    f.Handlers,
+		HandlerRegistry:             registry,
+		HandlerParallelism:          f.HandlerParallelism,
+		HolderBinding:               f.HolderBinding,
+		TrustedIssuers:              f.TrustedIssuers,
+		ClaimMappings:               f.ClaimMappings,
+		RequireChallenge:            f.RequireChallenge,
+		JSONLDContexts:              f.JSONLDContexts,
+	}
+	if f.ChallengeTTL != "" {
+		ttl, err := time.ParseDuration(f.ChallengeTTL)
+		if err != nil {
+			return nil, errors.Wrap(err, "challengeTtl")
+		}
+		config.ChallengeTTL = ttl
+	}
+	if f.ClockSkew != "" {
+		skew, err := time.ParseDuration(f.ClockSkew)
+		if err != nil {
+			return nil, errors.Wrap(err, "clockSkew")
+		}
+		config.ClockSkew = skew
+	}
+	if f.MaxPresentationAge != "" {
+		maxAge, err := time.ParseDuration(f.MaxPresentationAge)
+		if err != nil {
+			return nil, errors.Wrap(err, "maxPresentationAge")
+		}
+		config.MaxPresentationAge = maxAge
+	}
+	if f.AccessToken != nil {
+		config.AccessToken = &AccessTokenConfig{
+			Audience:   f.AccessToken.Audience,
+			Scopes:     f.AccessToken.Scopes,
+			Claims:     f.AccessToken.Claims,
+			Attributes: f.AccessToken.Attributes,
+		}
+		if f.AccessToken.TTL != "" {
+			ttl, err := time.ParseDuration(f.AccessToken.TTL)
+			if err != nil {
+				return nil, errors.Wrap(err, "accessToken.ttl")
+			}
+			config.AccessToken.TTL = ttl
+		}
+	}
+	if f.PresentationDefinition != nil {
+		config.PresentationDefinition = *f.PresentationDefinition
+	}
+	if len(f.PresentationDefinitions) > 0 {
+		config.PresentationDefinitions = make(map[string]PresentationDefinitionConfig, len(f.PresentationDefinitions))
+	}
+	for key, definition := range f.PresentationDefinitions {
+		config.PresentationDefinitions[key] = PresentationDefinitionConfig{
+			PresentationDefinition: definition.PresentationDefinition,
+			Handlers:               definition.Handlers,
+		}
+	}
+	return &config, nil
+}
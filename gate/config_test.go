@@ -0,0 +1,226 @@
+package gate
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/TBD54566975/ssi-sdk/credential/exchange"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestLoadConfig(t *testing.T) {
+	handlers := NewHandlerRegistry()
+	require.NoError(t, handlers.Register("accept", func(_ context.Context, inputDescriptorID string, _ HandlerParams) (CustomHandler, error) {
+		return CustomHandler{
+			InputDescriptorID: inputDescriptorID,
+			Handler: func(context.Context, exchange.VerifiedSubmissionData) (bool, error) {
+				return true, nil
+			},
+		}, nil
+	}))
+	writeConfig := func(tt *testing.T, name, contents string) string {
+		filePath := filepath.Join(tt.TempDir(), name)
+		require.NoError(tt, os.WriteFile(filePath, []byte(contents), 0600))
+		return filePath
+	}
+
+	t.Run("load from YAML", func(tt *testing.T) {
+		filePath := writeConfig(tt, "gate.yaml", `
+adminDid: did:example:admin
+supportedDidMethods: [key, web]
+challengeTtl: 2m
+clockSkew: 30s
+maxPresentationAge: 10m
+presentationDefinition:
+  id: name-definition
+  input_descriptors:
+    - id: name
+      constraints:
+        fields:
+          - path: ["$.vc.credentialSubject.name"]
+handlers:
+  name:
+    handler: accept
+    match: any
+presentationDefinitions:
+  mail:
+    presentationDefinition:
+      id: email-definition
+      input_descriptors:
+        - id: email
+          constraints:
+            fields:
+              - path: ["$.vc.credentialSubject.email"]
+    handlers:
+      email:
+        handler: accept
+`)
+		config, err := LoadConfig(filePath, handlers)
+		require.NoError(tt, err)
+		assert.Equal(tt, "did:example:admin", config.AdminDID)
+		assert.Len(tt, config.SupportedDIDMethods, 2)
+		assert.Equal(tt, 2*time.Minute, config.ChallengeTTL)
+		assert.Equal(tt, 30*time.Second, config.ClockSkew)
+		assert.Equal(tt, 10*time.Minute, config.MaxPresentationAge)
+		assert.Equal(tt, "name-definition", config.PresentationDefinition.ID)
+		assert.Equal(tt, "name", config.CustomHandlers["name"].InputDescriptorID)
+		assert.Equal(tt, MatchAny, config.CustomHandlers["name"].Match)
+		assert.NotNil(tt, config.PresentationDefinitions["mail"].CustomHandlers["email"].Handler)
+
+		_, err = NewCredentialGate(*config)
+		assert.NoError(tt, err)
+	})
+
+	t.Run("load from JSON", func(tt *testing.T) {
+		filePath := writeConfig(tt, "gate.json", `{
+			"adminDid": "did:example:admin",
+			"presentationDefinition": {
+				"id": "name-definition",
+				"input_descriptors": [{"id": "name", "constraints": {"fields": [{"path": ["$.vc.credentialSubject.name"]}]}}]
+			},
+			"handlers": {"name": {"handler": "accept"}},
+			"claimMappings": {"name": [{"path": "$.credentialSubject.name", "attribute": "name", "type": "string"}]}
+		}`)
+		config, err := LoadConfig(filePath, handlers)
+		require.NoError(tt, err)
+		assert.Equal(tt, "name-definition", config.PresentationDefinition.ID)
+		assert.Contains(tt, config.CustomHandlers, "name")
+		assert.Equal(tt, ClaimMappings{"name": {{Path: "$.credentialSubject.name", Attribute: "name", Type: ParameterString}}}, config.ClaimMappings)
+	})
+
+	t.Run("round trip", func(tt *testing.T) {
+		definition := exchange.PresentationDefinition{
+			ID: "name-definition",
+			InputDescriptors: []exchange.InputDescriptor{{
+				ID:          "name",
+				Constraints: &exchange.Constraints{Fields: []exchange.Field{{Path: []string{"$.vc.credentialSubject.name"}}}},
+			}},
+		}
+		claimMappings := ClaimMappings{"name": {{Path: "$.credentialSubject.name", Attribute: "name", Type: ParameterString, Required: true}}}
+		claims := map[string]ClaimSelector{"given_name": {InputDescriptorID: "name", Path: "$.credentialSubject.name"}}
+		configFile := ConfigFile{
+			AdminDID:               "did:example:admin",
+			PresentationDefinition: &definition,
+			ClaimMappings:          claimMappings,
+			ClockSkew:              "45s",
+			MaxPresentationAge:     "2m",
+			AccessToken: &AccessTokenFile{
+				TTL:        "15m",
+				Audience:   []string{"https://api.example.com"},
+				Scopes:     map[string][]string{"name-definition": {"read", "write"}},
+				Claims:     claims,
+				Attributes: true,
+			},
+		}
+		expected := &AccessTokenConfig{
+			TTL:        15 * time.Minute,
+			Audience:   []string{"https://api.example.com"},
+			Scopes:     map[string][]string{"name-definition": {"read", "write"}},
+			Claims:     claims,
+			Attributes: true,
+		}
+
+		jsonBytes, err := json.Marshal(configFile)
+		require.NoError(tt, err)
+		// the YAML form of the file has the same names as its JSON form
+		var document any
+		require.NoError(tt, json.Unmarshal(jsonBytes, &document))
+		yamlBytes, err := yaml.Marshal(document)
+		require.NoError(tt, err)
+		for name, contents := range map[string][]byte{"gate.json": jsonBytes, "gate.yaml": yamlBytes} {
+			config, err := LoadConfig(writeConfig(tt, name, string(contents)), handlers)
+			require.NoError(tt, err, name)
+			assert.Equal(tt, claimMappings, config.ClaimMappings, name)
+			assert.Equal(tt, 45*time.Second, config.ClockSkew, name)
+			assert.Equal(tt, 2*time.Minute, config.MaxPresentationAge, name)
+			assert.Equal(tt, expected, config.AccessToken, name)
+		}
+
+		configFile.AccessToken.TTL = "a while"
+		jsonBytes, err = json.Marshal(configFile)
+		require.NoError(tt, err)
+		_, err = LoadConfig(writeConfig(tt, "gate.json", string(jsonBytes)), handlers)
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "accessToken.ttl")
+	})
+
+	t.Run("unknown handler", func(tt *testing.T) {
+		filePath := writeConfig(tt, "gate.yaml", `
+adminDid: did:example:admin
+presentationDefinitions:
+  mail:
+    presentationDefinition:
+      id: email-definition
+      input_descriptors:
+        - id: email
+    handlers:
+      email:
+        handler: unknown
+`)
+		_, err := LoadConfig(filePath, handlers)
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), filePath)
+		assert.Contains(tt, err.Error(), "presentationDefinitions.mail.handlers.email: unknown handler<unknown>")
+	})
+
+	t.Run("admin signer set after loading", func(tt *testing.T) {
+		admin := newTestSigner(tt)
+		filePath := writeConfig(tt, "gate.yaml", `
+adminDid: `+admin.ID+`
+presentationDefinition:
+  id: email-definition
+  input_descriptors:
+    - id: email
+      constraints:
+        fields:
+          - path: ["$.vc.credentialSubject.email"]
+handlers:
+  email:
+    handler: webhook
+    params:
+      url: https://example.com/webhook
+`)
+		config, err := LoadConfig(filePath, handlers)
+		require.NoError(tt, err)
+
+		_, err = NewCredentialGate(*config)
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "requires an admin signer")
+
+		config.AdminSigner = &admin
+		_, err = NewCredentialGate(*config)
+		assert.NoError(tt, err)
+	})
+
+	t.Run("unknown field", func(tt *testing.T) {
+		filePath := writeConfig(tt, "gate.yaml", `
+adminDid: did:example:admin
+requireChalenge: true
+`)
+		_, err := LoadConfig(filePath, handlers)
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), filePath)
+		assert.Contains(tt, err.Error(), "requireChalenge")
+	})
+
+	t.Run("invalid config", func(tt *testing.T) {
+		filePath := writeConfig(tt, "gate.json", `{"adminDid": "did:example:admin"}`)
+		_, err := LoadConfig(filePath, handlers)
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "invalid config file "+filePath)
+		assert.Contains(tt, err.Error(), "no presentation definition configured")
+	})
+
+	t.Run("unsupported extension", func(tt *testing.T) {
+		filePath := writeConfig(tt, "gate.toml", `adminDid = "did:example:admin"`)
+		_, err := LoadConfig(filePath, handlers)
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "unsupported config file extension")
+	})
+}
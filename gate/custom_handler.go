@@ -2,6 +2,8 @@ package gate
 
 import (
 	"context"
+	"sync"
+	"time"
 
 	"github.com/TBD54566975/ssi-sdk/credential/exchange"
 	"github.com/TBD54566975/ssi-sdk/util"
@@ -11,41 +13,229 @@ import (
 
 type CustomHandlerLogic func(ctx context.Context, vsd exchange.VerifiedSubmissionData) (bool, error)
 
+// MultiCustomHandlerLogic receives the submission data of every credential submitted for an input descriptor
+type MultiCustomHandlerLogic func(ctx context.Context, vsds []exchange.VerifiedSubmissionData) (bool, error)
+
+// MatchPolicy determines how many of the credentials submitted for an input descriptor must pass a custom handler
+type MatchPolicy string
+
+const (
+	// MatchAll requires every submitted credential to pass the handler
+	MatchAll MatchPolicy = "all"
+	// MatchAny requires at least one submitted credential to pass the handler
+	MatchAny MatchPolicy = "any"
+	// MatchAtLeast requires at least MinMatches submitted credentials to pass the handler
+	MatchAtLeast MatchPolicy = "atLeast"
+)
+
 type CustomHandler struct {
 	InputDescriptorID string             `json:"inputDescriptorId" validate:"required"`
-	Handler           CustomHandlerLogic `json:"customHandlerLogic" validate:"required"`
+	Handler           CustomHandlerLogic `json:"customHandlerLogic" validate:"required_without=MultiHandler"`
+
+	// MultiHandler, if set instead of Handler, is applied once to all credentials submitted for the input descriptor
+	MultiHandler MultiCustomHandlerLogic `json:"multiCustomHandlerLogic,omitempty" validate:"required_without=Handler"`
+
+	// Match is the policy by which Handler is applied when several credentials are submitted for the input descriptor
+	// If empty, all credentials must pass the handler
+	Match MatchPolicy `json:"match,omitempty"`
+
+	// MinMatches is the number of credentials which must pass the handler under the MatchAtLeast policy
+	MinMatches int `json:"minMatches,omitempty"`
+
+	// Timeout bounds each call of Handler or MultiHandler
+	// If empty, calls are bounded only by the context of the submission
+	Timeout time.Duration `json:"timeout,omitempty"`
+
+	// Retry retries calls which error transiently
+	// If empty, calls are not retried
+	Retry *RetryPolicy `json:"retry,omitempty"`
+
+	// CircuitBreaker stops calling the handler after repeated errors; it should not be shared between handlers
+	// If empty, the handler is always called
+	CircuitBreaker *CircuitBreaker `json:"-"`
+
+	// Close releases the resources held by the handler, such as a WebAssembly runtime, when the gate is closed
+	// If empty, the handler holds no resources
+	Close func(ctx context.Context) error `json:"-"`
+
+	// requiresAdminSigner is set for handlers which sign with the gate's admin signer, such as webhook handlers
+	// without a signer of their own
+	requiresAdminSigner bool
+}
+
+// IsValid checks the handler has a known match policy
+func (ch CustomHandler) IsValid() error {
+	if err := util.IsValidStruct(ch); err != nil {
+		return err
+	}
+	switch ch.Match {
+	case "", MatchAll, MatchAny:
+	case MatchAtLeast:
+		if ch.MinMatches < 1 {
+			return errors.Errorf("match policy %s requires minMatches of at least 1", MatchAtLeast)
+		}
+	default:
+		return errors.Errorf("unknown match policy: %s", ch.Match)
+	}
+	if ch.Timeout < 0 {
+		return errors.Errorf("timeout<%s> is negative", ch.Timeout)
+	}
+	if ch.Retry != nil {
+		if err := ch.Retry.IsValid(); err != nil {
+			return errors.Wrap(err, "invalid retry policy")
+		}
+	}
+	return nil
 }
 
 // applyCustomHandlers applies the custom handlers to the verified submission data
 // not all submission data will have a custom handler associated with it
 // we process as follows:
-// 1. for each custom handler, get the input descriptor ID
-// 2. for each input descriptor ID, find the corresponding submission data (if missing, fail)
-// 3. for each submission data, apply the custom handler
-// 4. if any custom handler fails, return false
-func (cg *CredentialGate) applyCustomHandlers(ctx context.Context, verifiedSubmissionData []exchange.VerifiedSubmissionData) (bool, error) {
-	submissionDataMap := make(map[string]exchange.VerifiedSubmissionData)
+// 1. order the custom handlers by their input descriptors in the presentation definition
+// 2. for each input descriptor ID, find the corresponding submission data (if missing, fail, unless the
+// presentation definition has submission requirements, in which case the input descriptor was not selected
+// by a satisfied requirement and its handler is skipped)
+// 3. run the custom handlers concurrently, each applied to its submission data according to its match policy;
+// once any custom handler fails, the rest are cancelled
+// 4. trace the custom handlers in order, and if any failed, return an error with the reason for the first failure
+// in order, so the outcome does not depend on which handler happened to finish first
+func (cg *CredentialGate) applyCustomHandlers(ctx context.Context, definition PresentationDefinitionConfig, verifiedSubmissionData []exchange.VerifiedSubmissionData) error {
+	submissionDataMap := make(map[string][]exchange.VerifiedSubmissionData)
 	for _, sd := range verifiedSubmissionData {
-		if _, ok := submissionDataMap[sd.InputDescriptorID]; ok {
-			// TODO(gabe) handle the case where there are multiple credentials that fulfill a single input descriptor
-			return false, errors.Errorf("duplicate submission data for input descriptor ID %s", sd.InputDescriptorID)
-		}
-		submissionDataMap[sd.InputDescriptorID] = sd
+		submissionDataMap[sd.InputDescriptorID] = append(submissionDataMap[sd.InputDescriptorID], sd)
 	}
 
-	for _, ch := range cg.config.CustomHandlers {
-		sd, ok := submissionDataMap[ch.InputDescriptorID]
+	hasRequirements := len(definition.PresentationDefinition.SubmissionRequirements) > 0
+	var handlers []CustomHandler
+	var submissionData [][]exchange.VerifiedSubmissionData
+	for _, inputDescriptor := range definition.PresentationDefinition.InputDescriptors {
+		ch, ok := definition.CustomHandlers[inputDescriptor.ID]
+		if !ok {
+			continue
+		}
+		sds, ok := submissionDataMap[ch.InputDescriptorID]
+		if !ok && hasRequirements {
+			continue
+		}
 		if !ok {
-			return false, errors.Errorf("missing submission data for input descriptor ID %s", ch.InputDescriptorID)
+			return newInputDescriptorDenial(ReasonConstraintFailed, ch.InputDescriptorID, nil,
+				errors.Errorf("missing submission data for input descriptor ID %s", ch.InputDescriptorID))
+		}
+		handlers = append(handlers, ch)
+		submissionData = append(submissionData, sds)
+	}
+
+	results := runCustomHandlers(ctx, cg.config.HandlerParallelism, handlers, submissionData)
+	var denial error
+	for i, result := range results {
+		if !result.ran {
+			continue
+		}
+		id := handlers[i].InputDescriptorID
+		traceFromContext(ctx).addCustomHandler(id, result.err == nil && result.handled, result.duration, result.err)
+		// a handler cancelled because another failed is not itself a reason for the denial
+		if denial != nil || result.cancelled {
+			continue
+		}
+		if result.err != nil {
+			denial = newInputDescriptorDenial(ReasonHandlerError, id, nil,
+				util.LoggingErrorMsg(result.err, "running custom handler"))
+		} else if !result.handled {
+			logrus.Errorf("custom handler failed for input descriptor ID %s", id)
+			denial = newInputDescriptorDenial(ReasonHandlerRejected, id, nil,
+				errors.Errorf("custom handler rejected input descriptor ID %s", id))
+		}
+	}
+	return denial
+}
+
+// customHandlerResult is the outcome of running a custom handler
+type customHandlerResult struct {
+	// ran is false if the handler was never started, because another failed first
+	ran      bool
+	handled  bool
+	err      error
+	duration time.Duration
+	// cancelled is true if the handler errored or rejected its submission data after another handler failed and
+	// cancelled it, since its outcome may be due to the cancellation
+	cancelled bool
+}
+
+// runCustomHandlers runs each handler against its submission data, at most parallelism at a time, starting them in
+// order. Once a handler errors or rejects its submission data, the context of the others is cancelled and no more
+// are started. Results are returned in the order of the handlers.
+func runCustomHandlers(ctx context.Context, parallelism int, handlers []CustomHandler, submissionData [][]exchange.VerifiedSubmissionData) []customHandlerResult {
+	results := make([]customHandlerResult, len(handlers))
+	if parallelism <= 0 || parallelism > len(handlers) {
+		parallelism = len(handlers)
+	}
+	handlerCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	slots := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i := range handlers {
+		slots <- struct{}{}
+		if handlerCtx.Err() != nil {
+			break
 		}
-		handled, err := ch.Handler(ctx, sd)
-		if err != nil {
-			return false, util.LoggingErrorMsg(err, "running custom handler")
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			start := time.Now()
+			handled, err := handlers[i].apply(handlerCtx, submissionData[i])
+			results[i] = customHandlerResult{
+				ran:       true,
+				handled:   handled,
+				err:       err,
+				duration:  time.Since(start),
+				cancelled: (err != nil || !handled) && handlerCtx.Err() != nil && ctx.Err() == nil,
+			}
+			if err != nil || !handled {
+				cancel()
+			}
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
+
+// apply runs the handler over all submission data for its input descriptor. Under the all policy the first
+// failure is returned. Otherwise, a failing or erroring credential only fails the handler if too few credentials
+// pass, in which case the first error encountered, if any, is returned. Each call of the handler is made under its
+// timeout, retry policy, and circuit breaker.
+func (ch CustomHandler) apply(ctx context.Context, sds []exchange.VerifiedSubmissionData) (bool, error) {
+	if ch.MultiHandler != nil {
+		return ch.call(ctx, func(ctx context.Context) (bool, error) { return ch.MultiHandler(ctx, sds) })
+	}
+
+	required := len(sds)
+	switch ch.Match {
+	case MatchAny:
+		required = 1
+	case MatchAtLeast:
+		required = ch.MinMatches
+	}
+
+	var passed int
+	var firstErr error
+	for _, sd := range sds {
+		sd := sd
+		handled, err := ch.call(ctx, func(ctx context.Context) (bool, error) { return ch.Handler(ctx, sd) })
+		if err != nil || !handled {
+			if ch.Match == "" || ch.Match == MatchAll {
+				return false, err
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
 		}
-		if !handled {
-			logrus.Errorf("custom handler failed for input descriptor ID %s", ch.InputDescriptorID)
-			return false, nil
+		passed++
+		if passed >= required {
+			return true, nil
 		}
 	}
-	return true, nil
+	return false, firstErr
 }
@@ -2,6 +2,8 @@ package gate
 
 import (
 	"context"
+	"fmt"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -14,6 +16,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCustomHandler(t *testing.T) {
@@ -190,3 +193,279 @@ func invalidAfterHandler(_ context.Context, vsd exchange.VerifiedSubmissionData)
 	}
 	return true, nil
 }
+
+func TestCustomHandlerMultipleCredentials(t *testing.T) {
+	requesterID := "did:test:admin"
+	inputDescriptorID := "employment"
+	presentationDefinition := exchange.PresentationDefinition{
+		ID: uuid.New().String(),
+		InputDescriptors: []exchange.InputDescriptor{
+			{
+				ID: inputDescriptorID,
+				Format: &exchange.ClaimFormat{
+					JWTVC: &exchange.JWTType{Alg: []crypto.SignatureAlgorithm{crypto.EdDSA}},
+				},
+				Constraints: &exchange.Constraints{
+					Fields: []exchange.Field{
+						{
+							Path: []string{"$.vc.credentialSubject.employer"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	// three employment credentials, only one of which is from a known employer
+	signer := newTestSigner(t)
+	var vcJWTs [][]byte
+	submission := exchange.PresentationSubmission{ID: uuid.NewString(), DefinitionID: presentationDefinition.ID}
+	for i, employer := range []string{"Acme", "TBD", "Initech"} {
+		vcJWT, err := credential.SignVerifiableCredentialJWT(signer, credential.VerifiableCredential{
+			Context:      []any{"https://www.w3.org/2018/credentials/v1"},
+			Type:         []string{"VerifiableCredential"},
+			Issuer:       signer.ID,
+			IssuanceDate: time.Now().Format(time.RFC3339),
+			CredentialSubject: map[string]any{
+				"id":       signer.ID,
+				"employer": employer,
+			},
+		})
+		require.NoError(t, err)
+		vcJWTs = append(vcJWTs, vcJWT)
+		submission.DescriptorMap = append(submission.DescriptorMap, exchange.SubmissionDescriptor{
+			ID:     inputDescriptorID,
+			Format: exchange.JWTVC.String(),
+			Path:   fmt.Sprintf("$.verifiableCredential[%d]", i),
+		})
+	}
+	knownEmployerHandler := func(_ context.Context, vsd exchange.VerifiedSubmissionData) (bool, error) {
+		return vsd.FilteredData == "TBD", nil
+	}
+
+	tests := []struct {
+		name    string
+		handler CustomHandler
+		valid   bool
+	}{
+		{
+			name:    "all credentials must match",
+			handler: CustomHandler{InputDescriptorID: inputDescriptorID, Handler: knownEmployerHandler},
+			valid:   false,
+		},
+		{
+			name:    "any credential may match",
+			handler: CustomHandler{InputDescriptorID: inputDescriptorID, Handler: knownEmployerHandler, Match: MatchAny},
+			valid:   true,
+		},
+		{
+			name:    "at least one credential must match",
+			handler: CustomHandler{InputDescriptorID: inputDescriptorID, Handler: knownEmployerHandler, Match: MatchAtLeast, MinMatches: 1},
+			valid:   true,
+		},
+		{
+			name:    "at least two credentials must match",
+			handler: CustomHandler{InputDescriptorID: inputDescriptorID, Handler: knownEmployerHandler, Match: MatchAtLeast, MinMatches: 2},
+			valid:   false,
+		},
+		{
+			name: "multi handler receives all credentials",
+			handler: CustomHandler{
+				InputDescriptorID: inputDescriptorID,
+				MultiHandler: func(_ context.Context, vsds []exchange.VerifiedSubmissionData) (bool, error) {
+					return len(vsds) == 3, nil
+				},
+			},
+			valid: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			gate, err := NewCredentialGate(CredentialGateConfig{
+				AdminDID:               requesterID,
+				PresentationDefinition: presentationDefinition,
+				CustomHandlers:         map[string]CustomHandler{inputDescriptorID: test.handler},
+			})
+			assert.NoError(tt, err)
+
+			submissionJWT := buildTestPresentationJWT(tt, signer, requesterID, &submission, vcJWTs, nil)
+			result, err := gate.ValidatePresentationSubmission(context.Background(), submissionJWT)
+			assert.NoError(tt, err)
+			assert.Equal(tt, test.valid, result.Valid)
+		})
+	}
+
+	t.Run("at least policy without min matches", func(tt *testing.T) {
+		_, err := NewCredentialGate(CredentialGateConfig{
+			AdminDID:               requesterID,
+			PresentationDefinition: presentationDefinition,
+			CustomHandlers: map[string]CustomHandler{
+				inputDescriptorID: {InputDescriptorID: inputDescriptorID, Handler: knownEmployerHandler, Match: MatchAtLeast},
+			},
+		})
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "requires minMatches of at least 1")
+	})
+
+	t.Run("unknown match policy", func(tt *testing.T) {
+		_, err := NewCredentialGate(CredentialGateConfig{
+			AdminDID:               requesterID,
+			PresentationDefinition: presentationDefinition,
+			CustomHandlers: map[string]CustomHandler{
+				inputDescriptorID: {InputDescriptorID: inputDescriptorID, Handler: knownEmployerHandler, Match: "most"},
+			},
+		})
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "unknown match policy: most")
+	})
+
+	t.Run("no handler logic", func(tt *testing.T) {
+		_, err := NewCredentialGate(CredentialGateConfig{
+			AdminDID:               requesterID,
+			PresentationDefinition: presentationDefinition,
+			CustomHandlers: map[string]CustomHandler{
+				inputDescriptorID: {InputDescriptorID: inputDescriptorID},
+			},
+		})
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "invalid custom handler")
+	})
+}
+
+func TestConcurrentCustomHandlers(t *testing.T) {
+	ids := []string{"first", "second", "third", "fourth"}
+	definition := PresentationDefinitionConfig{PresentationDefinition: exchange.PresentationDefinition{ID: "concurrent"}}
+	var submissionData []exchange.VerifiedSubmissionData
+	for _, id := range ids {
+		definition.PresentationDefinition.InputDescriptors = append(definition.PresentationDefinition.InputDescriptors, exchange.InputDescriptor{ID: id})
+		submissionData = append(submissionData, exchange.VerifiedSubmissionData{InputDescriptorID: id})
+	}
+	// the handlers of later input descriptors finish first
+	newHandlers := func(logic func(ctx context.Context, i int) (bool, error)) map[string]CustomHandler {
+		handlers := make(map[string]CustomHandler)
+		for i, id := range ids {
+			i := i
+			handlers[id] = CustomHandler{
+				InputDescriptorID: id,
+				Handler: func(ctx context.Context, _ exchange.VerifiedSubmissionData) (bool, error) {
+					return logic(ctx, i)
+				},
+			}
+		}
+		return handlers
+	}
+	apply := func(parallelism int, handlers map[string]CustomHandler) (*Trace, error) {
+		gate := &CredentialGate{config: CredentialGateConfig{HandlerParallelism: parallelism}}
+		definition.CustomHandlers = handlers
+		trace := new(Trace)
+		err := gate.applyCustomHandlers(withTrace(context.Background(), trace), definition, submissionData)
+		return trace, err
+	}
+	traceIDs := func(trace *Trace) []string {
+		var traced []string
+		for _, ch := range trace.CustomHandlers {
+			traced = append(traced, ch.InputDescriptorID)
+		}
+		return traced
+	}
+
+	t.Run("run concurrently and traced in order", func(tt *testing.T) {
+		var running, mostRunning atomic.Int32
+		handlers := newHandlers(func(_ context.Context, i int) (bool, error) {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for m := mostRunning.Load(); n > m && !mostRunning.CompareAndSwap(m, n); m = mostRunning.Load() {
+			}
+			time.Sleep(time.Duration(len(ids)-i) * 20 * time.Millisecond)
+			return true, nil
+		})
+
+		start := time.Now()
+		trace, err := apply(0, handlers)
+		assert.NoError(tt, err)
+		assert.Equal(tt, ids, traceIDs(trace))
+		assert.Less(tt, time.Since(start), 150*time.Millisecond)
+		assert.Equal(tt, int32(len(ids)), mostRunning.Load())
+
+		mostRunning.Store(0)
+		trace, err = apply(2, handlers)
+		assert.NoError(tt, err)
+		assert.Equal(tt, ids, traceIDs(trace))
+		assert.Equal(tt, int32(2), mostRunning.Load())
+	})
+
+	t.Run("first denial in order is reported", func(tt *testing.T) {
+		handlers := newHandlers(func(_ context.Context, i int) (bool, error) {
+			time.Sleep(time.Duration(len(ids)-i) * 20 * time.Millisecond)
+			switch ids[i] {
+			case "second":
+				return false, nil
+			case "fourth":
+				return false, errors.New("handler error")
+			}
+			return true, nil
+		})
+
+		// with one handler at a time, no handler after the first denial is run
+		trace, err := apply(1, handlers)
+		assert.Error(tt, err)
+		assert.Equal(tt, Reason{Code: ReasonHandlerRejected, InputDescriptorID: "second", Message: err.Error()}, getReason(err))
+		assert.Equal(tt, []string{"first", "second"}, traceIDs(trace))
+	})
+
+	t.Run("remaining handlers cancelled on denial", func(tt *testing.T) {
+		handlers := newHandlers(func(ctx context.Context, i int) (bool, error) {
+			if ids[i] == "third" {
+				return false, nil
+			}
+			select {
+			case <-ctx.Done():
+				return false, ctx.Err()
+			case <-time.After(5 * time.Second):
+				return true, nil
+			}
+		})
+
+		start := time.Now()
+		trace, err := apply(0, handlers)
+		assert.Less(tt, time.Since(start), time.Second)
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonHandlerRejected, getReason(err).Code)
+		assert.Equal(tt, "third", getReason(err).InputDescriptorID)
+		assert.Equal(tt, ids, traceIDs(trace))
+		assert.Contains(tt, trace.CustomHandlers[0].Error, "context canceled")
+	})
+
+	t.Run("rejection after cancellation is not a denial", func(tt *testing.T) {
+		handlers := newHandlers(func(ctx context.Context, i int) (bool, error) {
+			if ids[i] == "third" {
+				return false, nil
+			}
+			// the handler rejects its submission data once cancelled, rather than returning the context's error
+			<-ctx.Done()
+			return false, nil
+		})
+
+		for i := 0; i < 10; i++ {
+			_, err := apply(0, handlers)
+			assert.Error(tt, err)
+			assert.Equal(tt, "third", getReason(err).InputDescriptorID)
+		}
+	})
+
+	t.Run("negative parallelism", func(tt *testing.T) {
+		err := CredentialGateConfig{
+			AdminDID: "did:test:admin",
+			PresentationDefinition: exchange.PresentationDefinition{
+				ID: "concurrent",
+				InputDescriptors: []exchange.InputDescriptor{{
+					ID:          "first",
+					Constraints: &exchange.Constraints{Fields: []exchange.Field{{Path: []string{"$.vc.credentialSubject.id"}}}},
+				}},
+			},
+			HandlerParallelism: -1,
+		}.IsValid()
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "handler parallelism")
+	})
+}
@@ -0,0 +1,265 @@
+package gate
+
+import (
+	"context"
+
+	"github.com/TBD54566975/ssi-sdk/credential"
+	"github.com/TBD54566975/ssi-sdk/credential/exchange"
+	"github.com/pkg/errors"
+)
+
+// PresentationDefinitionConfig is a presentation definition the gate can validate submissions against, along with
+// the custom handlers applied to submissions which fulfill it
+type PresentationDefinitionConfig struct {
+	// PresentationDefinition is the presentation definition submissions are validated against
+	PresentationDefinition exchange.PresentationDefinition `json:"presentationDefinition"`
+
+	// CustomHandlers are the custom handlers, by input descriptor ID, applied to submissions which fulfill the
+	// presentation definition
+	CustomHandlers map[string]CustomHandler `json:"customHandlers,omitempty"`
+
+	// Handlers are further custom handlers, by input descriptor ID, created from the gate's HandlerRegistry
+	Handlers map[string]HandlerReference `json:"handlers,omitempty"`
+}
+
+// IsValid checks the presentation definition is valid and only uses features the gate supports, and that each
+// custom handler is for one of its input descriptors
+func (c PresentationDefinitionConfig) IsValid() error {
+	if err := c.PresentationDefinition.IsValid(); err != nil {
+		return errors.Wrap(err, "invalid presentation definition")
+	}
+	if err := checkSupportedFeatures(c.PresentationDefinition); err != nil {
+		return errors.Wrap(err, "unsupported presentation definition")
+	}
+	if err := checkSubmissionRequirements(c.PresentationDefinition); err != nil {
+		return errors.Wrap(err, "invalid submission requirements")
+	}
+
+	// make sure input descriptor in handler exists
+	inputDescriptorIDs := make(map[string]bool)
+	for _, id := range c.PresentationDefinition.InputDescriptors {
+		inputDescriptorIDs[id.ID] = true
+	}
+	for id, ch := range c.CustomHandlers {
+		if id != ch.InputDescriptorID {
+			return errors.Errorf("mismatched input descriptor ID, expected: %s, got %s", id, ch.InputDescriptorID)
+		}
+		if _, ok := inputDescriptorIDs[id]; !ok {
+			return errors.Errorf("input descriptor ID %s not found in presentation definition", id)
+		}
+		if err := ch.IsValid(); err != nil {
+			return errors.Wrap(err, "invalid custom handler")
+		}
+	}
+	return nil
+}
+
+// WithDefinition validates the submission against the presentation definition configured under the key in
+// PresentationDefinitions, rather than the one named by the submission. A presentation submission for any other
+// definition is denied.
+func WithDefinition(key string) ValidateOption {
+	return func(o *validateOptions) {
+		o.definition = key
+	}
+}
+
+// definitions returns every presentation definition of the gate by key, with the default presentation definition,
+// if there is one, under the empty key
+func (c CredentialGateConfig) definitions() map[string]PresentationDefinitionConfig {
+	definitions := make(map[string]PresentationDefinitionConfig, len(c.PresentationDefinitions)+1)
+	for key, definition := range c.PresentationDefinitions {
+		definitions[key] = definition
+	}
+	if !c.PresentationDefinition.IsEmpty() {
+		definitions[""] = PresentationDefinitionConfig{
+			PresentationDefinition: c.PresentationDefinition,
+			CustomHandlers:         c.CustomHandlers,
+			Handlers:               c.Handlers,
+		}
+	}
+	return definitions
+}
+
+// checkHandlers checks the definition's handler references against the registry, without creating the handlers,
+// naming the field of the offending reference in any error
+func (c PresentationDefinitionConfig) checkHandlers(key string, registry *HandlerRegistry) error {
+	if len(c.Handlers) == 0 {
+		return nil
+	}
+	field := handlersField(key)
+	if registry == nil {
+		return errors.Errorf("%s: handlers referenced without a handler registry", field)
+	}
+	inputDescriptorIDs := make(map[string]bool)
+	for _, id := range c.PresentationDefinition.InputDescriptors {
+		inputDescriptorIDs[id.ID] = true
+	}
+	for id, reference := range c.Handlers {
+		if _, ok := c.CustomHandlers[id]; ok {
+			return errors.Errorf("%s.%s: input descriptor ID also has a custom handler", field, id)
+		}
+		if !inputDescriptorIDs[id] {
+			return errors.Errorf("%s.%s: input descriptor ID %s not found in presentation definition", field, id, id)
+		}
+		if err := registry.Check(reference); err != nil {
+			return errors.Wrapf(err, "%s.%s", field, id)
+		}
+	}
+	return nil
+}
+
+// checkAdminSigner makes sure none of the definition's handlers sign with the admin signer, for a gate without one
+func (c PresentationDefinitionConfig) checkAdminSigner(key string) error {
+	for id, ch := range c.CustomHandlers {
+		if ch.requiresAdminSigner {
+			return errors.Errorf("custom handler for input descriptor ID %s requires an admin signer", id)
+		}
+	}
+	for id, reference := range c.Handlers {
+		if reference.Handler == WebhookHandlerName {
+			return errors.Errorf("%s.%s: handler<%s> requires an admin signer", handlersField(key), id, reference.Handler)
+		}
+	}
+	return nil
+}
+
+// createHandlers returns the definition's custom handlers along with those created from the registry for its
+// handler references, naming the field of the offending reference in any error. If any handler cannot be created,
+// those already created are closed.
+func (c PresentationDefinitionConfig) createHandlers(ctx context.Context, key string, registry *HandlerRegistry) (map[string]CustomHandler, error) {
+	if len(c.Handlers) == 0 {
+		return c.CustomHandlers, nil
+	}
+	if err := c.checkHandlers(key, registry); err != nil {
+		return nil, err
+	}
+	field := handlersField(key)
+	created := make(map[string]CustomHandler, len(c.Handlers))
+	for id, reference := range c.Handlers {
+		ch, err := registry.Create(ctx, id, reference)
+		if err != nil {
+			_ = closeHandlers(ctx, created)
+			return nil, errors.Wrapf(err, "%s.%s", field, id)
+		}
+		created[id] = *ch
+	}
+	for id, ch := range c.CustomHandlers {
+		created[id] = ch
+	}
+	return created, nil
+}
+
+// handlersField is the name of the handlers field of the presentation definition configured under the key
+func handlersField(key string) string {
+	if key == "" {
+		return "handlers"
+	}
+	return "presentationDefinitions." + key + ".handlers"
+}
+
+// withRegisteredHandlers returns the config with the handlers it references created from its registry and added
+// to the custom handlers of their presentation definitions. If any handler cannot be created, those already created
+// are closed.
+func (c CredentialGateConfig) withRegisteredHandlers(ctx context.Context) (config CredentialGateConfig, err error) {
+	var created []map[string]CustomHandler
+	defer func() {
+		if err != nil {
+			for _, handlers := range created {
+				_ = closeHandlers(ctx, handlers)
+			}
+		}
+	}()
+
+	customHandlers, err := PresentationDefinitionConfig{
+		PresentationDefinition: c.PresentationDefinition,
+		CustomHandlers:         c.CustomHandlers,
+		Handlers:               c.Handlers,
+	}.createHandlers(ctx, "", c.HandlerRegistry)
+	if err != nil {
+		return c, err
+	}
+	created = append(created, referencedHandlers(customHandlers, c.Handlers))
+	c.CustomHandlers, c.Handlers = customHandlers, nil
+	if len(c.PresentationDefinitions) == 0 {
+		return c, nil
+	}
+	definitions := make(map[string]PresentationDefinitionConfig, len(c.PresentationDefinitions))
+	for key, definition := range c.PresentationDefinitions {
+		if definition.CustomHandlers, err = definition.createHandlers(ctx, key, c.HandlerRegistry); err != nil {
+			return c, err
+		}
+		created = append(created, referencedHandlers(definition.CustomHandlers, definition.Handlers))
+		definition.Handlers = nil
+		definitions[key] = definition
+	}
+	c.PresentationDefinitions = definitions
+	return c, nil
+}
+
+// referencedHandlers returns the handlers created for the references, leaving out custom handlers provided in the
+// config, which the gate does not own until it is created
+func referencedHandlers(handlers map[string]CustomHandler, references map[string]HandlerReference) map[string]CustomHandler {
+	referenced := make(map[string]CustomHandler, len(references))
+	for id := range references {
+		referenced[id] = handlers[id]
+	}
+	return referenced
+}
+
+// closeHandlers closes each of the handlers which holds resources, returning the first error
+func closeHandlers(ctx context.Context, handlers map[string]CustomHandler) error {
+	var firstErr error
+	for id, ch := range handlers {
+		if ch.Close == nil {
+			continue
+		}
+		if err := ch.Close(ctx); err != nil && firstErr == nil {
+			firstErr = errors.Wrapf(err, "closing custom handler for input descriptor ID %s", id)
+		}
+	}
+	return firstErr
+}
+
+// selectDefinition picks the presentation definition a submission is validated against: the definition configured
+// under the given key if there is one, otherwise the definition named by the definition_id of the VP's
+// presentation submission. A VP without a presentation submission is validated against the default presentation
+// definition.
+func (cg *CredentialGate) selectDefinition(key string, vp credential.VerifiablePresentation) (*PresentationDefinitionConfig, error) {
+	if key != "" {
+		definition, ok := cg.config.PresentationDefinitions[key]
+		if !ok {
+			return nil, errors.Errorf("unknown presentation definition key: %s", key)
+		}
+		if vp.PresentationSubmission == nil {
+			return &definition, nil
+		}
+		submission, err := toPresentationSubmission(vp.PresentationSubmission)
+		if err != nil {
+			return &definition, newDenial(ReasonInvalidSubmission, err)
+		}
+		if submission.DefinitionID != definition.PresentationDefinition.ID {
+			return &definition, newDenial(ReasonInvalidSubmission, errors.Errorf("presentation submission is for presentation definition<%s>, not the selected presentation definition<%s>",
+				submission.DefinitionID, definition.PresentationDefinition.ID))
+		}
+		return &definition, nil
+	}
+
+	definitions := cg.config.definitions()
+	if vp.PresentationSubmission == nil {
+		definition, ok := definitions[""]
+		if !ok {
+			return nil, newDenial(ReasonInvalidSubmission, errors.New("VP has no presentation submission to select a presentation definition by"))
+		}
+		return &definition, nil
+	}
+	submission, err := toPresentationSubmission(vp.PresentationSubmission)
+	if err != nil {
+		return nil, newDenial(ReasonInvalidSubmission, err)
+	}
+	for _, definition := range definitions {
+		if definition.PresentationDefinition.ID == submission.DefinitionID {
+			return &definition, nil
+		}
+	}
+	return nil, newDenial(ReasonInvalidSubmission, errors.Errorf("presentation submission is for unknown presentation definition<%s>", submission.DefinitionID))
+}
@@ -0,0 +1,194 @@
+package gate
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/TBD54566975/ssi-sdk/credential"
+	"github.com/TBD54566975/ssi-sdk/credential/exchange"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPresentationDefinitions(t *testing.T) {
+	requesterID := "did:test:admin"
+	newDefinition := func(inputDescriptorID, path string) exchange.PresentationDefinition {
+		return exchange.PresentationDefinition{
+			ID: uuid.NewString(),
+			InputDescriptors: []exchange.InputDescriptor{{
+				ID:          inputDescriptorID,
+				Constraints: &exchange.Constraints{Fields: []exchange.Field{{Path: []string{path}}}},
+			}},
+		}
+	}
+	nameDefinition := newDefinition("name", "$.vc.credentialSubject.name")
+	emailDefinition := newDefinition("email", "$.vc.credentialSubject.email")
+	rejectingHandler := func(inputDescriptorID string) CustomHandler {
+		return CustomHandler{
+			InputDescriptorID: inputDescriptorID,
+			Handler: func(context.Context, exchange.VerifiedSubmissionData) (bool, error) {
+				return false, nil
+			},
+		}
+	}
+	config := CredentialGateConfig{
+		AdminDID: requesterID,
+		PresentationDefinitions: map[string]PresentationDefinitionConfig{
+			"profile": {PresentationDefinition: nameDefinition},
+			"mail": {
+				PresentationDefinition: emailDefinition,
+				CustomHandlers:         map[string]CustomHandler{"email": rejectingHandler("email")},
+			},
+		},
+	}
+
+	signer := newTestSigner(t)
+	vcJWT, err := credential.SignVerifiableCredentialJWT(signer, credential.VerifiableCredential{
+		Context:           []any{"https://www.w3.org/2018/credentials/v1"},
+		Type:              []string{"VerifiableCredential"},
+		Issuer:            signer.ID,
+		IssuanceDate:      time.Now().Format(time.RFC3339),
+		CredentialSubject: map[string]any{"id": signer.ID, "name": "Satoshi", "email": "satoshi@example.com"},
+	})
+	require.NoError(t, err)
+
+	t.Run("select by definition ID", func(tt *testing.T) {
+		gate, err := NewCredentialGate(config)
+		require.NoError(tt, err)
+
+		submissionJWT := buildTestSubmissionJWT(tt, signer, requesterID, nameDefinition, [][]byte{vcJWT}, nil)
+		result, err := gate.ValidatePresentationSubmission(context.Background(), submissionJWT)
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+		assert.Equal(tt, nameDefinition.ID, result.DefinitionID)
+
+		// only the handlers of the selected definition apply
+		submissionJWT = buildTestSubmissionJWT(tt, signer, requesterID, emailDefinition, [][]byte{vcJWT}, nil)
+		result, err = gate.ValidatePresentationSubmission(context.Background(), submissionJWT)
+		assert.NoError(tt, err)
+		assert.False(tt, result.Valid)
+		assert.Equal(tt, emailDefinition.ID, result.DefinitionID)
+		assert.Equal(tt, ReasonHandlerRejected, result.Reason.Code)
+	})
+
+	t.Run("select by key", func(tt *testing.T) {
+		gate, err := NewCredentialGate(config)
+		require.NoError(tt, err)
+
+		// without a presentation submission, a definition must be selected by key
+		submissionJWT := buildTestPresentationJWT(tt, signer, requesterID, nil, [][]byte{vcJWT}, nil)
+		result, err := gate.ValidatePresentationSubmission(context.Background(), submissionJWT)
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonInvalidSubmission, result.Reason.Code)
+
+		submissionJWT = buildTestPresentationJWT(tt, signer, requesterID, nil, [][]byte{vcJWT}, nil)
+		result, err = gate.ValidatePresentationSubmission(context.Background(), submissionJWT, WithDefinition("profile"))
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+		assert.Equal(tt, nameDefinition.ID, result.DefinitionID)
+
+		// the selected definition must be the one the submission is for
+		submissionJWT = buildTestSubmissionJWT(tt, signer, requesterID, nameDefinition, [][]byte{vcJWT}, nil)
+		result, err = gate.ValidatePresentationSubmission(context.Background(), submissionJWT, WithDefinition("mail"))
+		assert.Error(tt, err)
+		assert.False(tt, result.Valid)
+		assert.Equal(tt, emailDefinition.ID, result.DefinitionID)
+	})
+
+	t.Run("pinned definition", func(tt *testing.T) {
+		strictDefinition := newDefinition("name", "$.vc.credentialSubject.verifiedName")
+		pinnedConfig := config
+		pinnedConfig.PresentationDefinitions = map[string]PresentationDefinitionConfig{
+			"strict": {PresentationDefinition: strictDefinition},
+			"loose":  {PresentationDefinition: nameDefinition},
+		}
+		gate, err := NewCredentialGate(pinnedConfig)
+		require.NoError(tt, err)
+
+		// unpinned, the submitter chooses the loose definition, as the result shows
+		submissionJWT := buildTestSubmissionJWT(tt, signer, requesterID, nameDefinition, [][]byte{vcJWT}, nil)
+		result, err := gate.ValidatePresentationSubmission(context.Background(), submissionJWT)
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+		assert.Equal(tt, nameDefinition.ID, result.DefinitionID)
+
+		// pinned to the strict definition, a submission for the loose one is denied
+		submissionJWT = buildTestSubmissionJWT(tt, signer, requesterID, nameDefinition, [][]byte{vcJWT}, nil)
+		result, err = gate.ValidatePresentationSubmission(context.Background(), submissionJWT, WithDefinition("strict"))
+		assert.Error(tt, err)
+		assert.False(tt, result.Valid)
+		assert.Equal(tt, ReasonInvalidSubmission, result.Reason.Code)
+		assert.Equal(tt, strictDefinition.ID, result.DefinitionID)
+		assert.Contains(tt, result.Reason.Message, "not the selected presentation definition")
+	})
+
+	t.Run("unknown key", func(tt *testing.T) {
+		gate, err := NewCredentialGate(config)
+		require.NoError(tt, err)
+
+		submissionJWT := buildTestSubmissionJWT(tt, signer, requesterID, nameDefinition, [][]byte{vcJWT}, nil)
+		result, err := gate.ValidatePresentationSubmission(context.Background(), submissionJWT, WithDefinition("unknown"))
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonInternalError, result.Reason.Code)
+	})
+
+	t.Run("unknown definition ID", func(tt *testing.T) {
+		gate, err := NewCredentialGate(config)
+		require.NoError(tt, err)
+
+		submissionJWT := buildTestSubmissionJWT(tt, signer, requesterID, newDefinition("name", "$.vc.credentialSubject.name"), [][]byte{vcJWT}, nil)
+		result, err := gate.ValidatePresentationSubmission(context.Background(), submissionJWT)
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonInvalidSubmission, result.Reason.Code)
+		assert.Contains(tt, err.Error(), "unknown presentation definition")
+	})
+
+	t.Run("default definition alongside named definitions", func(tt *testing.T) {
+		withDefault := config
+		withDefault.PresentationDefinition = newDefinition("name", "$.vc.credentialSubject.name")
+		gate, err := NewCredentialGate(withDefault)
+		require.NoError(tt, err)
+
+		submissionJWT := buildTestPresentationJWT(tt, signer, requesterID, nil, [][]byte{vcJWT}, nil)
+		result, err := gate.ValidatePresentationSubmission(context.Background(), submissionJWT)
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+		assert.Equal(tt, withDefault.PresentationDefinition.ID, result.DefinitionID)
+	})
+
+	t.Run("invalid configs", func(tt *testing.T) {
+		_, err := NewCredentialGate(CredentialGateConfig{AdminDID: requesterID})
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "no presentation definition configured")
+
+		_, err = NewCredentialGate(CredentialGateConfig{
+			AdminDID: requesterID,
+			PresentationDefinitions: map[string]PresentationDefinitionConfig{
+				"profile": {PresentationDefinition: nameDefinition},
+				"again":   {PresentationDefinition: nameDefinition},
+			},
+		})
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "is used by both")
+
+		_, err = NewCredentialGate(CredentialGateConfig{
+			AdminDID: requesterID,
+			PresentationDefinitions: map[string]PresentationDefinitionConfig{
+				"profile": {
+					PresentationDefinition: nameDefinition,
+					CustomHandlers:         map[string]CustomHandler{"email": rejectingHandler("email")},
+				},
+			},
+		})
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "presentation definition<profile>")
+
+		withHandlers := config
+		withHandlers.CustomHandlers = map[string]CustomHandler{"name": rejectingHandler("name")}
+		_, err = NewCredentialGate(withHandlers)
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "custom handlers configured without a presentation definition")
+	})
+}
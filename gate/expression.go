@@ -0,0 +1,139 @@
+package gate
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/TBD54566975/ssi-sdk/credential/exchange"
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/pkg/errors"
+)
+
+const (
+	// ExpressionHandlerName is the name the expression handler is built into every HandlerRegistry under. It takes
+	// a single expression parameter.
+	ExpressionHandlerName = "expression"
+
+	expressionParam = "expression"
+
+	// expressionCostLimit bounds the work an expression may do for each credential it is evaluated against
+	expressionCostLimit = 1000000
+
+	credentialVariable   = "credential"
+	subjectVariable      = "subject"
+	filteredDataVariable = "filteredData"
+	nowVariable          = "now"
+)
+
+// NewExpressionHandler creates a custom handler which accepts a credential if a CEL expression
+// https://github.com/google/cel-spec evaluates to true against it. The expression is compiled, and type checked,
+// when the handler is created. It may use the following variables:
+//   - credential: the credential in the VC data model, or the disclosed claims of an SD-JWT credential
+//   - subject: the credential subject, or the disclosed claims of an SD-JWT credential
+//   - filteredData: the data selected by the input descriptor's constraints
+//   - now: the time the expression is evaluated
+//
+// For example, "subject.age >= 21", "subject.country in ['US', 'CA']", or
+// "timestamp(credential.expirationDate) - now > duration('720h')".
+func NewExpressionHandler(inputDescriptorID, expression string) (CustomHandler, error) {
+	program, err := compileExpression(expression)
+	if err != nil {
+		return CustomHandler{}, err
+	}
+	return CustomHandler{
+		InputDescriptorID: inputDescriptorID,
+		Handler: func(ctx context.Context, vsd exchange.VerifiedSubmissionData) (bool, error) {
+			return evaluateExpression(ctx, program, vsd)
+		},
+	}, nil
+}
+
+// newExpressionHandler is the factory of the built-in expression handler
+func newExpressionHandler(_ context.Context, inputDescriptorID string, params HandlerParams) (CustomHandler, error) {
+	return NewExpressionHandler(inputDescriptorID, params.String(expressionParam))
+}
+
+// validateExpressionHandler checks the expression of a reference to the built-in expression handler compiles
+func validateExpressionHandler(params HandlerParams) error {
+	_, err := compileExpression(params.String(expressionParam))
+	return err
+}
+
+// compileExpression compiles an expression which must evaluate to a boolean
+func compileExpression(expression string) (cel.Program, error) {
+	env, err := cel.NewEnv(
+		cel.Variable(credentialVariable, cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable(subjectVariable, cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable(filteredDataVariable, cel.DynType),
+		cel.Variable(nowVariable, cel.TimestampType),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating expression environment")
+	}
+	ast, issues := env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, errors.Wrapf(issues.Err(), "compiling expression<%s>", expression)
+	}
+	if outputType := ast.OutputType(); outputType != cel.BoolType && outputType != cel.DynType {
+		return nil, errors.Errorf("expression<%s> evaluates to %s, not bool", expression, outputType)
+	}
+	program, err := env.Program(ast, cel.CostLimit(expressionCostLimit), cel.InterruptCheckFrequency(100))
+	if err != nil {
+		return nil, errors.Wrapf(err, "creating program for expression<%s>", expression)
+	}
+	return program, nil
+}
+
+// evaluateExpression evaluates a compiled expression against the submission data of a credential
+func evaluateExpression(ctx context.Context, program cel.Program, vsd exchange.VerifiedSubmissionData) (bool, error) {
+	cred, subject, err := getExpressionClaims(vsd.Claim)
+	if err != nil {
+		return false, err
+	}
+	filteredData := vsd.FilteredData
+	if filteredData == nil {
+		filteredData = types.NullValue
+	}
+	out, _, err := program.ContextEval(ctx, map[string]any{
+		credentialVariable:   cred,
+		subjectVariable:      subject,
+		filteredDataVariable: filteredData,
+		nowVariable:          nowFromContext(ctx),
+	})
+	if err != nil {
+		return false, errors.Wrap(err, "evaluating expression")
+	}
+	result, ok := out.Value().(bool)
+	if !ok {
+		return false, errors.Errorf("expression evaluated to %s, not bool", out.Type())
+	}
+	return result, nil
+}
+
+// getExpressionClaims returns the verified claim as the credential and subject variables of an expression. The
+// claim is either a JWT or JSON-LD credential, or the disclosed claims of an SD-JWT credential, which have no
+// credentialSubject.
+func getExpressionClaims(claim any) (cred map[string]any, subject map[string]any, err error) {
+	if claims, ok := claim.(map[string]any); ok {
+		if _, isVC := claims["credentialSubject"]; !isVC {
+			return claims, claims, nil
+		}
+	}
+	vc, err := toCredential(claim)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "parsing credential")
+	}
+	vcBytes, err := json.Marshal(vc)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "marshalling credential")
+	}
+	if err = json.Unmarshal(vcBytes, &cred); err != nil {
+		return nil, nil, errors.Wrap(err, "unmarshalling credential")
+	}
+	subject, _ = cred["credentialSubject"].(map[string]any)
+	if subject == nil {
+		subject = make(map[string]any)
+	}
+	return cred, subject, nil
+}
@@ -0,0 +1,152 @@
+package gate
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/TBD54566975/ssi-sdk/credential"
+	"github.com/TBD54566975/ssi-sdk/credential/exchange"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpressionHandler(t *testing.T) {
+	signer := newTestSigner(t)
+	vcJWT, err := credential.SignVerifiableCredentialJWT(signer, credential.VerifiableCredential{
+		Context:           []any{"https://www.w3.org/2018/credentials/v1"},
+		Type:              []string{"VerifiableCredential"},
+		Issuer:            signer.ID,
+		IssuanceDate:      time.Now().Format(time.RFC3339),
+		ExpirationDate:    time.Now().Add(90 * 24 * time.Hour).Format(time.RFC3339),
+		CredentialSubject: map[string]any{"id": signer.ID, "age": 25, "country": "CA"},
+	})
+	require.NoError(t, err)
+	vsd := exchange.VerifiedSubmissionData{InputDescriptorID: "age", Claim: string(vcJWT), FilteredData: float64(25)}
+
+	t.Run("evaluate", func(tt *testing.T) {
+		tests := map[string]bool{
+			"subject.age >= 21":               true,
+			"subject.age >= 30":               false,
+			"subject.country in ['US', 'CA']": true,
+			"filteredData == 25":              true,
+			"credential.issuer == subject.id": true,
+			"has(subject.email)":              false,
+			"timestamp(credential.expirationDate) - now > duration('720h')": true,
+		}
+		for expression, expected := range tests {
+			ch, err := NewExpressionHandler("age", expression)
+			require.NoError(tt, err, expression)
+			result, err := ch.Handler(context.Background(), vsd)
+			assert.NoError(tt, err, expression)
+			assert.Equal(tt, expected, result, expression)
+		}
+	})
+
+	t.Run("SD-JWT disclosed claims", func(tt *testing.T) {
+		ch, err := NewExpressionHandler("age", "subject.age >= 21 && credential.vct == 'AgeCredential'")
+		require.NoError(tt, err)
+		result, err := ch.Handler(context.Background(), exchange.VerifiedSubmissionData{
+			InputDescriptorID: "age",
+			Claim:             map[string]any{"vct": "AgeCredential", "age": float64(25)},
+		})
+		assert.NoError(tt, err)
+		assert.True(tt, result)
+	})
+
+	t.Run("evaluation error", func(tt *testing.T) {
+		ch, err := NewExpressionHandler("age", "subject.email == 'satoshi@example.com'")
+		require.NoError(tt, err)
+		_, err = ch.Handler(context.Background(), vsd)
+		assert.Error(tt, err)
+	})
+
+	t.Run("compile errors", func(tt *testing.T) {
+		_, err := NewExpressionHandler("age", "subject.age >=")
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "compiling expression")
+
+		_, err = NewExpressionHandler("age", "unknown.age >= 21")
+		assert.Error(tt, err)
+
+		_, err = NewExpressionHandler("age", "'not a bool'")
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "not bool")
+	})
+
+	t.Run("checked when validating config", func(tt *testing.T) {
+		filePath := filepath.Join(tt.TempDir(), "gate.yaml")
+		require.NoError(tt, os.WriteFile(filePath, []byte(`
+adminDid: did:example:admin
+presentationDefinition:
+  id: age-definition
+  input_descriptors:
+    - id: age
+      constraints:
+        fields:
+          - path: ["$.vc.credentialSubject.age"]
+handlers:
+  age:
+    handler: expression
+    params:
+      expression: subject.age >=
+`), 0600))
+		_, err := LoadConfig(filePath, NewHandlerRegistry())
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "handlers.age")
+		assert.Contains(tt, err.Error(), "compiling expression")
+
+		config := CredentialGateConfig{
+			AdminDID: "did:example:admin",
+			PresentationDefinition: exchange.PresentationDefinition{
+				ID: "age-definition",
+				InputDescriptors: []exchange.InputDescriptor{{
+					ID:          "age",
+					Constraints: &exchange.Constraints{Fields: []exchange.Field{{Path: []string{"$.vc.credentialSubject.age"}}}},
+				}},
+			},
+			HandlerRegistry: NewHandlerRegistry(),
+			Handlers: map[string]HandlerReference{
+				"age": {Handler: ExpressionHandlerName, Params: map[string]any{"expression": "size(subject)"}},
+			},
+		}
+		err = config.IsValid()
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "not bool")
+	})
+
+	t.Run("gate with expression handler", func(tt *testing.T) {
+		requesterID := "did:test:admin"
+		def := exchange.PresentationDefinition{
+			ID: "age-definition",
+			InputDescriptors: []exchange.InputDescriptor{{
+				ID:          "age",
+				Constraints: &exchange.Constraints{Fields: []exchange.Field{{Path: []string{"$.vc.credentialSubject.age"}}}},
+			}},
+		}
+		newGate := func(expression string) *CredentialGate {
+			gate, err := NewCredentialGate(CredentialGateConfig{
+				AdminDID:               requesterID,
+				PresentationDefinition: def,
+				HandlerRegistry:        NewHandlerRegistry(),
+				Handlers: map[string]HandlerReference{
+					"age": {Handler: ExpressionHandlerName, Params: map[string]any{"expression": expression}},
+				},
+			})
+			require.NoError(tt, err)
+			return gate
+		}
+		submissionJWT := buildTestSubmissionJWT(tt, signer, requesterID, def, [][]byte{vcJWT}, nil)
+
+		result, err := newGate("filteredData >= 21").ValidatePresentationSubmission(context.Background(), submissionJWT)
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+
+		result, err = newGate("filteredData >= 30").ValidatePresentationSubmission(context.Background(), submissionJWT)
+		assert.NoError(tt, err)
+		assert.False(tt, result.Valid)
+		assert.Equal(tt, ReasonHandlerRejected, result.Reason.Code)
+	})
+}
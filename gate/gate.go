@@ -2,70 +2,263 @@ package gate
 
 import (
 	"context"
+	"encoding/json"
+	"time"
 
 	"github.com/TBD54566975/ssi-sdk/credential"
 	"github.com/TBD54566975/ssi-sdk/credential/exchange"
 	"github.com/TBD54566975/ssi-sdk/crypto/jwx"
 	didsdk "github.com/TBD54566975/ssi-sdk/did"
 	"github.com/TBD54566975/ssi-sdk/util"
-	"github.com/lestrrat-go/jwx/v2/jws"
 	"github.com/pkg/errors"
 
 	"github.com/TBD54566975/credential-gate/resolver"
 )
 
 type CredentialGateConfig struct {
-	// TODO(gabe) allow configuration of supported DID methods https://github.com/TBD54566975/credential-gate/issues/7
-	// SupportedDIDMethods is a list of DID methods that are supported by this credential gate
+	// SupportedDIDMethods is a list of DID methods that are supported by this credential gate, both for
+	// signing presentation submissions and for issuing the credentials within them; DIDs of other methods are never
+	// resolved, whether for a submission, its holder binding, or a status list
 	// If empty, all DID methods are supported
-	// SupportedDIDMethods []didsdk.Method `json:"supportedDidMethods,omitempty"`
+	SupportedDIDMethods []didsdk.Method `json:"supportedDidMethods,omitempty"`
 
 	// AdminDID is the DID of the credential gate; the audience of any presentation submission
 	// submitted to the gate.
 	AdminDID string `json:"adminDid" validate:"required"`
 
+	// AdminSigner signs on behalf of AdminDID, such as the requests of webhook handlers
+	// If empty, the gate cannot sign
+	AdminSigner *jwx.Signer `json:"-"`
+
+	// PresentationKeyRelationship is the verification relationship of the submitter's DID Document that the key
+	// signing a presentation submission must be in
+	// If empty, the key must be in the authentication relationship
+	PresentationKeyRelationship VerificationRelationship `json:"presentationKeyRelationship,omitempty"`
+
 	// UniversalResolverURL is the URL of the universal resolver to use for resolving DIDs
 	// If empty, a universal resolver will not be configured
 	UniversalResolverURL string `json:"universalResolverUrl,omitempty"`
 
 	// PresentationDefinition is the presentation definition that this credential gate will
 	// use to validate credentials against
-	PresentationDefinition exchange.PresentationDefinition `json:"presentationDefinition" validate:"required"`
+	// It may only be empty if PresentationDefinitions is set
+	PresentationDefinition exchange.PresentationDefinition `json:"presentationDefinition,omitempty" validate:"-"`
 
 	// CustomHandlers is a list of custom handlers that can be used to validate credentials
+	// submitted against PresentationDefinition
 	CustomHandlers map[string]CustomHandler `json:"customHandlers,omitempty"`
+
+	// Handlers are custom handlers, by input descriptor ID, created from HandlerRegistry and applied to credentials
+	// submitted against PresentationDefinition along with CustomHandlers
+	Handlers map[string]HandlerReference `json:"handlers,omitempty"`
+
+	// HandlerRegistry is the registry of the handlers referenced by Handlers and by each of PresentationDefinitions
+	HandlerRegistry *HandlerRegistry `json:"-"`
+
+	// HandlerParallelism is the most custom handlers run at once when validating a submission
+	// If empty, all of a presentation definition's custom handlers run at once
+	HandlerParallelism int `json:"handlerParallelism,omitempty"`
+
+	// PresentationDefinitions are further presentation definitions by key, each with its own custom handlers.
+	// A submission is validated against the definition named by its definition_id, or the one selected with
+	// WithDefinition. Since the submitter chooses the definition_id, callers which accept only some definitions for
+	// a request must select one WithDefinition, or check the DefinitionID of the result.
+	PresentationDefinitions map[string]PresentationDefinitionConfig `json:"presentationDefinitions,omitempty"`
+
+	// HolderBinding is the policy binding the submitter to the subjects of the credentials it presents
+	// If empty, holder binding is not checked
+	HolderBinding HolderBindingPolicy `json:"holderBinding,omitempty"`
+
+	// TrustedIssuers maps input descriptor IDs to the issuers trusted to issue the credentials submitted for them
+	// If an input descriptor has no trusted issuers, credentials from any issuer are accepted for it
+	TrustedIssuers TrustedIssuers `json:"trustedIssuers,omitempty"`
+
+	// TrustRegistry looks up the issuers trusted for each input descriptor
+	// If empty, TrustedIssuers is used
+	TrustRegistry TrustRegistry `json:"-"`
+
+	// Clock returns the current time, against which the validity periods of presentations and credentials are checked
+	// If empty, the system clock is used
+	Clock func() time.Time `json:"-"`
+
+	// ClockSkew is how far the clocks of the signers of presentations and credentials may be ahead of or behind the
+	// gate's clock when checking validity periods
+	// If empty, no skew is allowed
+	ClockSkew time.Duration `json:"clockSkew,omitempty"`
+
+	// MaxPresentationAge is how long after it was issued a presentation is accepted; presentations must then state
+	// when they were issued, with the iat of a VP JWT or key binding JWT, or the created time of a JSON-LD VP proof
+	// If empty, presentations of any age are accepted
+	MaxPresentationAge time.Duration `json:"maxPresentationAge,omitempty"`
+
+	// RequireChallenge requires each presentation submission to set its nonce or jti, or the challenge of the
+	// proof of a JSON-LD VP, to a challenge previously issued by NewChallenge
+	RequireChallenge bool `json:"requireChallenge,omitempty"`
+
+	// ChallengeTTL is how long an issued challenge can be answered for
+	// If empty, challenges are valid for five minutes
+	ChallengeTTL time.Duration `json:"challengeTtl,omitempty"`
+
+	// NonceStore holds outstanding challenges
+	// If empty, an in-memory store is used
+	NonceStore NonceStore `json:"-"`
+
+	// ReplayStore records the IDs of accepted presentation submissions to reject replays; if set, presentation
+	// submissions must have an ID, the jti of a VP JWT or the id of a JSON-LD VP
+	// If empty, an in-memory store is used, and presentation submissions without an ID are not protected against replay
+	ReplayStore ReplayStore `json:"-"`
+
+	// JSONLDContexts are JSON-LD contexts, by URL, which JSON-LD credentials and presentations may use in
+	// addition to the standard credential, security, and status list contexts; contexts are never fetched
+	JSONLDContexts map[string]json.RawMessage `json:"jsonLdContexts,omitempty"`
+
+	// ClaimMappings map claims of the credentials submitted for each input descriptor to the attributes of the result
+	// If empty, the result has no attributes
+	ClaimMappings ClaimMappings `json:"claimMappings,omitempty"`
+
+	// AccessToken configures the access token issued, signed by AdminSigner, when the gate grants access
+	// If empty, no access token is issued
+	AccessToken *AccessTokenConfig `json:"accessToken,omitempty"`
+
+	// StatusListFetcher fetches the status lists referenced by the credentialStatus of submitted credentials,
+	// which are checked for revocation and suspension
+	// If empty, status lists are fetched over HTTPS from public addresses
+	StatusListFetcher StatusListFetcher `json:"-"`
 }
 
 func (c CredentialGateConfig) IsValid() error {
+	return c.isValid(true)
+}
+
+// isValid checks the config, leaving out the checks that handlers and access tokens have an admin signer to sign
+// with unless checkAdminSigner is set, since a config loaded from a file is given its admin signer afterwards
+func (c CredentialGateConfig) isValid(checkAdminSigner bool) error {
 	if err := util.IsValidStruct(c); err != nil {
 		return errors.Wrap(err, "invalid config struct")
 	}
-	if err := c.PresentationDefinition.IsValid(); err != nil {
-		return errors.Wrap(err, "invalid presentation definition")
+	definitions := c.definitions()
+	if len(definitions) == 0 {
+		return errors.New("no presentation definition configured")
 	}
-
-	// make sure input descriptor in handler exists
+	if _, ok := definitions[""]; !ok && (len(c.CustomHandlers) > 0 || len(c.Handlers) > 0) {
+		return errors.New("custom handlers configured without a presentation definition")
+	}
+	definitionKeys := make(map[string]string)
 	inputDescriptorIDs := make(map[string]bool)
-	for _, id := range c.PresentationDefinition.InputDescriptors {
-		inputDescriptorIDs[id.ID] = true
+	for key, definition := range definitions {
+		// handler references are checked without creating their handlers, which may hold resources
+		if err := definition.checkHandlers(key, c.HandlerRegistry); err != nil {
+			return err
+		}
+		if err := definition.IsValid(); err != nil {
+			if key == "" {
+				return err
+			}
+			return errors.Wrapf(err, "presentation definition<%s>", key)
+		}
+		if checkAdminSigner && c.AdminSigner == nil {
+			if err := definition.checkAdminSigner(key); err != nil {
+				return err
+			}
+		}
+		definitionID := definition.PresentationDefinition.ID
+		if otherKey, ok := definitionKeys[definitionID]; ok {
+			return errors.Errorf("presentation definition ID %s is used by both <%s> and <%s>", definitionID, otherKey, key)
+		}
+		definitionKeys[definitionID] = key
+		for _, id := range definition.PresentationDefinition.InputDescriptors {
+			inputDescriptorIDs[id.ID] = true
+		}
+	}
+
+	if c.ClockSkew < 0 {
+		return errors.Errorf("clock skew<%s> is negative", c.ClockSkew)
+	}
+	if c.MaxPresentationAge < 0 {
+		return errors.Errorf("max presentation age<%s> is negative", c.MaxPresentationAge)
 	}
-	for id, ch := range c.CustomHandlers {
-		if id != ch.InputDescriptorID {
-			return errors.Errorf("mismatched input descriptor ID, expected: %s, got %s", id, ch.InputDescriptorID)
+	if c.HandlerParallelism < 0 {
+		return errors.Errorf("handler parallelism<%d> is negative", c.HandlerParallelism)
+	}
+	if c.AdminSigner != nil && c.AdminSigner.ID != c.AdminDID {
+		return errors.Errorf("admin signer<%s> is not the admin DID<%s>", c.AdminSigner.ID, c.AdminDID)
+	}
+	if err := c.PresentationKeyRelationship.IsValid(); err != nil {
+		return errors.Wrap(err, "invalid presentation key relationship")
+	}
+	if err := c.HolderBinding.IsValid(); err != nil {
+		return errors.Wrap(err, "invalid holder binding")
+	}
+
+	// make sure input descriptor of each trusted issuer exists
+	for id := range c.TrustedIssuers {
+		if _, ok := inputDescriptorIDs[id]; !ok {
+			return errors.Errorf("trusted issuers input descriptor ID %s not found in presentation definition", id)
 		}
+	}
+	if err := c.TrustedIssuers.IsValid(); err != nil {
+		return errors.Wrap(err, "invalid trusted issuers")
+	}
+
+	// make sure input descriptor of each claim mapping exists
+	for id := range c.ClaimMappings {
 		if _, ok := inputDescriptorIDs[id]; !ok {
-			return errors.Errorf("input descriptor ID %s not found in presentation definition", id)
+			return errors.Errorf("claim mappings input descriptor ID %s not found in presentation definition", id)
+		}
+	}
+	if err := c.ClaimMappings.IsValid(); err != nil {
+		return errors.Wrap(err, "invalid claim mappings")
+	}
+
+	if c.AccessToken != nil {
+		if checkAdminSigner && c.AdminSigner == nil {
+			return errors.New("access tokens require an admin signer")
+		}
+		if err := c.AccessToken.IsValid(); err != nil {
+			return errors.Wrap(err, "invalid access token config")
+		}
+		for name, selector := range c.AccessToken.Claims {
+			if _, ok := inputDescriptorIDs[selector.InputDescriptorID]; !ok {
+				return errors.Errorf("access token claim<%s> input descriptor ID %s not found in presentation definition", name, selector.InputDescriptorID)
+			}
+		}
+	}
+	return nil
+}
+
+// checkSupportedFeatures makes sure the presentation definition does not use Presentation Exchange features the
+// gate cannot yet evaluate https://identity.foundation/presentation-exchange/#features
+func checkSupportedFeatures(def exchange.PresentationDefinition) error {
+	for _, id := range def.InputDescriptors {
+		if id.Constraints == nil {
+			continue
 		}
-		if err := util.IsValidStruct(ch); err != nil {
-			return errors.Wrap(err, "invalid custom handler")
+		for _, field := range id.Constraints.Fields {
+			if field.Predicate != nil {
+				return errors.New("predicate feature not supported")
+			}
+		}
+		if id.Constraints.IsHolder != nil || id.Constraints.SameSubject != nil {
+			return errors.New("relational constraint feature not supported")
+		}
+		if id.Constraints.Statuses != nil {
+			return errors.New("credential status constraint feature not supported")
 		}
 	}
+	if def.Frame != nil {
+		return errors.New("JSON-LD framing feature not supported")
+	}
 	return nil
 }
 
 type CredentialGate struct {
-	resolver *resolver.Resolver
-	config   CredentialGateConfig
+	resolver          *resolver.Resolver
+	config            CredentialGateConfig
+	nonceStore        NonceStore
+	replayStore       ReplayStore
+	statusListFetcher StatusListFetcher
+	trustRegistry     TrustRegistry
+	documentLoader    documentLoader
 }
 
 // NewCredentialGate creates a new CredentialGate instance using the given config
@@ -75,80 +268,306 @@ func NewCredentialGate(config CredentialGateConfig) (*CredentialGate, error) {
 		return nil, util.LoggingErrorMsg(err, "invalid config")
 	}
 
-	r, err := resolver.NewResolver(localResolverMethods(), config.UniversalResolverURL)
+	// the resolver only resolves DIDs of supported methods, whoever the DID belongs to: the submitter, an issuer, a
+	// credential subject checked for holder binding, or the issuer of a status list
+	r, err := resolver.NewResolver(localResolverMethods(config.SupportedDIDMethods), config.UniversalResolverURL,
+		resolver.WithAllowedMethods(config.SupportedDIDMethods...))
 	if err != nil {
 		return nil, util.LoggingErrorMsg(err, "failed to create resolver")
 	}
 
+	loader, err := newDocumentLoader(config.JSONLDContexts)
+	if err != nil {
+		return nil, util.LoggingErrorMsg(err, "failed to create JSON-LD document loader")
+	}
+
+	// the referenced handlers are created last, once nothing else can fail, and are closed with the gate
+	config, err = config.withRegisteredHandlers(context.Background())
+	if err != nil {
+		return nil, util.LoggingErrorMsg(err, "invalid config")
+	}
+
+	nonceStore := config.NonceStore
+	if nonceStore == nil {
+		nonceStore = NewMemoryStore(0)
+	}
+	replayStore := config.ReplayStore
+	if replayStore == nil {
+		replayStore = NewMemoryStore(0)
+	}
+	statusListFetcher := config.StatusListFetcher
+	if statusListFetcher == nil {
+		statusListFetcher = HTTPStatusListFetcher{}
+	}
+	var trustRegistry TrustRegistry = config.TrustedIssuers
+	if config.TrustRegistry != nil {
+		trustRegistry = config.TrustRegistry
+	}
+
 	return &CredentialGate{
-		resolver: r,
-		config:   config,
+		resolver:          r,
+		config:            config,
+		nonceStore:        nonceStore,
+		replayStore:       replayStore,
+		statusListFetcher: statusListFetcher,
+		trustRegistry:     trustRegistry,
+		documentLoader:    loader,
 	}, nil
 }
 
-func localResolverMethods() []didsdk.Method {
-	return []didsdk.Method{didsdk.KeyMethod, didsdk.WebMethod, didsdk.PKHMethod, didsdk.PeerMethod}
+// Close closes the custom handlers of the gate which hold resources, such as WebAssembly handlers. The gate must not
+// be used once closed.
+func (cg *CredentialGate) Close(ctx context.Context) error {
+	var firstErr error
+	for _, definition := range cg.config.definitions() {
+		if err := closeHandlers(ctx, definition.CustomHandlers); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// localResolverMethods returns the methods to resolve locally: the supported methods which have a local
+// resolver, or a default set of methods if all methods are supported
+func localResolverMethods(supportedMethods []didsdk.Method) []didsdk.Method {
+	if len(supportedMethods) == 0 {
+		return []didsdk.Method{didsdk.KeyMethod, didsdk.WebMethod, didsdk.PKHMethod, didsdk.PeerMethod}
+	}
+	var methods []didsdk.Method
+	for _, method := range supportedMethods {
+		if resolver.IsLocalMethod(method) {
+			methods = append(methods, method)
+		}
+	}
+	return methods
 }
 
 type Result struct {
-	Valid        bool   `json:"valid,omitempty"`
-	SubmissionID string `json:"submissionId,omitempty"`
-	Submitter    string `json:"submitter,omitempty"`
-	Reason       string `json:"reason,omitempty"`
+	Valid        bool    `json:"valid,omitempty"`
+	SubmissionID string  `json:"submissionId,omitempty"`
+	Submitter    string  `json:"submitter,omitempty"`
+	Reason       *Reason `json:"reason,omitempty"`
+
+	// DefinitionID is the ID of the presentation definition the submission was validated against, once selected
+	DefinitionID string `json:"definitionId,omitempty"`
+
+	// Attributes are the claims of the submitted credentials mapped by ClaimMappings, set if the submission is valid
+	Attributes Attributes `json:"attributes,omitempty"`
+
+	// AccessToken is the access token issued to the submitter, if the gate is configured to issue them and the
+	// submission is valid
+	AccessToken string `json:"accessToken,omitempty"`
+
+	// Trace is a record of how the submission was evaluated, set if validation was run WithTrace
+	Trace *Trace `json:"trace,omitempty"`
 }
 
-func (cg *CredentialGate) ValidatePresentationSubmission(ctx context.Context, presentationSubmissionJWT string) (*Result, error) {
-	// extract the VP signer's DID, which is set as the iss property as per https://w3c.github.io/vc-jwt/#vp-jwt-1.1
-	headers, token, vp, err := credential.ParseVerifiablePresentationFromJWT(presentationSubmissionJWT)
-	if err != nil {
-		return &Result{Valid: false}, util.LoggingErrorMsg(err, "parsing VP from JWT")
+// ValidatePresentationSubmission validates a presentation submission in a VP JWT against one of the gate's
+// presentation definitions and its custom handlers. Unless one is selected WithDefinition, the submission chooses
+// the definition it is validated against, which the caller must check with the DefinitionID of the result.
+func (cg *CredentialGate) ValidatePresentationSubmission(ctx context.Context, presentationSubmissionJWT string, opts ...ValidateOption) (*Result, error) {
+	return cg.validate(ctx, func() (*presentation, error) { return parsePresentationJWT(presentationSubmissionJWT) }, opts...)
+}
+
+// ValidatePresentation validates a presentation submission in either a VP JWT or a JSON-LD VP secured with a
+// Data Integrity proof, detecting the envelope from the submission, against one of the gate's presentation
+// definitions and its custom handlers. As with ValidatePresentationSubmission, the caller must select the
+// definition WithDefinition, or check the DefinitionID of the result.
+func (cg *CredentialGate) ValidatePresentation(ctx context.Context, submission []byte, opts ...ValidateOption) (*Result, error) {
+	return cg.validate(ctx, func() (*presentation, error) { return parsePresentation(submission) }, opts...)
+}
+
+func (cg *CredentialGate) validate(ctx context.Context, parse func() (*presentation, error), opts ...ValidateOption) (*Result, error) {
+	var options validateOptions
+	for _, opt := range opts {
+		opt(&options)
 	}
-	issuer := token.Issuer()
-	id := token.JwtID()
-	gateResult := &Result{Valid: false, SubmissionID: id, Submitter: issuer}
-	if vp.PresentationSubmission == nil {
-		// TODO(gabe): in-place build a presentation submission from the VP https://github.com/TBD54566975/credential-gate/issues/5
-		return gateResult, util.LoggingErrorMsg(err, "no presentation submission found in VP")
+	var trace *Trace
+	if options.trace {
+		trace = new(Trace)
+		ctx = withTrace(ctx, trace)
 	}
 
-	maybeKID, ok := headers.Get(jws.KeyIDKey)
-	if !ok {
-		return gateResult, util.LoggingErrorMsg(err, "getting kid from VP JWT")
+	start := time.Now()
+	p, err := parse()
+	trace.addStep("parse", start, err)
+	if err != nil {
+		return deny(&Result{Valid: false, Trace: trace}, newDenial(ReasonInvalidSubmission, err), "parsing presentation submission")
 	}
-	kid, ok := maybeKID.(string)
-	if !ok {
-		return gateResult, util.LoggingErrorMsg(err, "casting kid to string")
+	issuer := p.submitter
+	vp := p.vp
+	gateResult := &Result{Valid: false, SubmissionID: p.id, Submitter: issuer, Trace: trace}
+
+	// make sure the submitter and the issuers of each credential use supported DID methods
+	start = time.Now()
+	err = cg.checkDIDMethods(issuer, *vp)
+	trace.addStep("checkDIDMethods", start, err)
+	if err != nil {
+		return deny(gateResult, err, "checking DID methods")
 	}
 
-	// resolve the VP signer's DID
-	resolved, err := cg.resolver.Resolve(ctx, issuer)
+	// verify the VP signer's signature, then the signature of each credential in the VP
+	// the admin DID must be the audience, or domain, of the VP
+	start = time.Now()
+	err = cg.verifyPresentation(ctx, p)
+	trace.addStep("verifyPresentation", start, err)
 	if err != nil {
-		return gateResult, util.LoggingErrorMsg(err, "resolving VP submission signer's DID")
+		return deny(gateResult, err, "verifying presentation")
 	}
-	pubKey, err := didsdk.GetKeyFromVerificationMethod(resolved.Document, kid)
+	start = time.Now()
+	err = cg.verifyCredentials(ctx, *vp)
+	trace.addStep("verifyCredentials", start, err)
 	if err != nil {
-		return gateResult, util.LoggingErrorMsg(err, "getting public key from VP signer's DID")
+		return deny(gateResult, err, "verifying presentation credentials")
 	}
 
 	// verify the presentation submission and extract the submission data
-	// the admin DID is set as the audience for the verifier
-	verifier, err := jwx.NewJWXVerifier(cg.config.AdminDID, kid, pubKey)
+	start = time.Now()
+	definition, verifiedSubmissionData, err := cg.verifySubmission(ctx, options.definition, vp)
+	var submitted []submittedCredential
+	if err == nil {
+		submitted, err = getSubmittedCredentials(*vp)
+	}
+	trace.addStep("verifySubmission", start, err)
+	if definition != nil {
+		gateResult.DefinitionID = definition.PresentationDefinition.ID
+	}
+	if err != nil {
+		return deny(gateResult, err, "verifying presentation submission")
+	}
+
+	// make sure the submitter is the holder of each credential, then that each credential was issued by an
+	// issuer trusted for its input descriptor
+	start = time.Now()
+	err = cg.checkHolderBinding(ctx, issuer, submitted)
+	trace.addStep("checkHolderBinding", start, err)
+	if err != nil {
+		return deny(gateResult, err, "checking holder binding")
+	}
+	start = time.Now()
+	err = cg.checkTrustedIssuers(ctx, submitted)
+	trace.addStep("checkTrustedIssuers", start, err)
+	if err != nil {
+		return deny(gateResult, err, "checking trusted issuers")
+	}
+
+	// make sure none of the submitted credentials have been revoked or suspended
+	start = time.Now()
+	err = cg.checkCredentialStatus(ctx, submitted)
+	trace.addStep("checkCredentialStatus", start, err)
 	if err != nil {
-		return gateResult, util.LoggingErrorMsg(err, "constructing JWT verifier")
+		return deny(gateResult, err, "checking credential status")
 	}
-	verifiedSubmissionData, err := exchange.VerifyPresentationSubmission(ctx, *verifier, cg.resolver, exchange.JWTVPTarget, cg.config.PresentationDefinition,
-		[]byte(presentationSubmissionJWT))
+
+	// map the claims of the credentials to attributes
+	start = time.Now()
+	attributes, err := mapClaims(cg.config.ClaimMappings, submitted)
+	trace.addStep("mapClaims", start, err)
+	if err != nil {
+		return deny(gateResult, err, "mapping claims")
+	}
+
+	// validate the presentation submission with custom handlers, which can see the mapped attributes
+	// a handler rejecting the submission is a denial, not an error
+	start = time.Now()
+	handlerCtx := withClock(withAttributes(withAdminSigner(ctx, cg.config.AdminSigner), attributes), cg.validityClock())
+	err = cg.applyCustomHandlers(handlerCtx, *definition, verifiedSubmissionData)
+	trace.addStep("applyCustomHandlers", start, err)
 	if err != nil {
-		gateResult.Reason = err.Error()
-		return gateResult, util.LoggingErrorMsg(err, "verifying presentation submission")
+		if reason := getReason(err); reason.Code == ReasonHandlerRejected {
+			gateResult.Reason = &reason
+			return gateResult, nil
+		}
+		return deny(gateResult, err, "applying custom handlers")
 	}
 
-	// validate the presentation submission with custom handlers
-	handled, err := cg.applyCustomHandlers(ctx, verifiedSubmissionData)
+	// make sure the submission is fresh: it must answer a challenge, if required, and must not be a replay
+	// the challenge and ID are consumed only once every other check has passed, since checking status and applying
+	// custom handlers can fail for reasons a retry of the same submission may not
+	start = time.Now()
+	err = cg.checkChallenge(ctx, p)
+	trace.addStep("checkChallenge", start, err)
+	if err != nil {
+		return deny(gateResult, err, "checking challenge")
+	}
+	start = time.Now()
+	err = cg.checkReplay(ctx, p)
+	trace.addStep("checkReplay", start, err)
 	if err != nil {
-		gateResult.Reason = err.Error()
-		return gateResult, util.LoggingErrorMsg(err, "applying custom handlers")
+		return deny(gateResult, err, "checking for replayed submission")
+	}
+
+	// grant access, issuing an access token if configured to
+	if cg.config.AccessToken != nil {
+		start = time.Now()
+		gateResult.AccessToken, err = cg.grant(issuer, definition.PresentationDefinition.ID, attributes, submitted)
+		trace.addStep("grant", start, err)
+		if err != nil {
+			return deny(gateResult, err, "issuing access token")
+		}
+	}
+	gateResult.Valid = true
+	if len(attributes) > 0 {
+		gateResult.Attributes = attributes
 	}
-	gateResult.Valid = handled
 	return gateResult, nil
 }
+
+// deny sets the reason carried by the error on the result, and returns the logged error
+func deny(result *Result, err error, msg string) (*Result, error) {
+	reason := getReason(err)
+	result.Valid = false
+	result.Reason = &reason
+	return result, util.LoggingErrorMsg(err, msg)
+}
+
+// checkDIDMethods makes sure the VP signer's DID and the DIDs of the issuers of each credential in the
+// VP are of a supported DID method
+func (cg *CredentialGate) checkDIDMethods(submitter string, vp credential.VerifiablePresentation) error {
+	if len(cg.config.SupportedDIDMethods) == 0 {
+		return nil
+	}
+	if err := cg.checkDIDMethod(submitter); err != nil {
+		return newDenial(ReasonDIDMethodUnsupported, errors.Wrap(err, "presentation submission signer"))
+	}
+	for i, vc := range vp.VerifiableCredential {
+		cred, err := toCredential(vc)
+		if err != nil {
+			return newDenial(ReasonInvalidSubmission, errors.Wrapf(err, "parsing credential %d", i))
+		}
+		credIssuer, err := getCredentialIssuer(*cred)
+		if err != nil {
+			return newDenial(ReasonInvalidSubmission, errors.Wrapf(err, "credential %d", i))
+		}
+		if err = cg.checkDIDMethod(credIssuer); err != nil {
+			return newDenial(ReasonDIDMethodUnsupported, errors.Wrapf(err, "credential %d issuer", i))
+		}
+	}
+	return nil
+}
+
+func (cg *CredentialGate) checkDIDMethod(did string) error {
+	method, err := resolver.GetMethodForDID(did)
+	if err != nil {
+		return err
+	}
+	for _, m := range cg.config.SupportedDIDMethods {
+		if m == method {
+			return nil
+		}
+	}
+	return errors.Errorf("DID method %s of %s is not supported", method, did)
+}
+
+// getCredentialIssuer returns the issuer of a credential, which is either a string or an object with an id
+func getCredentialIssuer(cred credential.VerifiableCredential) (string, error) {
+	switch issuer := cred.Issuer.(type) {
+	case string:
+		return issuer, nil
+	case map[string]any:
+		if id, ok := issuer["id"].(string); ok {
+			return id, nil
+		}
+	}
+	return "", errors.New("credential has no issuer")
+}
@@ -2,6 +2,7 @@ package gate
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"testing"
 	"time"
@@ -10,11 +11,17 @@ import (
 	"github.com/TBD54566975/ssi-sdk/credential/exchange"
 	"github.com/TBD54566975/ssi-sdk/crypto"
 	"github.com/TBD54566975/ssi-sdk/crypto/jwx"
+	didsdk "github.com/TBD54566975/ssi-sdk/did"
+	"github.com/TBD54566975/ssi-sdk/did/jwk"
 	"github.com/TBD54566975/ssi-sdk/did/key"
 	"github.com/TBD54566975/ssi-sdk/schema"
 	"github.com/TBD54566975/ssi-sdk/util"
 	"github.com/google/uuid"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"gopkg.in/h2non/gock.v1"
 )
 
@@ -251,3 +258,194 @@ func TestCredentialGate(t *testing.T) {
 		assert.True(tt, result.Valid)
 	})
 }
+
+func TestSupportedDIDMethods(t *testing.T) {
+	requesterID := "did:test:admin"
+	presentationDefinition := exchange.PresentationDefinition{
+		ID: uuid.New().String(),
+		InputDescriptors: []exchange.InputDescriptor{
+			{
+				ID: uuid.New().String(),
+				Constraints: &exchange.Constraints{
+					Fields: []exchange.Field{
+						{
+							Path: []string{"$.vc.credentialSubject.name"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	// the submitter is a did:key, and the issuer a did:jwk
+	submitter := newTestSigner(t)
+	issuerKey, issuerDID, err := jwk.GenerateDIDJWK(crypto.Ed25519)
+	require.NoError(t, err)
+	expandedIssuer, err := issuerDID.Expand()
+	require.NoError(t, err)
+	issuer, err := jwx.NewJWXSigner(issuerDID.String(), expandedIssuer.VerificationMethod[0].ID, issuerKey)
+	require.NoError(t, err)
+
+	testCredential := credential.VerifiableCredential{
+		Context:      []any{"https://www.w3.org/2018/credentials/v1"},
+		Type:         []string{"VerifiableCredential"},
+		Issuer:       issuer.ID,
+		IssuanceDate: time.Now().Format(time.RFC3339),
+		CredentialSubject: map[string]any{
+			"id":   submitter.ID,
+			"name": "Satoshi",
+		},
+	}
+	testVCJWT, err := credential.SignVerifiableCredentialJWT(*issuer, testCredential)
+	require.NoError(t, err)
+	submissionJWT := buildTestSubmissionJWT(t, submitter, requesterID, presentationDefinition, [][]byte{testVCJWT}, nil)
+
+	t.Run("all methods supported", func(tt *testing.T) {
+		gate, err := NewCredentialGate(CredentialGateConfig{
+			AdminDID:               requesterID,
+			PresentationDefinition: presentationDefinition,
+			SupportedDIDMethods:    []didsdk.Method{didsdk.KeyMethod, didsdk.JWKMethod},
+		})
+		assert.NoError(tt, err)
+
+		result, err := gate.ValidatePresentationSubmission(context.Background(), submissionJWT)
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+	})
+
+	t.Run("unsupported submitter method", func(tt *testing.T) {
+		gate, err := NewCredentialGate(CredentialGateConfig{
+			AdminDID:               requesterID,
+			PresentationDefinition: presentationDefinition,
+			SupportedDIDMethods:    []didsdk.Method{didsdk.WebMethod, didsdk.JWKMethod},
+		})
+		assert.NoError(tt, err)
+
+		result, err := gate.ValidatePresentationSubmission(context.Background(), submissionJWT)
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "presentation submission signer: DID method key")
+		assert.False(tt, result.Valid)
+	})
+
+	t.Run("unsupported issuer method", func(tt *testing.T) {
+		gate, err := NewCredentialGate(CredentialGateConfig{
+			AdminDID:               requesterID,
+			PresentationDefinition: presentationDefinition,
+			SupportedDIDMethods:    []didsdk.Method{didsdk.KeyMethod, didsdk.WebMethod},
+		})
+		assert.NoError(tt, err)
+
+		result, err := gate.ValidatePresentationSubmission(context.Background(), submissionJWT)
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "credential 0 issuer: DID method jwk")
+		assert.False(tt, result.Valid)
+	})
+
+	t.Run("unsupported methods never resolved", func(tt *testing.T) {
+		gate, err := NewCredentialGate(CredentialGateConfig{
+			AdminDID:               requesterID,
+			PresentationDefinition: presentationDefinition,
+			SupportedDIDMethods:    []didsdk.Method{didsdk.KeyMethod},
+		})
+		require.NoError(tt, err)
+
+		// DIDs resolved other than as the submitter or an issuer, such as the issuer of a status list, are of a
+		// supported method too
+		_, err = getVerificationKey(context.Background(), gate.resolver, issuer.ID, issuer.KID, "")
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonDIDMethodUnsupported, getReason(err).Code)
+
+		_, err = gate.isControlledBy(context.Background(), issuer.ID, submitter.ID)
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "DID method not allowed")
+
+		_, err = getVerificationKey(context.Background(), gate.resolver, submitter.ID, submitter.KID, "")
+		assert.NoError(tt, err)
+	})
+
+	t.Run("no resolvable methods", func(tt *testing.T) {
+		_, err := NewCredentialGate(CredentialGateConfig{
+			AdminDID:               requesterID,
+			PresentationDefinition: presentationDefinition,
+			SupportedDIDMethods:    []didsdk.Method{didsdk.IONMethod},
+		})
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "failed to create resolver")
+	})
+}
+
+// newTestSigner generates a did:key and returns a JWT signer for its first verification method
+func newTestSigner(t *testing.T) jwx.Signer {
+	privKey, didKey, err := key.GenerateDIDKey(crypto.Ed25519)
+	require.NoError(t, err)
+	expanded, err := didKey.Expand()
+	require.NoError(t, err)
+	signer, err := jwx.NewJWXSigner(didKey.String(), expanded.VerificationMethod[0].ID, privKey)
+	require.NoError(t, err)
+	return *signer
+}
+
+// buildTestSubmissionJWT builds a VP JWT presentation submission in which the credential at each index
+// fulfills the input descriptor at the same index of the definition. Any extra claims are set on the JWT,
+// which allows tests to control properties such as the nonce and jti.
+func buildTestSubmissionJWT(t *testing.T, signer jwx.Signer, audience string, def exchange.PresentationDefinition, vcJWTs [][]byte, claims map[string]any) string {
+	submission := exchange.PresentationSubmission{
+		ID:           uuid.NewString(),
+		DefinitionID: def.ID,
+	}
+	for i := range vcJWTs {
+		submission.DescriptorMap = append(submission.DescriptorMap, exchange.SubmissionDescriptor{
+			ID:     def.InputDescriptors[i].ID,
+			Format: exchange.JWTVC.String(),
+			Path:   fmt.Sprintf("$.verifiableCredential[%d]", i),
+		})
+	}
+	return buildTestPresentationJWT(t, signer, audience, &submission, vcJWTs, claims)
+}
+
+// buildTestPresentationJWT builds a VP JWT containing the given credentials and, if not nil, the given
+// presentation submission. Any extra claims are set on the JWT.
+func buildTestPresentationJWT(t *testing.T, signer jwx.Signer, audience string, submission *exchange.PresentationSubmission, vcJWTs [][]byte, claims map[string]any) string {
+	builder := credential.NewVerifiablePresentationBuilder()
+	require.NoError(t, builder.AddContext(exchange.PresentationSubmissionContext))
+	require.NoError(t, builder.AddType(exchange.PresentationSubmissionType))
+	for _, vcJWT := range vcJWTs {
+		require.NoError(t, builder.AddVerifiableCredentials(string(vcJWT)))
+	}
+	if submission != nil {
+		require.NoError(t, builder.SetPresentationSubmission(*submission))
+	}
+	vp, err := builder.Build()
+	require.NoError(t, err)
+
+	token := jwt.New()
+	require.NoError(t, token.Set(jwt.IssuerKey, signer.ID))
+	require.NoError(t, token.Set(jwt.AudienceKey, []string{audience}))
+	require.NoError(t, token.Set(jwt.IssuedAtKey, time.Now().Unix()))
+	require.NoError(t, token.Set(credential.VPJWTProperty, vp))
+	for k, v := range claims {
+		require.NoError(t, token.Set(k, v))
+	}
+	headers := jws.NewHeaders()
+	require.NoError(t, headers.Set(jws.KeyIDKey, signer.KID))
+	signed, err := jwt.Sign(token, jwt.WithKey(jwa.SignatureAlgorithm(signer.ALG), signer.PrivateKey, jws.WithProtectedHeaders(headers)))
+	require.NoError(t, err)
+	return string(signed)
+}
+
+// signTestPresentationJWT signs a VP given as JSON in a VP JWT, so tests can submit VPs the SDK's builder would not
+// build, setting the contexts and types of a VP with a presentation submission
+func signTestPresentationJWT(t *testing.T, signer jwx.Signer, audience string, vp map[string]any) string {
+	vp["@context"] = []any{"https://www.w3.org/2018/credentials/v1", exchange.PresentationSubmissionContext}
+	vp["type"] = []any{"VerifiablePresentation", exchange.PresentationSubmissionType}
+	token := jwt.New()
+	require.NoError(t, token.Set(jwt.IssuerKey, signer.ID))
+	require.NoError(t, token.Set(jwt.AudienceKey, []string{audience}))
+	require.NoError(t, token.Set(jwt.IssuedAtKey, time.Now().Unix()))
+	require.NoError(t, token.Set(credential.VPJWTProperty, vp))
+	headers := jws.NewHeaders()
+	require.NoError(t, headers.Set(jws.KeyIDKey, signer.KID))
+	signed, err := jwt.Sign(token, jwt.WithKey(jwa.SignatureAlgorithm(signer.ALG), signer.PrivateKey, jws.WithProtectedHeaders(headers)))
+	require.NoError(t, err)
+	return string(signed)
+}
@@ -0,0 +1,225 @@
+package gate
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/TBD54566975/ssi-sdk/crypto/jwx"
+	"github.com/google/uuid"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/pkg/errors"
+)
+
+const (
+	// AccessTokenType is the typ header of access tokens issued by the gate https://www.rfc-editor.org/rfc/rfc9068
+	AccessTokenType = "at+jwt"
+
+	defaultAccessTokenTTL = 5 * time.Minute
+
+	definitionIDClaim = "definition_id"
+	scopeClaim        = "scope"
+	verifiedClaims    = "claims"
+)
+
+// AccessTokenConfig configures the access token, a JWT signed by the admin DID, which the gate issues when it
+// grants access, so services can rely on the outcome of validation without validating the submission again
+type AccessTokenConfig struct {
+	// TTL is how long an issued access token is valid for
+	// If empty, access tokens are valid for five minutes
+	TTL time.Duration `json:"ttl,omitempty"`
+
+	// Audience is the audience of issued access tokens
+	// If empty, access tokens are addressed to the admin DID
+	Audience []string `json:"audience,omitempty"`
+
+	// Scopes are the scopes granted by a submission, by the ID of the presentation definition it fulfills
+	Scopes map[string][]string `json:"scopes,omitempty"`
+
+	// Claims are the verified claims copied into issued access tokens, by the name they are given in the token
+	Claims map[string]ClaimSelector `json:"claims,omitempty"`
+
+	// Attributes copies the attributes mapped by the gate's ClaimMappings into the claims of issued access tokens,
+	// where a claim selected by Claims takes precedence over an attribute of the same name
+	Attributes bool `json:"attributes,omitempty"`
+}
+
+// ClaimSelector selects a claim from the credentials submitted for an input descriptor
+type ClaimSelector struct {
+	InputDescriptorID string `json:"inputDescriptorId"`
+
+	// Path is a JSONPath into the credential, in the VC data model, such as $.credentialSubject.email, or into the
+	// disclosed claims of an SD-JWT credential, such as $.email
+	Path string `json:"path"`
+}
+
+// IsValid checks the access token's TTL is not negative and that each of its claims has a selector
+func (c AccessTokenConfig) IsValid() error {
+	if c.TTL < 0 {
+		return errors.Errorf("ttl<%s> is negative", c.TTL)
+	}
+	for name, selector := range c.Claims {
+		if selector.InputDescriptorID == "" || selector.Path == "" {
+			return errors.Errorf("claim<%s> requires an input descriptor ID and a path", name)
+		}
+	}
+	return nil
+}
+
+// AccessToken is a verified access token issued by the gate
+type AccessToken struct {
+	ID           string         `json:"id"`
+	Issuer       string         `json:"issuer"`
+	Subject      string         `json:"subject"`
+	Audience     []string       `json:"audience"`
+	DefinitionID string         `json:"definitionId"`
+	Scopes       []string       `json:"scopes,omitempty"`
+	Claims       map[string]any `json:"claims,omitempty"`
+	IssuedAt     time.Time      `json:"issuedAt"`
+	ExpiresAt    time.Time      `json:"expiresAt"`
+}
+
+// grant issues an access token to the submitter of a valid submission, carrying the scopes of the presentation
+// definition it fulfills and the claims selected from its submitted credentials, along with its attributes if
+// configured to
+func (cg *CredentialGate) grant(submitter, definitionID string, attributes Attributes, submitted []submittedCredential) (string, error) {
+	config := cg.config.AccessToken
+	signer := cg.config.AdminSigner
+	now := cg.validityClock().now()
+	ttl := config.TTL
+	if ttl == 0 {
+		ttl = defaultAccessTokenTTL
+	}
+
+	token := jwt.New()
+	values := map[string]any{
+		jwt.JwtIDKey:      uuid.NewString(),
+		jwt.IssuerKey:     cg.config.AdminDID,
+		jwt.SubjectKey:    submitter,
+		jwt.AudienceKey:   cg.accessTokenAudience(),
+		jwt.IssuedAtKey:   now.Unix(),
+		jwt.NotBeforeKey:  now.Unix(),
+		jwt.ExpirationKey: now.Add(ttl).Unix(),
+		definitionIDClaim: definitionID,
+	}
+	if scopes := config.Scopes[definitionID]; len(scopes) > 0 {
+		values[scopeClaim] = strings.Join(scopes, " ")
+	}
+	claims := make(map[string]any)
+	if config.Attributes {
+		for name, value := range attributes {
+			claims[name] = value
+		}
+	}
+	for name, value := range selectClaims(config.Claims, submitted) {
+		claims[name] = value
+	}
+	if len(claims) > 0 {
+		values[verifiedClaims] = claims
+	}
+	for k, v := range values {
+		if err := token.Set(k, v); err != nil {
+			return "", errors.Wrapf(err, "setting access token claim<%s>", k)
+		}
+	}
+
+	headers := jws.NewHeaders()
+	if err := headers.Set(jws.KeyIDKey, signer.KID); err != nil {
+		return "", errors.Wrap(err, "setting key ID header")
+	}
+	if err := headers.Set(jws.TypeKey, AccessTokenType); err != nil {
+		return "", errors.Wrap(err, "setting type header")
+	}
+	signed, err := jwt.Sign(token, jwt.WithKey(jwa.SignatureAlgorithm(signer.ALG), signer.PrivateKey, jws.WithProtectedHeaders(headers)))
+	if err != nil {
+		return "", errors.Wrap(err, "signing access token")
+	}
+	return string(signed), nil
+}
+
+// selectClaims returns the value of each selected claim found in the credentials submitted for its input
+// descriptor, taken from the first credential it is found in
+func selectClaims(selectors map[string]ClaimSelector, submitted []submittedCredential) map[string]any {
+	claims := make(map[string]any)
+	for name, selector := range selectors {
+		var credentials []map[string]any
+		for _, sc := range submitted {
+			if sc.inputDescriptorID != selector.InputDescriptorID {
+				continue
+			}
+			if cred, err := sc.claims(); err == nil {
+				credentials = append(credentials, cred)
+			}
+		}
+		if value := lookupClaim(credentials, selector.Path); value != nil {
+			claims[name] = value
+		}
+	}
+	return claims
+}
+
+func (cg *CredentialGate) accessTokenAudience() []string {
+	if len(cg.config.AccessToken.Audience) > 0 {
+		return cg.config.AccessToken.Audience
+	}
+	return []string{cg.config.AdminDID}
+}
+
+// VerifyAccessToken verifies an access token was issued by the gate, is addressed to the given audience, or to the
+// admin DID if the audience is empty, and is currently valid, returning its contents
+func (cg *CredentialGate) VerifyAccessToken(_ context.Context, accessToken, audience string) (*AccessToken, error) {
+	if cg.config.AccessToken == nil || cg.config.AdminSigner == nil {
+		return nil, errors.New("gate does not issue access tokens")
+	}
+	if audience == "" {
+		audience = cg.config.AdminDID
+	}
+	signer := cg.config.AdminSigner
+	publicKey, err := jwk.PublicKeyOf(signer.PrivateKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting admin public key")
+	}
+	// the token is validated against the gate's clock once its signature is verified
+	token, err := jwt.Parse([]byte(accessToken), jwt.WithKey(jwa.SignatureAlgorithm(signer.ALG), publicKey), jwt.WithValidate(false))
+	if err != nil {
+		return nil, errors.Wrap(err, "verifying access token")
+	}
+	headers, err := jwx.GetJWSHeaders([]byte(accessToken))
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing access token headers")
+	}
+	if headers.Type() != AccessTokenType {
+		return nil, errors.Errorf("token type<%s> is not %s", headers.Type(), AccessTokenType)
+	}
+	clock := cg.validityClock()
+	if err = jwt.Validate(token, jwt.WithClock(jwt.ClockFunc(clock.now)), jwt.WithAcceptableSkew(clock.skew),
+		jwt.WithIssuer(cg.config.AdminDID), jwt.WithAudience(audience), jwt.WithRequiredClaim(jwt.ExpirationKey)); err != nil {
+		return nil, errors.Wrap(err, "validating access token")
+	}
+	return toAccessToken(token), nil
+}
+
+// toAccessToken returns the contents of a verified access token
+func toAccessToken(token jwt.Token) *AccessToken {
+	accessToken := &AccessToken{
+		ID:        token.JwtID(),
+		Issuer:    token.Issuer(),
+		Subject:   token.Subject(),
+		Audience:  token.Audience(),
+		IssuedAt:  token.IssuedAt(),
+		ExpiresAt: token.Expiration(),
+	}
+	if definitionID, ok := token.PrivateClaims()[definitionIDClaim].(string); ok {
+		accessToken.DefinitionID = definitionID
+	}
+	if scope, ok := token.PrivateClaims()[scopeClaim].(string); ok && scope != "" {
+		accessToken.Scopes = strings.Split(scope, " ")
+	}
+	if claims, ok := token.PrivateClaims()[verifiedClaims].(map[string]any); ok {
+		accessToken.Claims = claims
+	}
+	return accessToken
+}
@@ -0,0 +1,192 @@
+package gate
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/TBD54566975/ssi-sdk/credential"
+	"github.com/TBD54566975/ssi-sdk/credential/exchange"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessToken(t *testing.T) {
+	admin := newTestSigner(t)
+	def := exchange.PresentationDefinition{
+		ID: "email-definition",
+		InputDescriptors: []exchange.InputDescriptor{{
+			ID:          "email",
+			Constraints: &exchange.Constraints{Fields: []exchange.Field{{Path: []string{"$.vc.credentialSubject.email"}}}},
+		}},
+	}
+	config := CredentialGateConfig{
+		AdminDID:               admin.ID,
+		AdminSigner:            &admin,
+		PresentationDefinition: def,
+		AccessToken: &AccessTokenConfig{
+			TTL:    time.Minute,
+			Scopes: map[string][]string{def.ID: {"profile:read", "profile:write"}},
+			Claims: map[string]ClaimSelector{
+				"email":   {InputDescriptorID: "email", Path: "$.credentialSubject.email"},
+				"missing": {InputDescriptorID: "email", Path: "$.credentialSubject.phone"},
+			},
+		},
+	}
+
+	submitter := newTestSigner(t)
+	vcJWT, err := credential.SignVerifiableCredentialJWT(submitter, credential.VerifiableCredential{
+		Context:           []any{"https://www.w3.org/2018/credentials/v1"},
+		Type:              []string{"VerifiableCredential"},
+		Issuer:            submitter.ID,
+		IssuanceDate:      time.Now().Format(time.RFC3339),
+		CredentialSubject: map[string]any{"id": submitter.ID, "email": "satoshi@example.com"},
+	})
+	require.NoError(t, err)
+
+	t.Run("issue and verify", func(tt *testing.T) {
+		gate, err := NewCredentialGate(config)
+		require.NoError(tt, err)
+
+		result, err := gate.ValidatePresentationSubmission(context.Background(), buildTestSubmissionJWT(tt, submitter, admin.ID, def, [][]byte{vcJWT}, nil), WithTrace())
+		require.NoError(tt, err)
+		assert.True(tt, result.Valid)
+		require.NotEmpty(tt, result.AccessToken)
+		assert.Equal(tt, "grant", result.Trace.Steps[len(result.Trace.Steps)-1].Name)
+
+		token, err := gate.VerifyAccessToken(context.Background(), result.AccessToken, "")
+		require.NoError(tt, err)
+		assert.NotEmpty(tt, token.ID)
+		assert.Equal(tt, admin.ID, token.Issuer)
+		assert.Equal(tt, submitter.ID, token.Subject)
+		assert.Equal(tt, []string{admin.ID}, token.Audience)
+		assert.Equal(tt, def.ID, token.DefinitionID)
+		assert.Equal(tt, []string{"profile:read", "profile:write"}, token.Scopes)
+		assert.Equal(tt, map[string]any{"email": "satoshi@example.com"}, token.Claims)
+		assert.WithinDuration(tt, token.IssuedAt.Add(time.Minute), token.ExpiresAt, time.Second)
+
+		_, err = gate.VerifyAccessToken(context.Background(), result.AccessToken, "did:test:service")
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "aud")
+	})
+
+	t.Run("audience", func(tt *testing.T) {
+		audienceConfig := config
+		audienceConfig.AccessToken = &AccessTokenConfig{Audience: []string{"did:test:service"}}
+		gate, err := NewCredentialGate(audienceConfig)
+		require.NoError(tt, err)
+
+		result, err := gate.ValidatePresentationSubmission(context.Background(), buildTestSubmissionJWT(tt, submitter, admin.ID, def, [][]byte{vcJWT}, nil))
+		require.NoError(tt, err)
+		token, err := gate.VerifyAccessToken(context.Background(), result.AccessToken, "did:test:service")
+		require.NoError(tt, err)
+		assert.Empty(tt, token.Scopes)
+		assert.Empty(tt, token.Claims)
+	})
+
+	t.Run("no token when denied", func(tt *testing.T) {
+		gate, err := NewCredentialGate(config)
+		require.NoError(tt, err)
+
+		result, err := gate.ValidatePresentationSubmission(context.Background(), buildTestSubmissionJWT(tt, submitter, "did:test:other", def, [][]byte{vcJWT}, nil))
+		assert.Error(tt, err)
+		assert.False(tt, result.Valid)
+		assert.Empty(tt, result.AccessToken)
+	})
+
+	t.Run("claims only from verified credentials", func(tt *testing.T) {
+		gate, err := NewCredentialGate(config)
+		require.NoError(tt, err)
+
+		// the email credential submitted is an unsigned one outside the VP's credentials
+		submissionJWT := signTestPresentationJWT(tt, submitter, admin.ID, map[string]any{
+			"verifiableCredential": []any{string(vcJWT)},
+			"proof": map[string]any{
+				"@context":          []any{"https://www.w3.org/2018/credentials/v1"},
+				"type":              []any{"VerifiableCredential"},
+				"issuer":            submitter.ID,
+				"issuanceDate":      time.Now().Format(time.RFC3339),
+				"credentialSubject": map[string]any{"id": submitter.ID, "email": "admin@example.com"},
+			},
+			"presentation_submission": map[string]any{
+				"id":             "forged-submission",
+				"definition_id":  def.ID,
+				"descriptor_map": []any{map[string]any{"id": "email", "format": exchange.LDPVC.String(), "path": "$.proof"}},
+			},
+		})
+		result, err := gate.ValidatePresentationSubmission(context.Background(), submissionJWT)
+		assert.Error(tt, err)
+		assert.False(tt, result.Valid)
+		assert.Empty(tt, result.AccessToken)
+
+		// the claims of a granted token are those of the submitted credential
+		result, err = gate.ValidatePresentationSubmission(context.Background(), buildTestSubmissionJWT(tt, submitter, admin.ID, def, [][]byte{vcJWT}, nil))
+		require.NoError(tt, err)
+		token, err := gate.VerifyAccessToken(context.Background(), result.AccessToken, "")
+		require.NoError(tt, err)
+		assert.Equal(tt, "satoshi@example.com", token.Claims["email"])
+	})
+
+	t.Run("rejected tokens", func(tt *testing.T) {
+		gate, err := NewCredentialGate(config)
+		require.NoError(tt, err)
+
+		sign := func(signerKey any, typ string, expiration time.Time) string {
+			token := jwt.New()
+			require.NoError(tt, token.Set(jwt.IssuerKey, admin.ID))
+			require.NoError(tt, token.Set(jwt.AudienceKey, []string{admin.ID}))
+			require.NoError(tt, token.Set(jwt.ExpirationKey, expiration.Unix()))
+			headers := jws.NewHeaders()
+			require.NoError(tt, headers.Set(jws.TypeKey, typ))
+			signed, err := jwt.Sign(token, jwt.WithKey(jwa.SignatureAlgorithm(admin.ALG), signerKey, jws.WithProtectedHeaders(headers)))
+			require.NoError(tt, err)
+			return string(signed)
+		}
+
+		_, err = gate.VerifyAccessToken(context.Background(), sign(admin.PrivateKey, AccessTokenType, time.Now().Add(time.Minute)), "")
+		assert.NoError(tt, err)
+
+		_, err = gate.VerifyAccessToken(context.Background(), sign(admin.PrivateKey, AccessTokenType, time.Now().Add(-time.Minute)), "")
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "exp")
+
+		// an admin signed JWT which is not an access token, such as a VP JWT
+		_, err = gate.VerifyAccessToken(context.Background(), sign(admin.PrivateKey, "JWT", time.Now().Add(time.Minute)), "")
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "token type")
+
+		other := newTestSigner(tt)
+		_, err = gate.VerifyAccessToken(context.Background(), sign(other.PrivateKey, AccessTokenType, time.Now().Add(time.Minute)), "")
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "verifying access token")
+	})
+
+	t.Run("invalid config", func(tt *testing.T) {
+		noSigner := config
+		noSigner.AdminSigner = nil
+		_, err := NewCredentialGate(noSigner)
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "require an admin signer")
+
+		unknownDescriptor := config
+		unknownDescriptor.AccessToken = &AccessTokenConfig{Claims: map[string]ClaimSelector{"email": {InputDescriptorID: "phone", Path: "$.credentialSubject.phone"}}}
+		_, err = NewCredentialGate(unknownDescriptor)
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "not found in presentation definition")
+
+		negativeTTL := config
+		negativeTTL.AccessToken = &AccessTokenConfig{TTL: -time.Minute}
+		_, err = NewCredentialGate(negativeTTL)
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "ttl")
+
+		gate, err := NewCredentialGate(CredentialGateConfig{AdminDID: admin.ID, PresentationDefinition: def})
+		require.NoError(tt, err)
+		_, err = gate.VerifyAccessToken(context.Background(), "token", "")
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "does not issue access tokens")
+	})
+}
@@ -0,0 +1,90 @@
+package gate
+
+import (
+	"context"
+	"strings"
+
+	"github.com/TBD54566975/ssi-sdk/credential"
+	"github.com/pkg/errors"
+)
+
+// HolderBindingPolicy determines how the submitter of a presentation must be bound to the subjects of the
+// credentials it presents, so that credentials copied from their holder cannot be presented by anyone else
+type HolderBindingPolicy string
+
+const (
+	// HolderBindingDisabled does not check the subjects of presented credentials
+	HolderBindingDisabled HolderBindingPolicy = "disabled"
+	// HolderBindingSubject requires the subject of each presented credential to be the submitter's DID
+	HolderBindingSubject HolderBindingPolicy = "subject"
+	// HolderBindingController requires the subject of each presented credential to be the submitter's DID, or a
+	// DID whose authentication relationship includes a verification method of the submitter's DID
+	HolderBindingController HolderBindingPolicy = "controller"
+)
+
+// IsValid checks the policy is known
+func (p HolderBindingPolicy) IsValid() error {
+	switch p {
+	case "", HolderBindingDisabled, HolderBindingSubject, HolderBindingController:
+		return nil
+	}
+	return errors.Errorf("unknown holder binding policy: %s", p)
+}
+
+// checkHolderBinding makes sure the submitter is bound to the subject of each submitted credential according to
+// the gate's holder binding policy
+func (cg *CredentialGate) checkHolderBinding(ctx context.Context, submitter string, submitted []submittedCredential) error {
+	policy := cg.config.HolderBinding
+	if policy == "" || policy == HolderBindingDisabled {
+		return nil
+	}
+	for _, sc := range submitted {
+		subject, ok := sc.credential.CredentialSubject[credential.VerifiableCredentialIDProperty].(string)
+		if !ok || subject == "" {
+			return newInputDescriptorDenial(ReasonHolderMismatch, sc.inputDescriptorID, nil,
+				errors.Errorf("credential submitted for input descriptor<%s> has no subject", sc.inputDescriptorID))
+		}
+		if subject == submitter {
+			continue
+		}
+		if policy == HolderBindingController {
+			controlled, err := cg.isControlledBy(ctx, subject, submitter)
+			if err != nil {
+				return newInputDescriptorDenial(ReasonHolderMismatch, sc.inputDescriptorID, nil, err)
+			}
+			if controlled {
+				continue
+			}
+		}
+		return newInputDescriptorDenial(ReasonHolderMismatch, sc.inputDescriptorID, nil,
+			errors.Errorf("subject<%s> of credential submitted for input descriptor<%s> is not the submitter<%s>",
+				subject, sc.inputDescriptorID, submitter))
+	}
+	return nil
+}
+
+// isControlledBy returns whether the authentication relationship of the subject's DID Document includes a
+// verification method of the controller's DID, so the controller can authenticate as the subject. Naming the
+// controller as the controller of the document, or of its verification methods, is not enough, since it gives the
+// controller no key the subject authenticates with.
+func (cg *CredentialGate) isControlledBy(ctx context.Context, subject, controller string) (bool, error) {
+	resolved, err := cg.resolver.Resolve(ctx, subject)
+	if err != nil {
+		return false, errors.Wrapf(err, "resolving subject's DID<%s>", subject)
+	}
+	doc := resolved.Document
+	for _, methodSet := range AuthenticationRelationship.methods(doc) {
+		id, ok := methodSet.(string)
+		if !ok {
+			vm, err := toVerificationMethod(methodSet)
+			if err != nil {
+				return false, errors.Wrapf(err, "parsing %s of DID<%s>", AuthenticationRelationship, subject)
+			}
+			id = vm.ID
+		}
+		if did, _, _ := strings.Cut(toDIDURL(doc.ID, id), "#"); did == controller {
+			return true, nil
+		}
+	}
+	return false, nil
+}
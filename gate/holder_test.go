@@ -0,0 +1,165 @@
+package gate
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/TBD54566975/ssi-sdk/credential"
+	"github.com/TBD54566975/ssi-sdk/credential/exchange"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestHolderBinding(t *testing.T) {
+	requesterID := "did:test:admin"
+	inputDescriptorID := "name"
+	presentationDefinition := exchange.PresentationDefinition{
+		ID: uuid.New().String(),
+		InputDescriptors: []exchange.InputDescriptor{
+			{
+				ID: inputDescriptorID,
+				Constraints: &exchange.Constraints{
+					Fields: []exchange.Field{{Path: []string{"$.vc.credentialSubject.name"}}},
+				},
+			},
+		},
+	}
+
+	issuer := newTestSigner(t)
+	holder := newTestSigner(t)
+	credentialFor := func(t *testing.T, subject string) []byte {
+		credentialSubject := map[string]any{"name": "Satoshi"}
+		if subject != "" {
+			credentialSubject["id"] = subject
+		}
+		vcJWT, err := credential.SignVerifiableCredentialJWT(issuer, credential.VerifiableCredential{
+			Context:           []any{"https://www.w3.org/2018/credentials/v1"},
+			Type:              []string{"VerifiableCredential"},
+			Issuer:            issuer.ID,
+			IssuanceDate:      time.Now().Format(time.RFC3339),
+			CredentialSubject: credentialSubject,
+		})
+		require.NoError(t, err)
+		return vcJWT
+	}
+	validate := func(t *testing.T, policy HolderBindingPolicy, subject string) (*Result, error) {
+		gate, err := NewCredentialGate(CredentialGateConfig{
+			AdminDID:               requesterID,
+			PresentationDefinition: presentationDefinition,
+			HolderBinding:          policy,
+		})
+		require.NoError(t, err)
+		submissionJWT := buildTestSubmissionJWT(t, holder, requesterID, presentationDefinition, [][]byte{credentialFor(t, subject)}, nil)
+		return gate.ValidatePresentationSubmission(context.Background(), submissionJWT)
+	}
+
+	t.Run("disabled", func(tt *testing.T) {
+		for _, policy := range []HolderBindingPolicy{"", HolderBindingDisabled} {
+			result, err := validate(tt, policy, issuer.ID)
+			assert.NoError(tt, err)
+			assert.True(tt, result.Valid)
+		}
+	})
+
+	t.Run("subject is submitter", func(tt *testing.T) {
+		for _, policy := range []HolderBindingPolicy{HolderBindingSubject, HolderBindingController} {
+			result, err := validate(tt, policy, holder.ID)
+			assert.NoError(tt, err)
+			assert.True(tt, result.Valid)
+		}
+	})
+
+	t.Run("subject is not submitter", func(tt *testing.T) {
+		for _, policy := range []HolderBindingPolicy{HolderBindingSubject, HolderBindingController} {
+			result, err := validate(tt, policy, issuer.ID)
+			assert.Error(tt, err)
+			assert.False(tt, result.Valid)
+			assert.Equal(tt, ReasonHolderMismatch, result.Reason.Code)
+			assert.Equal(tt, inputDescriptorID, result.Reason.InputDescriptorID)
+		}
+	})
+
+	t.Run("credential without subject", func(tt *testing.T) {
+		result, err := validate(tt, HolderBindingSubject, "")
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonHolderMismatch, result.Reason.Code)
+	})
+
+	t.Run("subject controlled by submitter", func(tt *testing.T) {
+		defer gock.Off()
+		subject := "did:web:holder.example.com"
+		gock.New("https://holder.example.com").
+			Get("/.well-known/did.json").
+			Persist().
+			Reply(200).
+			BodyString(fmt.Sprintf(`{"didDocument": {"id": "%s", "authentication": ["%s"]}}`, subject, holder.KID))
+
+		result, err := validate(tt, HolderBindingController, subject)
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+
+		result, err = validate(tt, HolderBindingSubject, subject)
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonHolderMismatch, result.Reason.Code)
+	})
+
+	t.Run("subject naming submitter as controller only", func(tt *testing.T) {
+		defer gock.Off()
+		subject := "did:web:holder.example.com"
+		gock.New("https://holder.example.com").
+			Get("/.well-known/did.json").
+			Persist().
+			Reply(200).
+			BodyString(fmt.Sprintf(`{"didDocument": {"id": "%s", "controller": "%s"}}`, subject, holder.ID))
+
+		// the submitter has no key the subject authenticates with
+		result, err := validate(tt, HolderBindingController, subject)
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonHolderMismatch, result.Reason.Code)
+	})
+
+	t.Run("credential outside the VP bound to submitter", func(tt *testing.T) {
+		gate, err := NewCredentialGate(CredentialGateConfig{
+			AdminDID:               requesterID,
+			PresentationDefinition: presentationDefinition,
+			HolderBinding:          HolderBindingSubject,
+		})
+		require.NoError(tt, err)
+
+		// the verified credential is of another subject, and the unsigned one the submission points to is the submitter's
+		forged := map[string]any{
+			"@context":          []any{"https://www.w3.org/2018/credentials/v1"},
+			"type":              []any{"VerifiableCredential"},
+			"issuer":            issuer.ID,
+			"issuanceDate":      time.Now().Format(time.RFC3339),
+			"credentialSubject": map[string]any{"id": holder.ID, "name": "Satoshi"},
+		}
+		submissionJWT := signTestPresentationJWT(tt, holder, requesterID, map[string]any{
+			"verifiableCredential": []any{string(credentialFor(tt, issuer.ID))},
+			"proof":                forged,
+			"presentation_submission": map[string]any{
+				"id":             uuid.NewString(),
+				"definition_id":  presentationDefinition.ID,
+				"descriptor_map": []any{map[string]any{"id": inputDescriptorID, "format": exchange.JWTVC.String(), "path": "$.proof"}},
+			},
+		})
+		result, err := gate.ValidatePresentationSubmission(context.Background(), submissionJWT)
+		assert.Error(tt, err)
+		assert.False(tt, result.Valid)
+		assert.Equal(tt, ReasonInvalidSubmission, result.Reason.Code)
+	})
+
+	t.Run("unknown policy", func(tt *testing.T) {
+		_, err := NewCredentialGate(CredentialGateConfig{
+			AdminDID:               requesterID,
+			PresentationDefinition: presentationDefinition,
+			HolderBinding:          "sometimes",
+		})
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "unknown holder binding policy")
+	})
+}
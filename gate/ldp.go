@@ -0,0 +1,297 @@
+package gate
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+
+	"github.com/TBD54566975/ssi-sdk/credential"
+	"github.com/hyperledger/aries-framework-go/component/models/ld/context/embed"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/mr-tron/base58"
+	"github.com/piprate/json-gold/ld"
+	"github.com/pkg/errors"
+
+	"github.com/TBD54566975/credential-gate/resolver"
+)
+
+// Data Integrity proofs https://www.w3.org/TR/vc-data-integrity/ secure JSON-LD credentials and presentations.
+// The gate verifies proofs of the Ed25519Signature2020 https://w3id.org/security/suites/ed25519-2020/v1 and
+// JsonWebSignature2020 https://w3id.org/security/suites/jws-2020/v1 suites.
+const (
+	ed25519Signature2020Type    = "Ed25519Signature2020"
+	ed25519Signature2020Context = "https://w3id.org/security/suites/ed25519-2020/v1"
+	jsonWebSignature2020Type    = "JsonWebSignature2020"
+	jsonWebSignature2020Context = "https://w3id.org/security/suites/jws-2020/v1"
+
+	jsonLDContextProperty = "@context"
+	proofProperty         = "proof"
+)
+
+// dataIntegrityProof is a proof embedded in a JSON-LD credential or presentation
+type dataIntegrityProof struct {
+	Type               string `json:"type"`
+	Created            string `json:"created,omitempty"`
+	Expires            string `json:"expires,omitempty"`
+	VerificationMethod string `json:"verificationMethod"`
+	ProofPurpose       string `json:"proofPurpose"`
+	Challenge          string `json:"challenge,omitempty"`
+	Domain             string `json:"domain,omitempty"`
+	ProofValue         string `json:"proofValue,omitempty"`
+	JWS                string `json:"jws,omitempty"`
+}
+
+// signer returns the DID of the verification method which created the proof
+func (p dataIntegrityProof) signer() string {
+	did, _, _ := strings.Cut(p.VerificationMethod, "#")
+	return did
+}
+
+// getDataIntegrityProof returns the single proof of a JSON-LD document
+func getDataIntegrityProof(doc map[string]any) (*dataIntegrityProof, error) {
+	proofMap, ok := doc[proofProperty].(map[string]any)
+	if !ok {
+		return nil, errors.New("document must have exactly one proof")
+	}
+	proofBytes, err := json.Marshal(proofMap)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshalling proof")
+	}
+	var proof dataIntegrityProof
+	if err = json.Unmarshal(proofBytes, &proof); err != nil {
+		return nil, errors.Wrap(err, "unmarshalling proof")
+	}
+	if !strings.HasPrefix(proof.VerificationMethod, "did:") {
+		return nil, errors.Errorf("proof verification method<%s> is not a DID URL", proof.VerificationMethod)
+	}
+	return &proof, nil
+}
+
+// documentLoader loads JSON-LD contexts without network access. It knows the standard credential, security,
+// and status list contexts, and any additional contexts the gate is configured with; any other context fails
+// to load, so a document using it cannot be verified.
+type documentLoader map[string]json.RawMessage
+
+func newDocumentLoader(contexts map[string]json.RawMessage) (documentLoader, error) {
+	loader := make(documentLoader)
+	for _, c := range embed.Contexts {
+		loader[c.URL] = c.Content
+		loader[c.DocumentURL] = c.Content
+	}
+	for url, content := range contexts {
+		if !json.Valid(content) {
+			return nil, errors.Errorf("JSON-LD context<%s> is not valid JSON", url)
+		}
+		loader[url] = content
+	}
+	return loader, nil
+}
+
+func (l documentLoader) LoadDocument(url string) (*ld.RemoteDocument, error) {
+	content, ok := l[url]
+	if !ok {
+		return nil, ld.NewJsonLdError(ld.LoadingDocumentFailed, errors.Errorf("unknown JSON-LD context<%s>", url))
+	}
+	doc, err := ld.DocumentFromReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, ld.NewJsonLdError(ld.LoadingDocumentFailed, err)
+	}
+	return &ld.RemoteDocument{DocumentURL: url, Document: doc}, nil
+}
+
+// canonicalize canonicalizes a JSON-LD document with URDNA2015 https://www.w3.org/TR/rdf-canon/. Properties that
+// are not defined by the document's contexts are an error rather than being dropped, as they would not be secured
+// by a proof over the canonical document.
+func canonicalize(doc map[string]any, loader ld.DocumentLoader) ([]byte, error) {
+	options := ld.NewJsonLdOptions("")
+	options.Format = "application/n-quads"
+	options.Algorithm = ld.AlgorithmURDNA2015
+	options.ProcessingMode = ld.JsonLd_1_1
+	options.DocumentLoader = loader
+	options.SafeMode = true
+	normalized, err := ld.NewJsonLdProcessor().Normalize(doc, options)
+	if err != nil {
+		return nil, err
+	}
+	canonical, ok := normalized.(string)
+	if !ok {
+		return nil, errors.New("canonicalized document is not a string")
+	}
+	return []byte(canonical), nil
+}
+
+// createVerifyHash creates the data a Data Integrity proof signs: the hash of the canonical proof options
+// followed by the hash of the canonical document without its proof. The proof options are the proof without
+// its signature, using the document's contexts, which must include the context of the proof's suite.
+// https://w3c-ccg.github.io/data-integrity-spec/#create-verify-hash-algorithm
+func createVerifyHash(doc map[string]any, suiteContext string, loader ld.DocumentLoader) ([]byte, error) {
+	proofOptions, ok := doc[proofProperty].(map[string]any)
+	if !ok {
+		return nil, errors.New("document must have exactly one proof")
+	}
+	contexts, err := ensureContext(doc[jsonLDContextProperty], suiteContext)
+	if err != nil {
+		return nil, err
+	}
+
+	unsigned := make(map[string]any, len(doc))
+	for k, v := range doc {
+		if k != proofProperty {
+			unsigned[k] = v
+		}
+	}
+	options := make(map[string]any, len(proofOptions))
+	for k, v := range proofOptions {
+		if k != "proofValue" && k != "jws" {
+			options[k] = v
+		}
+	}
+	options[jsonLDContextProperty] = contexts
+
+	canonicalOptions, err := canonicalize(options, loader)
+	if err != nil {
+		return nil, errors.Wrap(err, "canonicalizing proof options")
+	}
+	canonicalDoc, err := canonicalize(unsigned, loader)
+	if err != nil {
+		return nil, errors.Wrap(err, "canonicalizing document")
+	}
+	optionsHash := sha256.Sum256(canonicalOptions)
+	docHash := sha256.Sum256(canonicalDoc)
+	return append(optionsHash[:], docHash[:]...), nil
+}
+
+// ensureContext returns the contexts of a document, adding the given context if it is not already present
+func ensureContext(maybeContexts any, context string) ([]any, error) {
+	var contexts []any
+	switch c := maybeContexts.(type) {
+	case string:
+		contexts = []any{c}
+	case []any:
+		contexts = append(contexts, c...)
+	case []string:
+		for _, s := range c {
+			contexts = append(contexts, s)
+		}
+	default:
+		return nil, errors.New("document has no @context")
+	}
+	for _, c := range contexts {
+		if c == context {
+			return contexts, nil
+		}
+	}
+	return append(contexts, context), nil
+}
+
+// verifyDataIntegrityProof verifies the proof of a JSON-LD credential or presentation. The proof must be made
+// for the given purpose, with a key of the signer's DID in the verification relationship of the same name.
+func verifyDataIntegrityProof(ctx context.Context, r *resolver.Resolver, loader ld.DocumentLoader, doc map[string]any, relationship VerificationRelationship) (*dataIntegrityProof, error) {
+	proof, err := getDataIntegrityProof(doc)
+	if err != nil {
+		return nil, newDenial(ReasonInvalidSubmission, err)
+	}
+	if proof.ProofPurpose != string(relationship) {
+		return nil, newDenial(ReasonKeyNotAuthorized, errors.Errorf("proof purpose<%s> is not %s", proof.ProofPurpose, relationship))
+	}
+
+	var suiteContext string
+	switch proof.Type {
+	case ed25519Signature2020Type:
+		suiteContext = ed25519Signature2020Context
+	case jsonWebSignature2020Type:
+		suiteContext = jsonWebSignature2020Context
+	default:
+		return nil, newDenial(ReasonInvalidSubmission, errors.Errorf("unsupported proof type: %s", proof.Type))
+	}
+	verifyHash, err := createVerifyHash(doc, suiteContext, loader)
+	if err != nil {
+		return nil, newDenial(ReasonInvalidSubmission, err)
+	}
+
+	pubKey, err := getVerificationKey(ctx, r, proof.signer(), proof.VerificationMethod, relationship)
+	if err != nil {
+		return nil, err
+	}
+	switch proof.Type {
+	case ed25519Signature2020Type:
+		err = verifyEd25519Signature2020(*proof, pubKey, verifyHash)
+	case jsonWebSignature2020Type:
+		err = verifyJSONWebSignature2020(*proof, pubKey, verifyHash)
+	}
+	if err != nil {
+		return nil, newDenial(ReasonSignatureInvalid, errors.Wrapf(err, "verifying %s proof", proof.Type))
+	}
+	return proof, nil
+}
+
+// verifyEd25519Signature2020 verifies the signature of an Ed25519Signature2020 proof, which is a base58btc
+// multibase encoded signature of the verify hash
+func verifyEd25519Signature2020(proof dataIntegrityProof, pubKey any, verifyHash []byte) error {
+	edKey, ok := pubKey.(ed25519.PublicKey)
+	if !ok {
+		return errors.Errorf("key<%s> is not an Ed25519 key", proof.VerificationMethod)
+	}
+	if !strings.HasPrefix(proof.ProofValue, "z") {
+		return errors.New("proof value is not base58btc multibase encoded")
+	}
+	signature, err := base58.Decode(proof.ProofValue[1:])
+	if err != nil {
+		return errors.Wrap(err, "decoding proof value")
+	}
+	if !ed25519.Verify(edKey, verifyHash, signature) {
+		return errors.New("signature does not match")
+	}
+	return nil
+}
+
+// verifyJSONWebSignature2020 verifies the signature of a JsonWebSignature2020 proof, which is a JWS with an
+// unencoded, detached payload of the verify hash https://www.rfc-editor.org/rfc/rfc7797
+func verifyJSONWebSignature2020(proof dataIntegrityProof, pubKey any, verifyHash []byte) error {
+	encodedHeader, _, ok := strings.Cut(proof.JWS, ".")
+	if !ok {
+		return errors.New("malformed JWS")
+	}
+	headerBytes, err := base64.RawURLEncoding.DecodeString(encodedHeader)
+	if err != nil {
+		return errors.Wrap(err, "decoding JWS header")
+	}
+	var header struct {
+		Algorithm string `json:"alg"`
+	}
+	if err = json.Unmarshal(headerBytes, &header); err != nil {
+		return errors.Wrap(err, "unmarshalling JWS header")
+	}
+	_, err = jws.Verify([]byte(proof.JWS), jws.WithKey(jwa.SignatureAlgorithm(header.Algorithm), pubKey), jws.WithDetachedPayload(verifyHash))
+	return err
+}
+
+// verifyDataIntegrityCredential verifies the proof of a JSON-LD credential, which must be made by a key of the
+// issuer's DID in its assertionMethod relationship, and that the credential is currently valid
+func verifyDataIntegrityCredential(ctx context.Context, r *resolver.Resolver, loader ld.DocumentLoader, clock validityClock, vc map[string]any) error {
+	proof, err := verifyDataIntegrityProof(ctx, r, loader, vc, AssertionMethodRelationship)
+	if err != nil {
+		return err
+	}
+	_, _, cred, err := credential.ToCredential(vc)
+	if err != nil {
+		return newDenial(ReasonInvalidSubmission, errors.Wrap(err, "parsing credential"))
+	}
+	issuer, err := getCredentialIssuer(*cred)
+	if err != nil {
+		return newDenial(ReasonInvalidSubmission, err)
+	}
+	if proof.signer() != issuer {
+		return newDenial(ReasonSignatureInvalid, errors.Errorf("%s is signed by %s, not its issuer<%s>", credentialName(cred.ID, issuer), proof.signer(), issuer))
+	}
+	name := credentialName(cred.ID, issuer)
+	if _, err = clock.checkProof(*proof, name+" proof"); err != nil {
+		return err
+	}
+	return clock.checkCredentialDates(vc, name)
+}
@@ -0,0 +1,306 @@
+package gate
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/TBD54566975/ssi-sdk/credential"
+	"github.com/TBD54566975/ssi-sdk/credential/exchange"
+	"github.com/TBD54566975/ssi-sdk/crypto"
+	"github.com/TBD54566975/ssi-sdk/did/key"
+	"github.com/google/uuid"
+	"github.com/mr-tron/base58"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testNameContext         = "https://example.com/contexts/name/v1"
+	testNameContextDocument = `{"@context": {"name": "https://schema.org/name"}}`
+)
+
+// testLDSigner signs JSON-LD documents with an Ed25519 did:key
+type testLDSigner struct {
+	did                string
+	verificationMethod string
+	privKey            ed25519.PrivateKey
+}
+
+func newTestLDSigner(t *testing.T) testLDSigner {
+	privKey, didKey, err := key.GenerateDIDKey(crypto.Ed25519)
+	require.NoError(t, err)
+	expanded, err := didKey.Expand()
+	require.NoError(t, err)
+	return testLDSigner{
+		did:                didKey.String(),
+		verificationMethod: expanded.VerificationMethod[0].ID,
+		privKey:            privKey.(ed25519.PrivateKey),
+	}
+}
+
+// sign adds a proof of the given type and purpose to the document, with any extra proof options
+func (s testLDSigner) sign(t *testing.T, doc map[string]any, proofType, purpose string, options map[string]any) {
+	loader, err := newDocumentLoader(map[string]json.RawMessage{testNameContext: json.RawMessage(testNameContextDocument)})
+	require.NoError(t, err)
+
+	proof := map[string]any{
+		"type":               proofType,
+		"created":            time.Now().UTC().Format(time.RFC3339),
+		"verificationMethod": s.verificationMethod,
+		"proofPurpose":       purpose,
+	}
+	for k, v := range options {
+		proof[k] = v
+	}
+	doc[proofProperty] = proof
+	suiteContext := ed25519Signature2020Context
+	if proofType == jsonWebSignature2020Type {
+		suiteContext = jsonWebSignature2020Context
+	}
+	verifyHash, err := createVerifyHash(doc, suiteContext, loader)
+	require.NoError(t, err)
+
+	switch proofType {
+	case ed25519Signature2020Type:
+		proof["proofValue"] = "z" + base58.Encode(ed25519.Sign(s.privKey, verifyHash))
+	case jsonWebSignature2020Type:
+		header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"EdDSA","b64":false,"crit":["b64"]}`))
+		signature := ed25519.Sign(s.privKey, append([]byte(header+"."), verifyHash...))
+		proof["jws"] = header + ".." + base64.RawURLEncoding.EncodeToString(signature)
+	}
+}
+
+func TestDataIntegrityPresentation(t *testing.T) {
+	requesterID := "did:test:admin"
+	inputDescriptorID := "name"
+	presentationDefinition := exchange.PresentationDefinition{
+		ID: uuid.New().String(),
+		InputDescriptors: []exchange.InputDescriptor{
+			{
+				ID: inputDescriptorID,
+				Constraints: &exchange.Constraints{
+					Fields: []exchange.Field{{Path: []string{"$.credentialSubject.name", "$.vc.credentialSubject.name"}}},
+				},
+			},
+		},
+	}
+	newGate := func(t *testing.T, config CredentialGateConfig) *CredentialGate {
+		config.AdminDID = requesterID
+		config.PresentationDefinition = presentationDefinition
+		if config.JSONLDContexts == nil {
+			config.JSONLDContexts = map[string]json.RawMessage{testNameContext: json.RawMessage(testNameContextDocument)}
+		}
+		gate, err := NewCredentialGate(config)
+		require.NoError(t, err)
+		return gate
+	}
+
+	issuer := newTestLDSigner(t)
+	holder := newTestLDSigner(t)
+	buildCredential := func(t *testing.T, proofType string) map[string]any {
+		vc := map[string]any{
+			"@context":     []any{"https://www.w3.org/2018/credentials/v1", testNameContext, ed25519Signature2020Context},
+			"id":           "urn:uuid:" + uuid.NewString(),
+			"type":         []any{"VerifiableCredential"},
+			"issuer":       issuer.did,
+			"issuanceDate": time.Now().UTC().Format(time.RFC3339),
+			"credentialSubject": map[string]any{
+				"id":   holder.did,
+				"name": "Satoshi",
+			},
+		}
+		issuer.sign(t, vc, proofType, "assertionMethod", nil)
+		return vc
+	}
+	buildPresentation := func(t *testing.T, proofType string, vc map[string]any, options map[string]any) map[string]any {
+		vp := map[string]any{
+			"@context": []any{"https://www.w3.org/2018/credentials/v1", exchange.PresentationSubmissionContext, ed25519Signature2020Context},
+			"id":       "urn:uuid:" + uuid.NewString(),
+			"type":     []any{"VerifiablePresentation", exchange.PresentationSubmissionType},
+			"holder":   holder.did,
+			"presentation_submission": map[string]any{
+				"id":            uuid.NewString(),
+				"definition_id": presentationDefinition.ID,
+				"descriptor_map": []any{map[string]any{
+					"id":     inputDescriptorID,
+					"format": exchange.LDPVC.String(),
+					"path":   "$.verifiableCredential[0]",
+				}},
+			},
+			"verifiableCredential": []any{vc},
+		}
+		proofOptions := map[string]any{"domain": requesterID}
+		for k, v := range options {
+			proofOptions[k] = v
+		}
+		holder.sign(t, vp, proofType, "authentication", proofOptions)
+		return vp
+	}
+	validate := func(t *testing.T, gate *CredentialGate, vp map[string]any) (*Result, error) {
+		vpBytes, err := json.Marshal(vp)
+		require.NoError(t, err)
+		return gate.ValidatePresentation(context.Background(), vpBytes)
+	}
+
+	t.Run("Ed25519Signature2020 presentation", func(tt *testing.T) {
+		vp := buildPresentation(tt, ed25519Signature2020Type, buildCredential(tt, ed25519Signature2020Type), nil)
+		result, err := validate(tt, newGate(tt, CredentialGateConfig{}), vp)
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+		assert.Equal(tt, holder.did, result.Submitter)
+		assert.Equal(tt, vp["id"], result.SubmissionID)
+	})
+
+	t.Run("JsonWebSignature2020 presentation", func(tt *testing.T) {
+		vp := buildPresentation(tt, jsonWebSignature2020Type, buildCredential(tt, jsonWebSignature2020Type), nil)
+		result, err := validate(tt, newGate(tt, CredentialGateConfig{}), vp)
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+	})
+
+	t.Run("tampered credential", func(tt *testing.T) {
+		vc := buildCredential(tt, ed25519Signature2020Type)
+		vc["credentialSubject"].(map[string]any)["name"] = "Hal"
+		result, err := validate(tt, newGate(tt, CredentialGateConfig{}), buildPresentation(tt, ed25519Signature2020Type, vc, nil))
+		assert.Error(tt, err)
+		assert.False(tt, result.Valid)
+		assert.Equal(tt, ReasonSignatureInvalid, result.Reason.Code)
+		assert.Equal(tt, inputDescriptorID, result.Reason.InputDescriptorID)
+	})
+
+	t.Run("tampered presentation", func(tt *testing.T) {
+		vp := buildPresentation(tt, ed25519Signature2020Type, buildCredential(tt, ed25519Signature2020Type), nil)
+		vp["id"] = "urn:uuid:" + uuid.NewString()
+		result, err := validate(tt, newGate(tt, CredentialGateConfig{}), vp)
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonSignatureInvalid, result.Reason.Code)
+	})
+
+	t.Run("unknown context is not fetched", func(tt *testing.T) {
+		vp := buildPresentation(tt, ed25519Signature2020Type, buildCredential(tt, ed25519Signature2020Type), nil)
+		result, err := validate(tt, newGate(tt, CredentialGateConfig{JSONLDContexts: map[string]json.RawMessage{}}), vp)
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonInvalidSubmission, result.Reason.Code)
+		assert.Contains(tt, err.Error(), testNameContext)
+	})
+
+	t.Run("presentation for another domain", func(tt *testing.T) {
+		vp := buildPresentation(tt, ed25519Signature2020Type, buildCredential(tt, ed25519Signature2020Type), map[string]any{"domain": "did:test:other"})
+		result, err := validate(tt, newGate(tt, CredentialGateConfig{}), vp)
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonAudienceMismatch, result.Reason.Code)
+	})
+
+	t.Run("presentation signed for another purpose", func(tt *testing.T) {
+		vp := buildPresentation(tt, ed25519Signature2020Type, buildCredential(tt, ed25519Signature2020Type), map[string]any{"proofPurpose": "assertionMethod"})
+		result, err := validate(tt, newGate(tt, CredentialGateConfig{}), vp)
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonKeyNotAuthorized, result.Reason.Code)
+	})
+
+	t.Run("presentation proof created in the future", func(tt *testing.T) {
+		vp := buildPresentation(tt, ed25519Signature2020Type, buildCredential(tt, ed25519Signature2020Type),
+			map[string]any{"created": time.Now().Add(time.Hour).UTC().Format(time.RFC3339)})
+		result, err := validate(tt, newGate(tt, CredentialGateConfig{}), vp)
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonNotYetValid, result.Reason.Code)
+		assert.Contains(tt, result.Reason.Message, "JSON-LD VP proof was created in the future")
+
+		// within the allowed clock skew
+		result, err = validate(tt, newGate(tt, CredentialGateConfig{ClockSkew: 2 * time.Hour}), vp)
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+	})
+
+	t.Run("presentation proof expired", func(tt *testing.T) {
+		vp := buildPresentation(tt, ed25519Signature2020Type, buildCredential(tt, ed25519Signature2020Type),
+			map[string]any{"expires": time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)})
+		result, err := validate(tt, newGate(tt, CredentialGateConfig{}), vp)
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonExpired, result.Reason.Code)
+		assert.Contains(tt, result.Reason.Message, "JSON-LD VP proof expired at")
+
+		// within the allowed clock skew
+		result, err = validate(tt, newGate(tt, CredentialGateConfig{ClockSkew: 2 * time.Minute}), vp)
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+	})
+
+	t.Run("credential proof created in the future", func(tt *testing.T) {
+		vc := map[string]any{
+			"@context":          []any{"https://www.w3.org/2018/credentials/v1", testNameContext, ed25519Signature2020Context},
+			"id":                "urn:uuid:" + uuid.NewString(),
+			"type":              []any{"VerifiableCredential"},
+			"issuer":            issuer.did,
+			"issuanceDate":      time.Now().UTC().Format(time.RFC3339),
+			"credentialSubject": map[string]any{"id": holder.did, "name": "Satoshi"},
+		}
+		issuer.sign(tt, vc, ed25519Signature2020Type, "assertionMethod", map[string]any{"created": time.Now().Add(time.Hour).UTC().Format(time.RFC3339)})
+		result, err := validate(tt, newGate(tt, CredentialGateConfig{}), buildPresentation(tt, ed25519Signature2020Type, vc, nil))
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonNotYetValid, result.Reason.Code)
+		assert.Equal(tt, inputDescriptorID, result.Reason.InputDescriptorID)
+	})
+
+	t.Run("presentation answering a challenge", func(tt *testing.T) {
+		gate := newGate(tt, CredentialGateConfig{RequireChallenge: true})
+		challenge, err := gate.NewChallenge(context.Background())
+		require.NoError(tt, err)
+
+		vp := buildPresentation(tt, ed25519Signature2020Type, buildCredential(tt, ed25519Signature2020Type), map[string]any{"challenge": challenge.Nonce})
+		result, err := validate(tt, gate, vp)
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+
+		result, err = validate(tt, gate, vp)
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonChallengeFailed, result.Reason.Code)
+	})
+
+	t.Run("replayed presentation", func(tt *testing.T) {
+		gate := newGate(tt, CredentialGateConfig{})
+		vp := buildPresentation(tt, ed25519Signature2020Type, buildCredential(tt, ed25519Signature2020Type), nil)
+		_, err := validate(tt, gate, vp)
+		assert.NoError(tt, err)
+
+		result, err := validate(tt, gate, vp)
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonReplayed, result.Reason.Code)
+	})
+
+	t.Run("VP JWT", func(tt *testing.T) {
+		signer := newTestSigner(tt)
+		vcJWT, err := credential.SignVerifiableCredentialJWT(signer, credential.VerifiableCredential{
+			Context:           []any{"https://www.w3.org/2018/credentials/v1"},
+			Type:              []string{"VerifiableCredential"},
+			Issuer:            signer.ID,
+			IssuanceDate:      time.Now().Format(time.RFC3339),
+			CredentialSubject: map[string]any{"id": signer.ID, "name": "Satoshi"},
+		})
+		require.NoError(tt, err)
+		gate := newGate(tt, CredentialGateConfig{})
+
+		submissionJWT := buildTestSubmissionJWT(tt, signer, requesterID, presentationDefinition, [][]byte{vcJWT}, nil)
+		result, err := gate.ValidatePresentation(context.Background(), []byte(submissionJWT))
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+		assert.Equal(tt, signer.ID, result.Submitter)
+
+		submissionJWT = buildTestSubmissionJWT(tt, signer, requesterID, presentationDefinition, [][]byte{vcJWT}, nil)
+		quoted, err := json.Marshal(submissionJWT)
+		require.NoError(tt, err)
+		result, err = gate.ValidatePresentation(context.Background(), quoted)
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+	})
+
+	t.Run("malformed presentation", func(tt *testing.T) {
+		result, err := newGate(tt, CredentialGateConfig{}).ValidatePresentation(context.Background(), []byte(`{"type": "VerifiablePresentation"}`))
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonInvalidSubmission, result.Reason.Code)
+	})
+}
@@ -0,0 +1,160 @@
+package gate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/TBD54566975/ssi-sdk/credential"
+	"github.com/TBD54566975/ssi-sdk/credential/exchange"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/pkg/errors"
+)
+
+// presentation is a presentation submission parsed from one of the envelopes the gate accepts: a VP JWT, a
+// JSON-LD VP secured with a Data Integrity proof, or an SD-JWT credential with a key binding JWT
+type presentation struct {
+	// format is the claim format of the envelope, one of jwt_vp, ldp_vp, or vc+sd-jwt
+	format string
+	vp     *credential.VerifiablePresentation
+
+	// submitter is the DID of the VP's signer
+	submitter string
+	// id identifies the submission for replay protection, if set
+	id string
+	// challenges are the values in the VP which may answer a challenge issued by the gate
+	challenges []string
+	// expiry is when the VP stops being valid, or zero if it does not expire
+	expiry time.Time
+
+	// jwt, headers, and token are set for a VP JWT
+	jwt     string
+	headers jws.Headers
+	token   jwt.Token
+
+	// document and proof are set for a JSON-LD VP
+	document map[string]any
+	proof    *dataIntegrityProof
+}
+
+// parsePresentation detects the envelope of a presentation submission and parses it: a JSON object is a JSON-LD
+// VP, and anything else is either an SD-JWT or a VP JWT, which may be a JSON string
+func parsePresentation(submission []byte) (*presentation, error) {
+	trimmed := bytes.TrimSpace(submission)
+	compact := string(trimmed)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		return parseDataIntegrityPresentation(trimmed)
+	case bytes.HasPrefix(trimmed, []byte(`"`)):
+		if err := json.Unmarshal(trimmed, &compact); err != nil {
+			return nil, errors.Wrap(err, "unmarshalling compact presentation")
+		}
+	}
+	if isSDJWT(compact) {
+		return parseSDJWTPresentation(compact)
+	}
+	return parsePresentationJWT(compact)
+}
+
+// parsePresentationJWT parses a VP JWT, whose signer's DID is set as the iss property as per
+// https://w3c.github.io/vc-jwt/#vp-jwt-1.1
+func parsePresentationJWT(presentationJWT string) (*presentation, error) {
+	headers, token, vp, err := credential.ParseVerifiablePresentationFromJWT(presentationJWT)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing VP from JWT")
+	}
+	var challenges []string
+	if maybeNonce, ok := token.Get(credential.NonceProperty); ok {
+		if nonce, ok := maybeNonce.(string); ok && nonce != "" {
+			challenges = append(challenges, nonce)
+		}
+	}
+	if jti := token.JwtID(); jti != "" {
+		challenges = append(challenges, jti)
+	}
+	return &presentation{
+		format:     exchange.JWTVP.String(),
+		vp:         vp,
+		submitter:  token.Issuer(),
+		id:         token.JwtID(),
+		challenges: challenges,
+		expiry:     token.Expiration(),
+		jwt:        presentationJWT,
+		headers:    headers,
+		token:      token,
+	}, nil
+}
+
+// parseDataIntegrityPresentation parses a JSON-LD VP. Its signer is the DID of the verification method of
+// its proof, which must be the VP's holder if it names one. The proof's challenge may answer a challenge
+// issued by the gate, and the VP's id is used for replay protection.
+func parseDataIntegrityPresentation(submission []byte) (*presentation, error) {
+	var document map[string]any
+	if err := json.Unmarshal(submission, &document); err != nil {
+		return nil, errors.Wrap(err, "unmarshalling JSON-LD VP")
+	}
+	var vp credential.VerifiablePresentation
+	if err := json.Unmarshal(submission, &vp); err != nil {
+		return nil, errors.Wrap(err, "unmarshalling JSON-LD VP")
+	}
+	proof, err := getDataIntegrityProof(document)
+	if err != nil {
+		return nil, errors.Wrap(err, "JSON-LD VP")
+	}
+	submitter := proof.signer()
+	if vp.Holder != "" && vp.Holder != submitter {
+		return nil, errors.Errorf("JSON-LD VP of holder<%s> is signed by %s", vp.Holder, submitter)
+	}
+	var challenges []string
+	if proof.Challenge != "" {
+		challenges = append(challenges, proof.Challenge)
+	}
+	var expiry time.Time
+	if proof.Expires != "" {
+		if expiry, err = time.Parse(time.RFC3339, proof.Expires); err != nil {
+			return nil, errors.Wrap(err, "parsing expiry of JSON-LD VP proof")
+		}
+	}
+	return &presentation{
+		format:     exchange.LDPVP.String(),
+		vp:         &vp,
+		submitter:  submitter,
+		id:         vp.ID,
+		challenges: challenges,
+		expiry:     expiry,
+		document:   document,
+		proof:      proof,
+	}, nil
+}
+
+// verifyPresentation verifies the VP's signature against the submitter's DID, that the VP is currently valid,
+// and that it is addressed to the gate. The VP must be signed with a key of the submitter's DID in the configured
+// verification relationship, which is authentication unless configured otherwise.
+func (cg *CredentialGate) verifyPresentation(ctx context.Context, p *presentation) error {
+	switch p.format {
+	case exchange.JWTVP.String():
+		return cg.verifyPresentationJWT(ctx, p.jwt, p.headers, p.token)
+	case sdJWTFormat:
+		// the key binding JWT standing in for the VP is verified along with the credential
+		return nil
+	}
+
+	relationship := cg.config.PresentationKeyRelationship
+	if relationship == "" {
+		relationship = AuthenticationRelationship
+	}
+	if _, err := verifyDataIntegrityProof(ctx, cg.resolver, cg.documentLoader, p.document, relationship); err != nil {
+		return errors.Wrap(err, "verifying JSON-LD VP")
+	}
+	clock := cg.validityClock()
+	created, err := clock.checkProof(*p.proof, "JSON-LD VP proof")
+	if err != nil {
+		return err
+	}
+	if err = clock.checkAge(created, cg.config.MaxPresentationAge, "JSON-LD VP"); err != nil {
+		return err
+	}
+	return cg.checkAudience("domain", []string{p.proof.Domain})
+}
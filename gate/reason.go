@@ -0,0 +1,100 @@
+package gate
+
+import (
+	"github.com/pkg/errors"
+)
+
+// ReasonCode is a stable, machine-readable code describing why the gate denied a presentation submission
+type ReasonCode string
+
+const (
+	// ReasonInvalidSubmission is used when the submission cannot be parsed or is not a valid presentation submission
+	ReasonInvalidSubmission ReasonCode = "INVALID_SUBMISSION"
+	// ReasonDIDMethodUnsupported is used when the submitter or an issuer uses a DID method the gate does not support
+	ReasonDIDMethodUnsupported ReasonCode = "DID_METHOD_UNSUPPORTED"
+	// ReasonDIDUnresolvable is used when the DID of the submitter or an issuer cannot be resolved
+	ReasonDIDUnresolvable ReasonCode = "DID_UNRESOLVABLE"
+	// ReasonKeyNotFound is used when the signing key cannot be found in the signer's DID Document
+	ReasonKeyNotFound ReasonCode = "KEY_NOT_FOUND"
+	// ReasonKeyNotAuthorized is used when the presentation is signed with a key the submitter's DID does not
+	// authorize for presentations, such as a key agreement key or a key of another DID
+	ReasonKeyNotAuthorized ReasonCode = "KEY_NOT_AUTHORIZED"
+	// ReasonSignatureInvalid is used when the signature on the presentation or a credential does not verify
+	ReasonSignatureInvalid ReasonCode = "SIGNATURE_INVALID"
+	// ReasonExpired is used when the presentation or a credential is expired, or the presentation is older than the
+	// gate accepts
+	ReasonExpired ReasonCode = "EXPIRED"
+	// ReasonNotYetValid is used when the presentation or a credential is not valid until a time in the future, or
+	// claims to have been issued in the future
+	ReasonNotYetValid ReasonCode = "NOT_YET_VALID"
+	// ReasonAudienceMismatch is used when the presentation was not addressed to the gate
+	ReasonAudienceMismatch ReasonCode = "AUDIENCE_MISMATCH"
+	// ReasonConstraintFailed is used when a credential does not fulfill an input descriptor
+	ReasonConstraintFailed ReasonCode = "CONSTRAINT_FAILED"
+	// ReasonHolderMismatch is used when the submitter is not bound to the subject of a presented credential
+	ReasonHolderMismatch ReasonCode = "HOLDER_MISMATCH"
+	// ReasonIssuerUntrusted is used when a credential was not issued by an issuer trusted for its input descriptor
+	ReasonIssuerUntrusted ReasonCode = "ISSUER_UNTRUSTED"
+	// ReasonRevoked is used when a credential has been revoked by its issuer
+	ReasonRevoked ReasonCode = "CREDENTIAL_REVOKED"
+	// ReasonSuspended is used when a credential has been suspended by its issuer
+	ReasonSuspended ReasonCode = "CREDENTIAL_SUSPENDED"
+	// ReasonStatusUnverifiable is used when the status of a credential cannot be determined, such as when its
+	// status list cannot be fetched or verified
+	ReasonStatusUnverifiable ReasonCode = "STATUS_UNVERIFIABLE"
+	// ReasonChallengeFailed is used when the presentation does not answer an outstanding challenge
+	ReasonChallengeFailed ReasonCode = "CHALLENGE_FAILED"
+	// ReasonReplayed is used when the presentation has already been accepted by the gate
+	ReasonReplayed ReasonCode = "SUBMISSION_REPLAYED"
+	// ReasonHandlerRejected is used when a custom handler rejects the credentials for an input descriptor
+	ReasonHandlerRejected ReasonCode = "HANDLER_REJECTED"
+	// ReasonHandlerError is used when a custom handler fails to run
+	ReasonHandlerError ReasonCode = "HANDLER_ERROR"
+	// ReasonInternalError is used when the gate fails for a reason unrelated to the submission
+	ReasonInternalError ReasonCode = "INTERNAL_ERROR"
+)
+
+// Reason describes why the gate denied a presentation submission
+type Reason struct {
+	Code    ReasonCode `json:"code"`
+	Message string     `json:"message,omitempty"`
+
+	// InputDescriptorID is the ID of the input descriptor whose credential caused the denial, if known
+	InputDescriptorID string `json:"inputDescriptorId,omitempty"`
+
+	// FieldPath is the path of the input descriptor field the credential failed to fulfill, if known
+	FieldPath []string `json:"fieldPath,omitempty"`
+}
+
+// denialError is an error which carries the reason for denying a presentation submission
+type denialError struct {
+	reason Reason
+	err    error
+}
+
+func (e *denialError) Error() string {
+	return e.err.Error()
+}
+
+func (e *denialError) Unwrap() error {
+	return e.err
+}
+
+func newDenial(code ReasonCode, err error) error {
+	return &denialError{reason: Reason{Code: code}, err: err}
+}
+
+func newInputDescriptorDenial(code ReasonCode, inputDescriptorID string, fieldPath []string, err error) error {
+	return &denialError{reason: Reason{Code: code, InputDescriptorID: inputDescriptorID, FieldPath: fieldPath}, err: err}
+}
+
+// getReason returns the reason carried by an error, or an internal error reason if the error carries none
+func getReason(err error) Reason {
+	reason := Reason{Code: ReasonInternalError}
+	var de *denialError
+	if errors.As(err, &de) {
+		reason = de.reason
+	}
+	reason.Message = err.Error()
+	return reason
+}
@@ -0,0 +1,224 @@
+package gate
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/TBD54566975/ssi-sdk/credential"
+	"github.com/TBD54566975/ssi-sdk/credential/exchange"
+	didsdk "github.com/TBD54566975/ssi-sdk/did"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReason(t *testing.T) {
+	requesterID := "did:test:admin"
+	inputDescriptorID := "name"
+	presentationDefinition := exchange.PresentationDefinition{
+		ID: uuid.New().String(),
+		InputDescriptors: []exchange.InputDescriptor{
+			{
+				ID: inputDescriptorID,
+				Constraints: &exchange.Constraints{
+					Fields: []exchange.Field{
+						{
+							Path: []string{"$.vc.credentialSubject.name"},
+						},
+						{
+							Path: []string{"$.vc.credentialSubject.age"},
+							Filter: &exchange.Filter{
+								Type:    "number",
+								Minimum: 21,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	signer := newTestSigner(t)
+	signCredential := func(subject map[string]any) []byte {
+		subject["id"] = signer.ID
+		vcJWT, err := credential.SignVerifiableCredentialJWT(signer, credential.VerifiableCredential{
+			Context:           []any{"https://www.w3.org/2018/credentials/v1"},
+			Type:              []string{"VerifiableCredential"},
+			Issuer:            signer.ID,
+			IssuanceDate:      time.Now().Format(time.RFC3339),
+			CredentialSubject: subject,
+		})
+		require.NoError(t, err)
+		return vcJWT
+	}
+	validVCJWT := signCredential(map[string]any{"name": "Satoshi", "age": 30})
+
+	// a signer using the submitter's DID and kid, but someone else's key
+	forger := newTestSigner(t)
+	forger.ID = signer.ID
+	forger.KID = signer.KID
+
+	newGate := func(t *testing.T, config CredentialGateConfig) *CredentialGate {
+		config.AdminDID = requesterID
+		config.PresentationDefinition = presentationDefinition
+		gate, err := NewCredentialGate(config)
+		require.NoError(t, err)
+		return gate
+	}
+
+	t.Run("invalid submission", func(tt *testing.T) {
+		result, err := newGate(tt, CredentialGateConfig{}).ValidatePresentationSubmission(context.Background(), "not a jwt")
+		assert.Error(tt, err)
+		assert.False(tt, result.Valid)
+		assert.Equal(tt, ReasonInvalidSubmission, result.Reason.Code)
+		assert.NotEmpty(tt, result.Reason.Message)
+	})
+
+	t.Run("unsupported DID method", func(tt *testing.T) {
+		gate := newGate(tt, CredentialGateConfig{SupportedDIDMethods: []didsdk.Method{didsdk.WebMethod}})
+		submissionJWT := buildTestSubmissionJWT(tt, signer, requesterID, presentationDefinition, [][]byte{validVCJWT}, nil)
+		result, err := gate.ValidatePresentationSubmission(context.Background(), submissionJWT)
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonDIDMethodUnsupported, result.Reason.Code)
+	})
+
+	t.Run("unresolvable submitter", func(tt *testing.T) {
+		unresolvable := signer
+		unresolvable.ID = "did:ion:unresolvable"
+		unresolvable.KID = unresolvable.ID + "#key-1"
+		submissionJWT := buildTestSubmissionJWT(tt, unresolvable, requesterID, presentationDefinition, [][]byte{validVCJWT}, nil)
+		result, err := newGate(tt, CredentialGateConfig{}).ValidatePresentationSubmission(context.Background(), submissionJWT)
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonDIDUnresolvable, result.Reason.Code)
+	})
+
+	t.Run("invalid presentation signature", func(tt *testing.T) {
+		submissionJWT := buildTestSubmissionJWT(tt, forger, requesterID, presentationDefinition, [][]byte{validVCJWT}, nil)
+		result, err := newGate(tt, CredentialGateConfig{}).ValidatePresentationSubmission(context.Background(), submissionJWT)
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonSignatureInvalid, result.Reason.Code)
+		assert.Empty(tt, result.Reason.InputDescriptorID)
+	})
+
+	t.Run("invalid credential signature", func(tt *testing.T) {
+		forgedVCJWT, err := credential.SignVerifiableCredentialJWT(forger, credential.VerifiableCredential{
+			Context:           []any{"https://www.w3.org/2018/credentials/v1"},
+			Type:              []string{"VerifiableCredential"},
+			Issuer:            signer.ID,
+			IssuanceDate:      time.Now().Format(time.RFC3339),
+			CredentialSubject: map[string]any{"id": signer.ID, "name": "Satoshi", "age": 30},
+		})
+		require.NoError(tt, err)
+		submissionJWT := buildTestSubmissionJWT(tt, signer, requesterID, presentationDefinition, [][]byte{forgedVCJWT}, nil)
+		result, err := newGate(tt, CredentialGateConfig{}).ValidatePresentationSubmission(context.Background(), submissionJWT)
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonSignatureInvalid, result.Reason.Code)
+		assert.Equal(tt, inputDescriptorID, result.Reason.InputDescriptorID)
+	})
+
+	t.Run("audience mismatch", func(tt *testing.T) {
+		submissionJWT := buildTestSubmissionJWT(tt, signer, "did:test:other", presentationDefinition, [][]byte{validVCJWT}, nil)
+		result, err := newGate(tt, CredentialGateConfig{}).ValidatePresentationSubmission(context.Background(), submissionJWT)
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonAudienceMismatch, result.Reason.Code)
+	})
+
+	t.Run("constraint failed", func(tt *testing.T) {
+		underageVCJWT := signCredential(map[string]any{"name": "Satoshi", "age": 18})
+		submissionJWT := buildTestSubmissionJWT(tt, signer, requesterID, presentationDefinition, [][]byte{underageVCJWT}, nil)
+		result, err := newGate(tt, CredentialGateConfig{}).ValidatePresentationSubmission(context.Background(), submissionJWT)
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonConstraintFailed, result.Reason.Code)
+		assert.Equal(tt, inputDescriptorID, result.Reason.InputDescriptorID)
+		assert.Equal(tt, []string{"$.vc.credentialSubject.age"}, result.Reason.FieldPath)
+	})
+
+	t.Run("constraint failed without a submission", func(tt *testing.T) {
+		namelessVCJWT := signCredential(map[string]any{"age": 30})
+		presentationJWT := buildTestPresentationJWT(tt, signer, requesterID, nil, [][]byte{namelessVCJWT}, nil)
+		result, err := newGate(tt, CredentialGateConfig{}).ValidatePresentationSubmission(context.Background(), presentationJWT)
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonConstraintFailed, result.Reason.Code)
+		assert.Equal(tt, inputDescriptorID, result.Reason.InputDescriptorID)
+	})
+
+	t.Run("challenge failed", func(tt *testing.T) {
+		submissionJWT := buildTestSubmissionJWT(tt, signer, requesterID, presentationDefinition, [][]byte{validVCJWT}, nil)
+		result, err := newGate(tt, CredentialGateConfig{RequireChallenge: true}).ValidatePresentationSubmission(context.Background(), submissionJWT)
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonChallengeFailed, result.Reason.Code)
+	})
+
+	t.Run("handler rejected", func(tt *testing.T) {
+		gate := newGate(tt, CredentialGateConfig{
+			CustomHandlers: map[string]CustomHandler{
+				inputDescriptorID: {
+					InputDescriptorID: inputDescriptorID,
+					Handler: func(context.Context, exchange.VerifiedSubmissionData) (bool, error) {
+						return false, nil
+					},
+				},
+			},
+		})
+		submissionJWT := buildTestSubmissionJWT(tt, signer, requesterID, presentationDefinition, [][]byte{validVCJWT}, nil)
+		result, err := gate.ValidatePresentationSubmission(context.Background(), submissionJWT)
+		assert.NoError(tt, err)
+		assert.False(tt, result.Valid)
+		assert.Equal(tt, ReasonHandlerRejected, result.Reason.Code)
+		assert.Equal(tt, inputDescriptorID, result.Reason.InputDescriptorID)
+	})
+
+	t.Run("handler error", func(tt *testing.T) {
+		gate := newGate(tt, CredentialGateConfig{
+			CustomHandlers: map[string]CustomHandler{
+				inputDescriptorID: {
+					InputDescriptorID: inputDescriptorID,
+					Handler: func(context.Context, exchange.VerifiedSubmissionData) (bool, error) {
+						return false, errors.New("upstream unavailable")
+					},
+				},
+			},
+		})
+		submissionJWT := buildTestSubmissionJWT(tt, signer, requesterID, presentationDefinition, [][]byte{validVCJWT}, nil)
+		result, err := gate.ValidatePresentationSubmission(context.Background(), submissionJWT)
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonHandlerError, result.Reason.Code)
+		assert.Equal(tt, inputDescriptorID, result.Reason.InputDescriptorID)
+		assert.Contains(tt, result.Reason.Message, "upstream unavailable")
+	})
+
+	t.Run("valid submission has no reason", func(tt *testing.T) {
+		submissionJWT := buildTestSubmissionJWT(tt, signer, requesterID, presentationDefinition, [][]byte{validVCJWT}, nil)
+		result, err := newGate(tt, CredentialGateConfig{}).ValidatePresentationSubmission(context.Background(), submissionJWT)
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+		assert.Nil(tt, result.Reason)
+	})
+}
+
+func TestUnsupportedPresentationDefinitionFeatures(t *testing.T) {
+	_, err := NewCredentialGate(CredentialGateConfig{
+		AdminDID: "did:test:admin",
+		PresentationDefinition: exchange.PresentationDefinition{
+			ID: uuid.NewString(),
+			InputDescriptors: []exchange.InputDescriptor{
+				{
+					ID: uuid.NewString(),
+					Constraints: &exchange.Constraints{
+						Fields: []exchange.Field{
+							{
+								Path:      []string{"$.vc.credentialSubject.age"},
+								Predicate: exchange.Required.Ptr(),
+								Filter:    &exchange.Filter{Type: "number", Minimum: 21},
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "predicate feature not supported")
+}
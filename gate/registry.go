@@ -0,0 +1,415 @@
+package gate
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// HandlerFactory creates a custom handler for an input descriptor from the parameters it is referenced with, such
+// that handlers can be registered in a HandlerRegistry and referenced by name from configuration. A handler which
+// holds resources, such as a runtime, releases them in its Close.
+type HandlerFactory func(ctx context.Context, inputDescriptorID string, params HandlerParams) (CustomHandler, error)
+
+// ParameterType is the type of a handler parameter's value, as it is represented in JSON
+type ParameterType string
+
+const (
+	ParameterString  ParameterType = "string"
+	ParameterNumber  ParameterType = "number"
+	ParameterBoolean ParameterType = "boolean"
+	ParameterArray   ParameterType = "array"
+	ParameterObject  ParameterType = "object"
+)
+
+// HandlerParameter describes a parameter accepted by a registered handler factory
+type HandlerParameter struct {
+	Name string        `json:"name"`
+	Type ParameterType `json:"type"`
+
+	// Required parameters must be set by every reference to the handler
+	Required bool `json:"required,omitempty"`
+
+	// Default is the value of the parameter when it is not set, if it is not required
+	Default any `json:"default,omitempty"`
+
+	Description string `json:"description,omitempty"`
+}
+
+// HandlerParams are the parameters a handler is referenced with, which have been checked against the parameters
+// its factory was registered with
+type HandlerParams map[string]any
+
+// String returns the value of a string parameter, or the empty string if it is not set
+func (p HandlerParams) String(name string) string {
+	s, _ := p[name].(string)
+	return s
+}
+
+// Number returns the value of a number parameter, or zero if it is not set
+func (p HandlerParams) Number(name string) float64 {
+	value := reflect.ValueOf(p[name])
+	switch {
+	case value.CanFloat():
+		return value.Float()
+	case value.CanInt():
+		return float64(value.Int())
+	case value.CanUint():
+		return float64(value.Uint())
+	}
+	return 0
+}
+
+// Bool returns the value of a boolean parameter, or false if it is not set
+func (p HandlerParams) Bool(name string) bool {
+	b, _ := p[name].(bool)
+	return b
+}
+
+// Strings returns the string values of an array parameter
+func (p HandlerParams) Strings(name string) []string {
+	value := reflect.ValueOf(p[name])
+	if value.Kind() != reflect.Slice {
+		return nil
+	}
+	strs := make([]string, 0, value.Len())
+	for i := 0; i < value.Len(); i++ {
+		if s, ok := value.Index(i).Interface().(string); ok {
+			strs = append(strs, s)
+		}
+	}
+	return strs
+}
+
+// HandlerReference references a registered custom handler by name, along with the parameters to create it with
+type HandlerReference struct {
+	// Handler is the name the handler's factory is registered under
+	Handler string `json:"handler" validate:"required"`
+
+	// Params are the parameters the handler is created with
+	Params map[string]any `json:"params,omitempty"`
+
+	// Match and MinMatches, if set, override the match policy of the created handler
+	Match      MatchPolicy `json:"match,omitempty"`
+	MinMatches int         `json:"minMatches,omitempty"`
+
+	// Timeout, such as "2s", if set, bounds each call of the created handler
+	Timeout string `json:"timeout,omitempty"`
+
+	// Retry, if set, retries calls of the created handler which error transiently
+	Retry *RetryReference `json:"retry,omitempty"`
+
+	// CircuitBreaker, if set, stops calling the created handler after repeated errors
+	CircuitBreaker *CircuitBreakerReference `json:"circuitBreaker,omitempty"`
+}
+
+// RetryReference is a RetryPolicy with its delays given as durations such as "100ms"
+type RetryReference struct {
+	MaxAttempts int    `json:"maxAttempts,omitempty"`
+	Backoff     string `json:"backoff,omitempty"`
+	MaxBackoff  string `json:"maxBackoff,omitempty"`
+}
+
+// CircuitBreakerReference is a CircuitBreakerConfig with its cooldown given as a duration such as "30s"
+type CircuitBreakerReference struct {
+	FailureThreshold int    `json:"failureThreshold"`
+	Cooldown         string `json:"cooldown,omitempty"`
+	FailOpen         bool   `json:"failOpen,omitempty"`
+}
+
+type registeredHandler struct {
+	factory HandlerFactory
+	params  []HandlerParameter
+
+	// validate, if set, checks the parameters of a reference more closely than their types, without creating the
+	// handler
+	validate func(params HandlerParams) error
+}
+
+// HandlerRegistry holds handler factories by name, so gates can be composed from configuration out of a library of
+// vetted handlers. It is safe for concurrent use.
+type HandlerRegistry struct {
+	mu       sync.RWMutex
+	handlers map[string]registeredHandler
+}
+
+// NewHandlerRegistry creates a handler registry holding only the built-in expression, WebAssembly, and webhook
+// handlers
+func NewHandlerRegistry() *HandlerRegistry {
+	return &HandlerRegistry{handlers: map[string]registeredHandler{
+		ExpressionHandlerName: {
+			factory:  newExpressionHandler,
+			validate: validateExpressionHandler,
+			params: []HandlerParameter{{
+				Name:        expressionParam,
+				Type:        ParameterString,
+				Required:    true,
+				Description: "CEL expression which must evaluate to true for a credential to be accepted",
+			}},
+		},
+		WASMHandlerName: {
+			factory: newWASMHandler,
+			params: []HandlerParameter{
+				{Name: "modulePath", Type: ParameterString, Required: true, Description: "path of the WebAssembly module"},
+				{Name: "function", Type: ParameterString, Description: "name of the exported handler function"},
+				{Name: "memoryLimitPages", Type: ParameterNumber, Description: "most memory, in 64KiB pages, the module may use"},
+				{Name: "timeout", Type: ParameterString, Description: "how long each evaluation may run for, such as 500ms"},
+			},
+		},
+		WebhookHandlerName: {
+			factory: newWebhookHandler,
+			params: []HandlerParameter{
+				{Name: "url", Type: ParameterString, Required: true, Description: "URL the submission data is POSTed to"},
+				{Name: "timeout", Type: ParameterString, Description: "how long each request may take, such as 2s"},
+			},
+		},
+	}}
+}
+
+// Register registers a handler factory under a name along with the parameters it accepts
+func (r *HandlerRegistry) Register(name string, factory HandlerFactory, params ...HandlerParameter) error {
+	if name == "" {
+		return errors.New("handler name is required")
+	}
+	if factory == nil {
+		return errors.Errorf("handler<%s> has no factory", name)
+	}
+	names := make(map[string]bool, len(params))
+	for _, param := range params {
+		if param.Name == "" {
+			return errors.Errorf("handler<%s> has a parameter without a name", name)
+		}
+		if names[param.Name] {
+			return errors.Errorf("handler<%s> has duplicate parameter<%s>", name, param.Name)
+		}
+		names[param.Name] = true
+		if !param.Type.isKnown() {
+			return errors.Errorf("handler<%s> parameter<%s> has unknown type: %s", name, param.Name, param.Type)
+		}
+		if param.Default != nil && !param.Type.matches(param.Default) {
+			return errors.Errorf("handler<%s> parameter<%s> default is not of type %s", name, param.Name, param.Type)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.handlers[name]; ok {
+		return errors.Errorf("handler<%s> is already registered", name)
+	}
+	r.handlers[name] = registeredHandler{factory: factory, params: params}
+	return nil
+}
+
+// Names returns the names of all registered handlers, sorted
+func (r *HandlerRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.handlers))
+	for name := range r.handlers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Parameters returns the parameters accepted by a registered handler
+func (r *HandlerRegistry) Parameters(name string) ([]HandlerParameter, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	handler, ok := r.handlers[name]
+	return handler.params, ok
+}
+
+// Create creates the handler a reference names for an input descriptor, after checking the reference's parameters
+// against those the handler was registered with
+func (r *HandlerRegistry) Create(ctx context.Context, inputDescriptorID string, reference HandlerReference) (*CustomHandler, error) {
+	handler, params, err := r.lookup(reference)
+	if err != nil {
+		return nil, err
+	}
+	ch, err := handler.factory(ctx, inputDescriptorID, params)
+	if err != nil {
+		return nil, errors.Wrapf(err, "creating handler<%s>", reference.Handler)
+	}
+	if err = reference.configure(inputDescriptorID, &ch); err != nil {
+		if ch.Close != nil {
+			_ = ch.Close(ctx)
+		}
+		return nil, err
+	}
+	return &ch, nil
+}
+
+// Check checks a reference names a registered handler and is made with parameters, a match policy, and resilience
+// settings it accepts, without creating the handler
+func (r *HandlerRegistry) Check(reference HandlerReference) error {
+	handler, params, err := r.lookup(reference)
+	if err != nil {
+		return err
+	}
+	if handler.validate != nil {
+		if err = handler.validate(params); err != nil {
+			return errors.Wrapf(err, "handler<%s>", reference.Handler)
+		}
+	}
+	switch reference.Match {
+	case "", MatchAll, MatchAny, MatchAtLeast:
+	default:
+		return errors.Errorf("handler<%s>: unknown match policy: %s", reference.Handler, reference.Match)
+	}
+	if reference.MinMatches < 0 {
+		return errors.Errorf("handler<%s>: minMatches<%d> is negative", reference.Handler, reference.MinMatches)
+	}
+	var ch CustomHandler
+	if err := reference.applyResilience(&ch); err != nil {
+		return errors.Wrapf(err, "handler<%s>", reference.Handler)
+	}
+	if ch.Timeout < 0 {
+		return errors.Errorf("handler<%s>: timeout<%s> is negative", reference.Handler, ch.Timeout)
+	}
+	if ch.Retry != nil {
+		if err := ch.Retry.IsValid(); err != nil {
+			return errors.Wrapf(err, "handler<%s>: invalid retry policy", reference.Handler)
+		}
+	}
+	return nil
+}
+
+// lookup returns the registered handler a reference names, along with the reference's checked parameters
+func (r *HandlerRegistry) lookup(reference HandlerReference) (registeredHandler, HandlerParams, error) {
+	r.mu.RLock()
+	handler, ok := r.handlers[reference.Handler]
+	r.mu.RUnlock()
+	if !ok {
+		return handler, nil, errors.Errorf("unknown handler<%s>", reference.Handler)
+	}
+	params, err := handler.checkParams(reference.Params)
+	if err != nil {
+		return handler, nil, errors.Wrapf(err, "handler<%s>", reference.Handler)
+	}
+	return handler, params, nil
+}
+
+// configure applies the match policy and resilience settings of the reference to the handler created for it, and
+// checks the result is a valid handler for the input descriptor
+func (reference HandlerReference) configure(inputDescriptorID string, ch *CustomHandler) error {
+	if reference.Match != "" {
+		ch.Match = reference.Match
+	}
+	if reference.MinMatches != 0 {
+		ch.MinMatches = reference.MinMatches
+	}
+	if err := reference.applyResilience(ch); err != nil {
+		return errors.Wrapf(err, "handler<%s>", reference.Handler)
+	}
+	if ch.InputDescriptorID != inputDescriptorID {
+		return errors.Errorf("handler<%s> created for input descriptor ID %s, expected %s", reference.Handler, ch.InputDescriptorID, inputDescriptorID)
+	}
+	if err := ch.IsValid(); err != nil {
+		return errors.Wrapf(err, "invalid handler<%s>", reference.Handler)
+	}
+	return nil
+}
+
+// applyResilience sets the timeout, retry policy, and circuit breaker of the reference, if any, on the created handler
+func (reference HandlerReference) applyResilience(ch *CustomHandler) error {
+	var err error
+	if reference.Timeout != "" {
+		if ch.Timeout, err = time.ParseDuration(reference.Timeout); err != nil {
+			return errors.Wrap(err, "timeout")
+		}
+	}
+	if retry := reference.Retry; retry != nil {
+		policy := RetryPolicy{MaxAttempts: retry.MaxAttempts}
+		if retry.Backoff != "" {
+			if policy.Backoff, err = time.ParseDuration(retry.Backoff); err != nil {
+				return errors.Wrap(err, "retry.backoff")
+			}
+		}
+		if retry.MaxBackoff != "" {
+			if policy.MaxBackoff, err = time.ParseDuration(retry.MaxBackoff); err != nil {
+				return errors.Wrap(err, "retry.maxBackoff")
+			}
+		}
+		ch.Retry = &policy
+	}
+	if breaker := reference.CircuitBreaker; breaker != nil {
+		config := CircuitBreakerConfig{FailureThreshold: breaker.FailureThreshold, FailOpen: breaker.FailOpen}
+		if breaker.Cooldown != "" {
+			if config.Cooldown, err = time.ParseDuration(breaker.Cooldown); err != nil {
+				return errors.Wrap(err, "circuitBreaker.cooldown")
+			}
+		}
+		if ch.CircuitBreaker, err = NewCircuitBreaker(config); err != nil {
+			return errors.Wrap(err, "circuitBreaker")
+		}
+	}
+	return nil
+}
+
+// checkParams makes sure each parameter is accepted by the handler and of its type, and each required parameter
+// is set, returning the parameters with defaults applied
+func (h registeredHandler) checkParams(params map[string]any) (HandlerParams, error) {
+	accepted := make(map[string]HandlerParameter, len(h.params))
+	for _, param := range h.params {
+		accepted[param.Name] = param
+	}
+	checked := make(HandlerParams, len(h.params))
+	for name, value := range params {
+		param, ok := accepted[name]
+		if !ok {
+			return nil, errors.Errorf("unknown parameter<%s>", name)
+		}
+		if !param.Type.matches(value) {
+			return nil, errors.Errorf("parameter<%s> is not of type %s", name, param.Type)
+		}
+		checked[name] = value
+	}
+	for _, param := range h.params {
+		if _, ok := checked[param.Name]; ok {
+			continue
+		}
+		if param.Required {
+			return nil, errors.Errorf("missing required parameter<%s>", param.Name)
+		}
+		if param.Default != nil {
+			checked[param.Name] = param.Default
+		}
+	}
+	return checked, nil
+}
+
+func (t ParameterType) isKnown() bool {
+	switch t {
+	case ParameterString, ParameterNumber, ParameterBoolean, ParameterArray, ParameterObject:
+		return true
+	}
+	return false
+}
+
+// matches returns whether a value, either unmarshalled from JSON or set in Go, is of the type
+func (t ParameterType) matches(value any) bool {
+	kind := reflect.ValueOf(value).Kind()
+	switch t {
+	case ParameterString:
+		return kind == reflect.String
+	case ParameterNumber:
+		switch kind {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			return true
+		}
+	case ParameterBoolean:
+		return kind == reflect.Bool
+	case ParameterArray:
+		return kind == reflect.Slice || kind == reflect.Array
+	case ParameterObject:
+		return kind == reflect.Map || kind == reflect.Struct
+	}
+	return false
+}
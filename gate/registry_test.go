@@ -0,0 +1,220 @@
+package gate
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/TBD54566975/ssi-sdk/credential"
+	"github.com/TBD54566975/ssi-sdk/credential/exchange"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestClaimHandler is a handler factory whose handler accepts credentials whose subject has the claim parameter
+// set to one of the values parameter
+func newTestClaimHandler(_ context.Context, inputDescriptorID string, params HandlerParams) (CustomHandler, error) {
+	claim, values := params.String("claim"), params.Strings("values")
+	return CustomHandler{
+		InputDescriptorID: inputDescriptorID,
+		Handler: func(_ context.Context, vsd exchange.VerifiedSubmissionData) (bool, error) {
+			_, _, cred, err := credential.ToCredential(vsd.Claim)
+			if err != nil {
+				return false, err
+			}
+			for _, value := range values {
+				if cred.CredentialSubject[claim] == value {
+					return true, nil
+				}
+			}
+			return false, nil
+		},
+	}, nil
+}
+
+func TestHandlerRegistry(t *testing.T) {
+	claimParams := []HandlerParameter{
+		{Name: "claim", Type: ParameterString, Required: true},
+		{Name: "values", Type: ParameterArray, Required: true},
+		{Name: "caseSensitive", Type: ParameterBoolean, Default: true},
+	}
+
+	t.Run("register", func(tt *testing.T) {
+		registry := NewHandlerRegistry()
+		assert.NoError(tt, registry.Register("claim", newTestClaimHandler, claimParams...))
+		assert.NoError(tt, registry.Register("any", newTestClaimHandler))
+		assert.Equal(tt, []string{"any", "claim", ExpressionHandlerName, WASMHandlerName, WebhookHandlerName}, registry.Names())
+
+		params, ok := registry.Parameters("claim")
+		assert.True(tt, ok)
+		assert.Equal(tt, claimParams, params)
+
+		err := registry.Register("claim", newTestClaimHandler)
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "already registered")
+
+		assert.Error(tt, registry.Register("", newTestClaimHandler))
+		assert.Error(tt, registry.Register("nil", nil))
+		assert.Error(tt, registry.Register("type", newTestClaimHandler, HandlerParameter{Name: "claim", Type: "date"}))
+		assert.Error(tt, registry.Register("default", newTestClaimHandler, HandlerParameter{Name: "claim", Type: ParameterString, Default: 1}))
+		assert.Error(tt, registry.Register("duplicate", newTestClaimHandler, claimParams[0], claimParams[0]))
+	})
+
+	t.Run("create", func(tt *testing.T) {
+		registry := NewHandlerRegistry()
+		var created HandlerParams
+		require.NoError(tt, registry.Register("claim", func(ctx context.Context, inputDescriptorID string, params HandlerParams) (CustomHandler, error) {
+			created = params
+			return newTestClaimHandler(ctx, inputDescriptorID, params)
+		}, claimParams...))
+
+		ch, err := registry.Create(context.Background(), "country", HandlerReference{
+			Handler: "claim",
+			Params:  map[string]any{"claim": "country", "values": []any{"US", "CA"}},
+			Match:   MatchAny,
+		})
+		assert.NoError(tt, err)
+		assert.Equal(tt, "country", ch.InputDescriptorID)
+		assert.Equal(tt, MatchAny, ch.Match)
+		assert.Equal(tt, []string{"US", "CA"}, created.Strings("values"))
+		assert.True(tt, created.Bool("caseSensitive"))
+
+		_, err = registry.Create(context.Background(), "country", HandlerReference{Handler: "unknown"})
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "unknown handler<unknown>")
+
+		_, err = registry.Create(context.Background(), "country", HandlerReference{Handler: "claim", Params: map[string]any{"claim": "country"}})
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "missing required parameter<values>")
+
+		_, err = registry.Create(context.Background(), "country", HandlerReference{Handler: "claim", Params: map[string]any{"claim": 1, "values": []any{}}})
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "parameter<claim> is not of type string")
+
+		_, err = registry.Create(context.Background(), "country", HandlerReference{Handler: "claim", Params: map[string]any{"claim": "country", "values": []any{}, "other": true}})
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "unknown parameter<other>")
+	})
+
+	t.Run("gate with registered handlers", func(tt *testing.T) {
+		registry := NewHandlerRegistry()
+		require.NoError(tt, registry.Register("claim", newTestClaimHandler, claimParams...))
+
+		requesterID := "did:test:admin"
+		def := exchange.PresentationDefinition{
+			ID: "country-definition",
+			InputDescriptors: []exchange.InputDescriptor{{
+				ID:          "country",
+				Constraints: &exchange.Constraints{Fields: []exchange.Field{{Path: []string{"$.vc.credentialSubject.country"}}}},
+			}},
+		}
+		config := CredentialGateConfig{
+			AdminDID:               requesterID,
+			PresentationDefinition: def,
+			HandlerRegistry:        registry,
+			Handlers: map[string]HandlerReference{
+				"country": {Handler: "claim", Params: map[string]any{"claim": "country", "values": []string{"US", "CA"}}},
+			},
+		}
+		gate, err := NewCredentialGate(config)
+		require.NoError(tt, err)
+
+		signer := newTestSigner(tt)
+		buildSubmission := func(country string) string {
+			vcJWT, err := credential.SignVerifiableCredentialJWT(signer, credential.VerifiableCredential{
+				Context:           []any{"https://www.w3.org/2018/credentials/v1"},
+				Type:              []string{"VerifiableCredential"},
+				Issuer:            signer.ID,
+				IssuanceDate:      time.Now().Format(time.RFC3339),
+				CredentialSubject: map[string]any{"id": signer.ID, "country": country},
+			})
+			require.NoError(tt, err)
+			return buildTestSubmissionJWT(tt, signer, requesterID, def, [][]byte{vcJWT}, nil)
+		}
+
+		result, err := gate.ValidatePresentationSubmission(context.Background(), buildSubmission("CA"))
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+
+		result, err = gate.ValidatePresentationSubmission(context.Background(), buildSubmission("FR"))
+		assert.NoError(tt, err)
+		assert.False(tt, result.Valid)
+		assert.Equal(tt, ReasonHandlerRejected, result.Reason.Code)
+
+		// handlers can only be referenced with a registry, and not for an input descriptor with a custom handler
+		withoutRegistry := config
+		withoutRegistry.HandlerRegistry = nil
+		_, err = NewCredentialGate(withoutRegistry)
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "handlers referenced without a handler registry")
+
+		withCustomHandler := config
+		withCustomHandler.CustomHandlers = map[string]CustomHandler{"country": {
+			InputDescriptorID: "country",
+			Handler: func(context.Context, exchange.VerifiedSubmissionData) (bool, error) {
+				return true, nil
+			},
+		}}
+		_, err = NewCredentialGate(withCustomHandler)
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "handlers.country: input descriptor ID also has a custom handler")
+
+		invalidParams := config
+		invalidParams.Handlers = map[string]HandlerReference{"country": {Handler: "claim"}}
+		_, err = NewCredentialGate(invalidParams)
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "handlers.country")
+	})
+	t.Run("handlers created once and closed with the gate", func(tt *testing.T) {
+		var created, closed int
+		registry := NewHandlerRegistry()
+		require.NoError(tt, registry.Register("counted", func(ctx context.Context, inputDescriptorID string, params HandlerParams) (CustomHandler, error) {
+			if params.Bool("fail") {
+				return CustomHandler{}, errors.New("failed to create handler")
+			}
+			ch, err := newTestClaimHandler(ctx, inputDescriptorID, params)
+			created++
+			ch.Close = func(context.Context) error {
+				closed++
+				return nil
+			}
+			return ch, err
+		}, append(claimParams, HandlerParameter{Name: "fail", Type: ParameterBoolean})...))
+
+		def := exchange.PresentationDefinition{
+			ID: "country-definition",
+			InputDescriptors: []exchange.InputDescriptor{
+				{ID: "country", Constraints: &exchange.Constraints{Fields: []exchange.Field{{Path: []string{"$.vc.credentialSubject.country"}}}}},
+				{ID: "region", Constraints: &exchange.Constraints{Fields: []exchange.Field{{Path: []string{"$.vc.credentialSubject.region"}}}}},
+			},
+		}
+		config := CredentialGateConfig{
+			AdminDID:               "did:test:admin",
+			PresentationDefinition: def,
+			HandlerRegistry:        registry,
+			Handlers: map[string]HandlerReference{
+				"country": {Handler: "counted", Params: map[string]any{"claim": "country", "values": []string{"US"}}},
+				"region":  {Handler: "counted", Params: map[string]any{"claim": "region", "values": []string{"CA"}}},
+			},
+		}
+
+		// validating the config does not create its handlers
+		require.NoError(tt, config.IsValid())
+		assert.Equal(tt, 0, created)
+
+		gate, err := NewCredentialGate(config)
+		require.NoError(tt, err)
+		assert.Equal(tt, 2, created)
+		assert.NoError(tt, gate.Close(context.Background()))
+		assert.Equal(tt, 2, closed)
+
+		// handlers already created are closed when another cannot be
+		created, closed = 0, 0
+		config.Handlers["region"] = HandlerReference{Handler: "counted", Params: map[string]any{"claim": "region", "values": []string{"CA"}, "fail": true}}
+		_, err = NewCredentialGate(config)
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "failed to create handler")
+		assert.Equal(tt, created, closed)
+	})
+}
@@ -0,0 +1,119 @@
+package gate
+
+import (
+	"encoding/json"
+	"strings"
+
+	didsdk "github.com/TBD54566975/ssi-sdk/did"
+	"github.com/pkg/errors"
+)
+
+// VerificationRelationship is a relationship between a DID and the verification methods in its DID Document
+// https://www.w3.org/TR/did-core/#verification-relationships
+type VerificationRelationship string
+
+const (
+	AuthenticationRelationship       VerificationRelationship = "authentication"
+	AssertionMethodRelationship      VerificationRelationship = "assertionMethod"
+	CapabilityInvocationRelationship VerificationRelationship = "capabilityInvocation"
+	CapabilityDelegationRelationship VerificationRelationship = "capabilityDelegation"
+)
+
+// IsValid checks the relationship is one whose keys may sign a presentation. Key agreement keys are not for signing.
+func (vr VerificationRelationship) IsValid() error {
+	switch vr {
+	case "", AuthenticationRelationship, AssertionMethodRelationship, CapabilityInvocationRelationship, CapabilityDelegationRelationship:
+		return nil
+	}
+	return errors.Errorf("unsupported verification relationship: %s", vr)
+}
+
+func (vr VerificationRelationship) methods(doc didsdk.Document) []didsdk.VerificationMethodSet {
+	switch vr {
+	case AuthenticationRelationship:
+		return doc.Authentication
+	case AssertionMethodRelationship:
+		return doc.AssertionMethod
+	case CapabilityInvocationRelationship:
+		return doc.CapabilityInvocation
+	case CapabilityDelegationRelationship:
+		return doc.CapabilityDelegation
+	}
+	return nil
+}
+
+// getRelationshipDocument finds the verification method identified by kid in the given verification relationship
+// of a DID Document. A document holding only that verification method is returned, so that the key can be taken
+// from it whether the method is embedded in the relationship or referenced from the document's verification methods.
+func getRelationshipDocument(doc didsdk.Document, relationship VerificationRelationship, kid string) (*didsdk.Document, error) {
+	for _, methodSet := range relationship.methods(doc) {
+		switch method := methodSet.(type) {
+		case string:
+			if !matchesKID(doc.ID, kid, method) {
+				continue
+			}
+			for _, vm := range doc.VerificationMethod {
+				if matchesKID(doc.ID, kid, vm.ID) {
+					return &didsdk.Document{ID: doc.ID, VerificationMethod: []didsdk.VerificationMethod{vm}}, nil
+				}
+			}
+			return nil, newDenial(ReasonKeyNotFound, errors.Errorf("key<%s> referenced by %s is not in DID<%s>", kid, relationship, doc.ID))
+		default:
+			vm, err := toVerificationMethod(method)
+			if err != nil {
+				return nil, errors.Wrapf(err, "parsing %s of DID<%s>", relationship, doc.ID)
+			}
+			if matchesKID(doc.ID, kid, vm.ID) {
+				return &didsdk.Document{ID: doc.ID, VerificationMethod: []didsdk.VerificationMethod{*vm}}, nil
+			}
+		}
+	}
+	return nil, newDenial(ReasonKeyNotAuthorized, errors.Errorf("key<%s> is not in the %s verification relationship of DID<%s>", kid, relationship, doc.ID))
+}
+
+// toVerificationMethod converts a verification method embedded in a verification relationship, which is either a
+// VerificationMethod or, if the DID Document was unmarshalled from JSON, a map
+func toVerificationMethod(maybeMethod any) (*didsdk.VerificationMethod, error) {
+	switch method := maybeMethod.(type) {
+	case didsdk.VerificationMethod:
+		return &method, nil
+	case *didsdk.VerificationMethod:
+		return method, nil
+	}
+	methodBytes, err := json.Marshal(maybeMethod)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshalling verification method")
+	}
+	var method didsdk.VerificationMethod
+	if err = json.Unmarshal(methodBytes, &method); err != nil {
+		return nil, errors.Wrap(err, "unmarshalling verification method")
+	}
+	return &method, nil
+}
+
+// matchesKID returns whether a kid and a verification method ID identify the same verification method of a DID,
+// where either may be a DID URL, a fragment with a leading #, or a bare fragment
+func matchesKID(did, kid, id string) bool {
+	return toDIDURL(did, kid) == toDIDURL(did, id)
+}
+
+func toDIDURL(did, id string) string {
+	switch {
+	case strings.HasPrefix(id, "#"):
+		return did + id
+	case strings.HasPrefix(id, "did:"):
+		return id
+	default:
+		return did + "#" + id
+	}
+}
+
+// kidBelongsTo returns whether a kid identifies a verification method of the given DID; a kid that is not
+// a DID URL is relative to the signer's DID
+func kidBelongsTo(kid, did string) bool {
+	if !strings.HasPrefix(kid, "did:") {
+		return true
+	}
+	kidDID, _, _ := strings.Cut(kid, "#")
+	return kidDID == did
+}
@@ -0,0 +1,134 @@
+package gate
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/TBD54566975/ssi-sdk/credential"
+	"github.com/TBD54566975/ssi-sdk/credential/exchange"
+	"github.com/TBD54566975/ssi-sdk/crypto/jwx"
+	"github.com/google/uuid"
+	"github.com/mr-tron/base58"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestPresentationKeyRelationship(t *testing.T) {
+	requesterID := "did:test:admin"
+	presentationDefinition := exchange.PresentationDefinition{
+		ID: uuid.New().String(),
+		InputDescriptors: []exchange.InputDescriptor{
+			{
+				ID: "name",
+				Constraints: &exchange.Constraints{
+					Fields: []exchange.Field{{Path: []string{"$.vc.credentialSubject.name"}}},
+				},
+			},
+		},
+	}
+
+	// the submitter's did:web document lists its only key in the assertionMethod relationship, by reference,
+	// and embeds a second key in the authentication relationship
+	submitterDID := "did:web:submitter.example.com"
+	pubKey, privKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	authPubKey, authPrivKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	doc := map[string]any{
+		"id": submitterDID,
+		"verificationMethod": []any{map[string]any{
+			"id":              submitterDID + "#assertion-key",
+			"type":            "Ed25519VerificationKey2018",
+			"controller":      submitterDID,
+			"publicKeyBase58": base58.Encode(pubKey),
+		}},
+		"assertionMethod": []any{"#assertion-key"},
+		"authentication": []any{map[string]any{
+			"id":              submitterDID + "#auth-key",
+			"type":            "Ed25519VerificationKey2018",
+			"controller":      submitterDID,
+			"publicKeyBase58": base58.Encode(authPubKey),
+		}},
+	}
+	docBytes, err := json.Marshal(map[string]any{"didDocument": doc})
+	require.NoError(t, err)
+	defer gock.Off()
+	gock.New("https://submitter.example.com").
+		Get("/.well-known/did.json").
+		Persist().
+		Reply(200).
+		BodyString(string(docBytes))
+
+	issuer := newTestSigner(t)
+	vcJWT, err := credential.SignVerifiableCredentialJWT(issuer, credential.VerifiableCredential{
+		Context:           []any{"https://www.w3.org/2018/credentials/v1"},
+		Type:              []string{"VerifiableCredential"},
+		Issuer:            issuer.ID,
+		IssuanceDate:      time.Now().Format(time.RFC3339),
+		CredentialSubject: map[string]any{"id": submitterDID, "name": "Satoshi"},
+	})
+	require.NoError(t, err)
+
+	validate := func(t *testing.T, relationship VerificationRelationship, signer jwx.Signer) (*Result, error) {
+		gate, err := NewCredentialGate(CredentialGateConfig{
+			AdminDID:                    requesterID,
+			PresentationDefinition:      presentationDefinition,
+			PresentationKeyRelationship: relationship,
+		})
+		require.NoError(t, err)
+		submissionJWT := buildTestSubmissionJWT(t, signer, requesterID, presentationDefinition, [][]byte{vcJWT}, nil)
+		return gate.ValidatePresentationSubmission(context.Background(), submissionJWT)
+	}
+	assertionSigner, err := jwx.NewJWXSigner(submitterDID, "#assertion-key", privKey)
+	require.NoError(t, err)
+	authSigner, err := jwx.NewJWXSigner(submitterDID, submitterDID+"#auth-key", authPrivKey)
+	require.NoError(t, err)
+
+	t.Run("authentication key", func(tt *testing.T) {
+		result, err := validate(tt, "", *authSigner)
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+	})
+
+	t.Run("assertion method key not authorized by default", func(tt *testing.T) {
+		result, err := validate(tt, "", *assertionSigner)
+		assert.Error(tt, err)
+		assert.False(tt, result.Valid)
+		assert.Equal(tt, ReasonKeyNotAuthorized, result.Reason.Code)
+		assert.Contains(tt, result.Reason.Message, "authentication verification relationship")
+	})
+
+	t.Run("assertion method key with configured relationship", func(tt *testing.T) {
+		result, err := validate(tt, AssertionMethodRelationship, *assertionSigner)
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+
+		result, err = validate(tt, AssertionMethodRelationship, *authSigner)
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonKeyNotAuthorized, result.Reason.Code)
+	})
+
+	t.Run("key of another DID", func(tt *testing.T) {
+		other := newTestSigner(tt)
+		other.ID = submitterDID
+		result, err := validate(tt, "", other)
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonKeyNotAuthorized, result.Reason.Code)
+		assert.Contains(tt, result.Reason.Message, "does not belong to the submitter's DID")
+	})
+
+	t.Run("key agreement relationship", func(tt *testing.T) {
+		_, err := NewCredentialGate(CredentialGateConfig{
+			AdminDID:                    requesterID,
+			PresentationDefinition:      presentationDefinition,
+			PresentationKeyRelationship: "keyAgreement",
+		})
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "unsupported verification relationship")
+	})
+}
@@ -0,0 +1,180 @@
+package gate
+
+import (
+	"github.com/TBD54566975/ssi-sdk/credential"
+	"github.com/TBD54566975/ssi-sdk/credential/exchange"
+	"github.com/pkg/errors"
+)
+
+// checkSubmissionRequirements makes sure each submission requirement draws from a group of input descriptors
+// which exists in the presentation definition
+func checkSubmissionRequirements(def exchange.PresentationDefinition) error {
+	groups := getInputDescriptorGroups(def)
+	var check func(requirements []exchange.SubmissionRequirement) error
+	check = func(requirements []exchange.SubmissionRequirement) error {
+		for _, requirement := range requirements {
+			if requirement.From == "" {
+				if err := check(requirement.FromNested); err != nil {
+					return err
+				}
+				continue
+			}
+			if _, ok := groups[requirement.From]; !ok {
+				return errors.Errorf("submission requirement<%s> is from unknown group %s", requirement.Name, requirement.From)
+			}
+		}
+		return nil
+	}
+	return check(def.SubmissionRequirements)
+}
+
+// getInputDescriptorGroups returns the IDs of the input descriptors in each group, in definition order
+func getInputDescriptorGroups(def exchange.PresentationDefinition) map[string][]string {
+	groups := make(map[string][]string)
+	for _, inputDescriptor := range def.InputDescriptors {
+		for _, group := range inputDescriptor.Group {
+			groups[group] = append(groups[group], inputDescriptor.ID)
+		}
+	}
+	return groups
+}
+
+// verifySubmissionRequirements verifies a presentation submission against a presentation definition with
+// submission requirements. Each submission descriptor is verified on its own, and the submission requirements
+// are evaluated over the input descriptors which were fulfilled. Only the input descriptors submitted under a
+// satisfied requirement are kept: the VP's presentation submission is narrowed to them, so later stages ignore
+// credentials submitted for unsatisfied optional requirements, and only their submission data is returned.
+func verifySubmissionRequirements(def exchange.PresentationDefinition, vp *credential.VerifiablePresentation) ([]exchange.VerifiedSubmissionData, error) {
+	submission, err := getPresentationSubmission(def, *vp)
+	if err != nil {
+		return nil, err
+	}
+	inputDescriptors := make(map[string]exchange.InputDescriptor)
+	for _, inputDescriptor := range def.InputDescriptors {
+		inputDescriptors[inputDescriptor.ID] = inputDescriptor
+	}
+
+	verified := make(map[string][]exchange.VerifiedSubmissionData)
+	failures := make(map[string]error)
+	for _, d := range submission.DescriptorMap {
+		inputDescriptor, ok := inputDescriptors[d.ID]
+		if !ok {
+			return nil, newDenial(ReasonInvalidSubmission, errors.Errorf("submission descriptor<%s> is not for an input descriptor of presentation definition<%s>", d.ID, def.ID))
+		}
+		data, err := verifySubmissionDescriptor(def.ID, inputDescriptor, d, *vp)
+		if err != nil {
+			if _, ok := failures[d.ID]; !ok {
+				failures[d.ID] = newInputDescriptorDenial(ReasonConstraintFailed, d.ID, findFailedField(def.ID, inputDescriptor, d, *vp),
+					errors.Wrapf(err, "verifying submission descriptor<%s> with path: %s", d.ID, d.Path))
+			}
+			continue
+		}
+		verified[d.ID] = append(verified[d.ID], data...)
+	}
+
+	groups := getInputDescriptorGroups(def)
+	fulfilled := make(map[string]bool, len(verified))
+	for id := range verified {
+		fulfilled[id] = true
+	}
+	selected := make(map[string]bool)
+	for _, requirement := range def.SubmissionRequirements {
+		requirementSelected, satisfied := evaluateSubmissionRequirement(requirement, groups, fulfilled)
+		if !satisfied {
+			return nil, submissionRequirementDenial(requirement, groups, failures)
+		}
+		for _, id := range requirementSelected {
+			selected[id] = true
+		}
+	}
+
+	var selectedDescriptors []exchange.SubmissionDescriptor
+	for _, d := range submission.DescriptorMap {
+		if selected[d.ID] && verified[d.ID] != nil {
+			selectedDescriptors = append(selectedDescriptors, d)
+		}
+	}
+	submission.DescriptorMap = selectedDescriptors
+	vp.PresentationSubmission = *submission
+
+	var allVerified []exchange.VerifiedSubmissionData
+	for _, inputDescriptor := range def.InputDescriptors {
+		if selected[inputDescriptor.ID] {
+			allVerified = append(allVerified, verified[inputDescriptor.ID]...)
+		}
+	}
+	return allVerified, nil
+}
+
+// evaluateSubmissionRequirement evaluates a submission requirement over the fulfilled input descriptors, as per
+// https://identity.foundation/presentation-exchange/#submission-requirement-rules, returning whether it is
+// satisfied and, if so, the fulfilled input descriptors it selects. A requirement from a group selects every
+// fulfilled input descriptor of the group, and a requirement from nested requirements selects those of each
+// nested requirement which is satisfied.
+func evaluateSubmissionRequirement(requirement exchange.SubmissionRequirement, groups map[string][]string, fulfilled map[string]bool) ([]string, bool) {
+	var selected []string
+	var satisfiedCount, total int
+	if requirement.From != "" {
+		members := groups[requirement.From]
+		total = len(members)
+		for _, id := range members {
+			if fulfilled[id] {
+				selected = append(selected, id)
+				satisfiedCount++
+			}
+		}
+	} else {
+		total = len(requirement.FromNested)
+		for _, nested := range requirement.FromNested {
+			if nestedSelected, ok := evaluateSubmissionRequirement(nested, groups, fulfilled); ok {
+				selected = append(selected, nestedSelected...)
+				satisfiedCount++
+			}
+		}
+	}
+
+	switch requirement.Rule {
+	case exchange.All:
+		if satisfiedCount != total {
+			return nil, false
+		}
+	case exchange.Pick:
+		if requirement.Count > 0 && satisfiedCount != requirement.Count {
+			return nil, false
+		}
+		if requirement.Minimum > 0 && satisfiedCount < requirement.Minimum {
+			return nil, false
+		}
+		if requirement.Maximum > 0 && satisfiedCount > requirement.Maximum {
+			return nil, false
+		}
+	default:
+		return nil, false
+	}
+	return selected, true
+}
+
+// submissionRequirementDenial explains why a submission requirement is not satisfied, naming an input descriptor
+// under the requirement whose submitted credential failed its constraints, if there is one
+func submissionRequirementDenial(requirement exchange.SubmissionRequirement, groups map[string][]string, failures map[string]error) error {
+	err := errors.Errorf("submission requirement<%s> is not satisfied", requirement.Name)
+	for _, id := range getRequirementInputDescriptors(requirement, groups) {
+		if failure, ok := failures[id]; ok {
+			reason := getReason(failure)
+			return newInputDescriptorDenial(ReasonConstraintFailed, id, reason.FieldPath, errors.Wrap(failure, err.Error()))
+		}
+	}
+	return newDenial(ReasonConstraintFailed, err)
+}
+
+// getRequirementInputDescriptors returns the IDs of all input descriptors a submission requirement draws from
+func getRequirementInputDescriptors(requirement exchange.SubmissionRequirement, groups map[string][]string) []string {
+	if requirement.From != "" {
+		return groups[requirement.From]
+	}
+	var ids []string
+	for _, nested := range requirement.FromNested {
+		ids = append(ids, getRequirementInputDescriptors(nested, groups)...)
+	}
+	return ids
+}
@@ -0,0 +1,176 @@
+package gate
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TBD54566975/ssi-sdk/credential"
+	"github.com/TBD54566975/ssi-sdk/credential/exchange"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubmissionRequirements(t *testing.T) {
+	requesterID := "did:test:admin"
+	inputDescriptor := func(id, path string, groups ...string) exchange.InputDescriptor {
+		return exchange.InputDescriptor{
+			ID:          id,
+			Group:       groups,
+			Constraints: &exchange.Constraints{Fields: []exchange.Field{{Path: []string{path}}}},
+		}
+	}
+	// a passport or a driver's license is required, and an email address is optional
+	def := exchange.PresentationDefinition{
+		ID: uuid.NewString(),
+		InputDescriptors: []exchange.InputDescriptor{
+			inputDescriptor("passport", "$.vc.credentialSubject.passportNumber", "identity"),
+			inputDescriptor("license", "$.vc.credentialSubject.licenseNumber", "identity"),
+			inputDescriptor("email", "$.vc.credentialSubject.email", "contact"),
+		},
+		SubmissionRequirements: []exchange.SubmissionRequirement{
+			{Name: "identity", Rule: exchange.Pick, Count: 1, FromOption: exchange.FromOption{From: "identity"}},
+			{Name: "extras", Rule: exchange.Pick, Minimum: 0, FromOption: exchange.FromOption{FromNested: []exchange.SubmissionRequirement{
+				{Name: "contact", Rule: exchange.All, FromOption: exchange.FromOption{From: "contact"}},
+			}}},
+		},
+	}
+
+	signer := newTestSigner(t)
+	buildVC := func(subject map[string]any) []byte {
+		subject["id"] = signer.ID
+		vcJWT, err := credential.SignVerifiableCredentialJWT(signer, credential.VerifiableCredential{
+			Context:           []any{"https://www.w3.org/2018/credentials/v1"},
+			Type:              []string{"VerifiableCredential"},
+			Issuer:            signer.ID,
+			IssuanceDate:      time.Now().Format(time.RFC3339),
+			CredentialSubject: subject,
+		})
+		require.NoError(t, err)
+		return vcJWT
+	}
+	buildSubmission := func(tt *testing.T, inputDescriptorIDs []string, vcJWTs [][]byte) string {
+		submission := exchange.PresentationSubmission{ID: uuid.NewString(), DefinitionID: def.ID}
+		for i, id := range inputDescriptorIDs {
+			submission.DescriptorMap = append(submission.DescriptorMap, exchange.SubmissionDescriptor{
+				ID:     id,
+				Format: exchange.JWTVC.String(),
+				Path:   fmt.Sprintf("$.verifiableCredential[%d]", i),
+			})
+		}
+		return buildTestPresentationJWT(tt, signer, requesterID, &submission, vcJWTs, nil)
+	}
+	passportVC := buildVC(map[string]any{"passportNumber": "123456"})
+	licenseVC := buildVC(map[string]any{"licenseNumber": "ABC123"})
+	emailVC := buildVC(map[string]any{"email": "satoshi@example.com"})
+
+	// handlers run concurrently, so the handled input descriptors are recorded under a lock
+	var handled []string
+	var handledMu sync.Mutex
+	handler := func(inputDescriptorID string) CustomHandler {
+		return CustomHandler{
+			InputDescriptorID: inputDescriptorID,
+			Handler: func(context.Context, exchange.VerifiedSubmissionData) (bool, error) {
+				handledMu.Lock()
+				defer handledMu.Unlock()
+				handled = append(handled, inputDescriptorID)
+				return true, nil
+			},
+		}
+	}
+	config := CredentialGateConfig{
+		AdminDID:               requesterID,
+		PresentationDefinition: def,
+		CustomHandlers: map[string]CustomHandler{
+			"passport": handler("passport"),
+			"license":  handler("license"),
+			"email":    handler("email"),
+		},
+	}
+
+	t.Run("pick one of a group", func(tt *testing.T) {
+		gate, err := NewCredentialGate(config)
+		require.NoError(tt, err)
+
+		handled = nil
+		submissionJWT := buildSubmission(tt, []string{"license"}, [][]byte{licenseVC})
+		result, err := gate.ValidatePresentationSubmission(context.Background(), submissionJWT)
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+		assert.ElementsMatch(tt, []string{"license"}, handled)
+
+		handled = nil
+		submissionJWT = buildSubmission(tt, []string{"passport", "email"}, [][]byte{passportVC, emailVC})
+		result, err = gate.ValidatePresentationSubmission(context.Background(), submissionJWT)
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+		assert.ElementsMatch(tt, []string{"passport", "email"}, handled)
+	})
+
+	t.Run("pick count not met", func(tt *testing.T) {
+		gate, err := NewCredentialGate(config)
+		require.NoError(tt, err)
+
+		// both identity credentials are submitted, but exactly one must be picked
+		submissionJWT := buildSubmission(tt, []string{"passport", "license"}, [][]byte{passportVC, licenseVC})
+		result, err := gate.ValidatePresentationSubmission(context.Background(), submissionJWT)
+		assert.Error(tt, err)
+		assert.False(tt, result.Valid)
+		assert.Equal(tt, ReasonConstraintFailed, result.Reason.Code)
+		assert.Contains(tt, err.Error(), "submission requirement<identity> is not satisfied")
+
+		submissionJWT = buildSubmission(tt, []string{"email"}, [][]byte{emailVC})
+		result, err = gate.ValidatePresentationSubmission(context.Background(), submissionJWT)
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonConstraintFailed, result.Reason.Code)
+	})
+
+	t.Run("unsatisfied optional group is not handled", func(tt *testing.T) {
+		gate, err := NewCredentialGate(config)
+		require.NoError(tt, err)
+
+		// the credential submitted for the email input descriptor does not fulfill it
+		handled = nil
+		submissionJWT := buildSubmission(tt, []string{"passport", "email"}, [][]byte{passportVC, licenseVC})
+		result, err := gate.ValidatePresentationSubmission(context.Background(), submissionJWT)
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+		assert.ElementsMatch(tt, []string{"passport"}, handled)
+	})
+
+	t.Run("failed constraint of a required group", func(tt *testing.T) {
+		gate, err := NewCredentialGate(config)
+		require.NoError(tt, err)
+
+		submissionJWT := buildSubmission(tt, []string{"passport"}, [][]byte{emailVC})
+		result, err := gate.ValidatePresentationSubmission(context.Background(), submissionJWT)
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonConstraintFailed, result.Reason.Code)
+		assert.Equal(tt, "passport", result.Reason.InputDescriptorID)
+	})
+
+	t.Run("without presentation submission", func(tt *testing.T) {
+		gate, err := NewCredentialGate(config)
+		require.NoError(tt, err)
+
+		handled = nil
+		submissionJWT := buildTestPresentationJWT(tt, signer, requesterID, nil, [][]byte{passportVC}, nil)
+		result, err := gate.ValidatePresentationSubmission(context.Background(), submissionJWT)
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+		assert.ElementsMatch(tt, []string{"passport"}, handled)
+	})
+
+	t.Run("unknown group", func(tt *testing.T) {
+		unknownGroup := config
+		unknownGroup.PresentationDefinition.SubmissionRequirements = []exchange.SubmissionRequirement{
+			{Name: "identity", Rule: exchange.All, FromOption: exchange.FromOption{From: "unknown"}},
+		}
+		_, err := NewCredentialGate(unknownGroup)
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "from unknown group unknown")
+	})
+}
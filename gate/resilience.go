@@ -0,0 +1,262 @@
+package gate
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultRetryBackoff           = 100 * time.Millisecond
+	defaultCircuitBreakerCooldown = 30 * time.Second
+)
+
+// ErrCircuitOpen is returned for a custom handler which is not called because its circuit breaker is open
+var ErrCircuitOpen = errors.New("custom handler circuit breaker is open")
+
+// RetryPolicy retries a custom handler which errors transiently. A handler rejecting a credential is never retried,
+// nor is an error marked with PermanentHandlerError.
+type RetryPolicy struct {
+	// MaxAttempts is the most times the handler is called, including the first
+	// If empty, the handler is called once
+	MaxAttempts int `json:"maxAttempts,omitempty"`
+
+	// Backoff is the delay before the first retry, doubled before each further retry
+	// If empty, the first retry is after 100ms
+	Backoff time.Duration `json:"backoff,omitempty"`
+
+	// MaxBackoff caps the delay between retries
+	// If empty, the delay is not capped
+	MaxBackoff time.Duration `json:"maxBackoff,omitempty"`
+}
+
+// IsValid checks the retry policy's attempts and delays are not negative
+func (p RetryPolicy) IsValid() error {
+	if p.MaxAttempts < 0 {
+		return errors.Errorf("max attempts<%d> is negative", p.MaxAttempts)
+	}
+	if p.Backoff < 0 || p.MaxBackoff < 0 {
+		return errors.New("backoff is negative")
+	}
+	return nil
+}
+
+// backoff returns the delay before the given retry, counting from one
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	delay := p.Backoff
+	if delay == 0 {
+		delay = defaultRetryBackoff
+	}
+	for i := 1; i < retry; i++ {
+		delay *= 2
+		if p.MaxBackoff > 0 && delay >= p.MaxBackoff {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	return delay
+}
+
+// permanentError is a custom handler error which retrying will not resolve
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// PermanentHandlerError marks an error returned by a custom handler as one which retrying will not resolve, such
+// as a malformed credential, so the handler is not retried
+func PermanentHandlerError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+func isPermanent(err error) bool {
+	var pe *permanentError
+	return errors.As(err, &pe)
+}
+
+// CircuitBreakerConfig configures a CircuitBreaker
+type CircuitBreakerConfig struct {
+	// FailureThreshold is the number of consecutive errors after which the breaker opens
+	FailureThreshold int `json:"failureThreshold"`
+
+	// Cooldown is how long the breaker stays open before a single call is let through to try the handler again
+	// If empty, the breaker stays open for 30 seconds
+	Cooldown time.Duration `json:"cooldown,omitempty"`
+
+	// FailOpen accepts credentials without calling the handler while the breaker is open, rather than failing with
+	// ErrCircuitOpen
+	FailOpen bool `json:"failOpen,omitempty"`
+}
+
+// IsValid checks the breaker has a positive failure threshold and a cooldown which is not negative
+func (c CircuitBreakerConfig) IsValid() error {
+	if c.FailureThreshold < 1 {
+		return errors.Errorf("failure threshold<%d> must be at least 1", c.FailureThreshold)
+	}
+	if c.Cooldown < 0 {
+		return errors.Errorf("cooldown<%s> is negative", c.Cooldown)
+	}
+	return nil
+}
+
+// CircuitBreaker stops calling a custom handler after repeated errors, so a failing dependency is not called on every
+// submission. It holds state across submissions, and is safe for concurrent use.
+type CircuitBreaker struct {
+	config CircuitBreakerConfig
+	now    func() time.Time
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	// trial is true while a single call is let through an open breaker after its cooldown
+	trial bool
+}
+
+// NewCircuitBreaker creates a closed circuit breaker
+func NewCircuitBreaker(config CircuitBreakerConfig) (*CircuitBreaker, error) {
+	if err := config.IsValid(); err != nil {
+		return nil, errors.Wrap(err, "invalid circuit breaker config")
+	}
+	if config.Cooldown == 0 {
+		config.Cooldown = defaultCircuitBreakerCooldown
+	}
+	return &CircuitBreaker{config: config, now: time.Now}, nil
+}
+
+// Open returns whether the breaker is open
+func (b *CircuitBreaker) Open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.openedAt.IsZero()
+}
+
+// allow returns whether a call may be made: the breaker is closed, or its cooldown has passed and no other trial
+// call is in flight
+func (b *CircuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.openedAt.IsZero() {
+		return true
+	}
+	if b.trial || b.now().Sub(b.openedAt) < b.config.Cooldown {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+// record records the outcome of an allowed call; an error opens the breaker once the threshold is reached, or
+// reopens it after a trial call, and success closes it
+func (b *CircuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	trial := b.trial
+	b.trial = false
+	if err == nil {
+		b.failures = 0
+		b.openedAt = time.Time{}
+		return
+	}
+	b.failures++
+	if trial || b.failures >= b.config.FailureThreshold {
+		b.openedAt = b.now()
+	}
+}
+
+// abandon records that an allowed call was abandoned without an outcome, letting another trial call through
+func (b *CircuitBreaker) abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+}
+
+// call runs the handler logic under the handler's circuit breaker, retry policy, and timeout
+func (ch CustomHandler) call(ctx context.Context, logic func(ctx context.Context) (bool, error)) (bool, error) {
+	if ch.CircuitBreaker != nil && !ch.CircuitBreaker.allow() {
+		if ch.CircuitBreaker.config.FailOpen {
+			logrus.Warnf("custom handler circuit breaker is open for input descriptor ID %s, accepting", ch.InputDescriptorID)
+			return true, nil
+		}
+		return false, ErrCircuitOpen
+	}
+	handled, err := ch.retry(ctx, logic)
+	if ch.CircuitBreaker == nil {
+		return handled, err
+	}
+	// an error caused by the submission being cancelled, such as by another handler failing, is not a failure of
+	// the handler's dependencies
+	if err != nil && ctx.Err() != nil {
+		ch.CircuitBreaker.abandon()
+	} else {
+		ch.CircuitBreaker.record(err)
+	}
+	return handled, err
+}
+
+// retry calls the handler logic, each attempt bounded by the handler's timeout, until it succeeds, rejects the
+// credential, fails permanently, or runs out of attempts
+func (ch CustomHandler) retry(ctx context.Context, logic func(ctx context.Context) (bool, error)) (bool, error) {
+	attempts := 1
+	if ch.Retry != nil && ch.Retry.MaxAttempts > 1 {
+		attempts = ch.Retry.MaxAttempts
+	}
+	for attempt := 1; ; attempt++ {
+		handled, err := ch.attempt(ctx, logic)
+		if err == nil || attempt >= attempts || isPermanent(err) || ctx.Err() != nil {
+			if err != nil && attempt > 1 {
+				err = errors.Wrapf(err, "after %d attempts", attempt)
+			}
+			return handled, err
+		}
+		logrus.Debugf("retrying custom handler for input descriptor ID %s after error: %s", ch.InputDescriptorID, err)
+		select {
+		case <-ctx.Done():
+			return false, errors.Wrapf(err, "after %d attempts", attempt)
+		case <-time.After(ch.Retry.backoff(attempt)):
+		}
+	}
+}
+
+// attempt calls the handler logic once, bounded by the handler's timeout, if it has one
+func (ch CustomHandler) attempt(ctx context.Context, logic func(ctx context.Context) (bool, error)) (bool, error) {
+	if ch.Timeout <= 0 {
+		return logic(ctx)
+	}
+	attemptCtx, cancel := context.WithTimeout(ctx, ch.Timeout)
+	defer cancel()
+
+	type outcome struct {
+		handled bool
+		err     error
+	}
+	// the logic may not honor its context, so stop waiting for it once the timeout passes
+	done := make(chan outcome, 1)
+	go func() {
+		handled, err := logic(attemptCtx)
+		done <- outcome{handled: handled, err: err}
+	}()
+	select {
+	case o := <-done:
+		return o.handled, o.err
+	case <-attemptCtx.Done():
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		return false, errors.Wrapf(attemptCtx.Err(), "custom handler timed out after %s", ch.Timeout)
+	}
+}
@@ -0,0 +1,197 @@
+package gate
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/TBD54566975/ssi-sdk/credential/exchange"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCustomHandlerResilience(t *testing.T) {
+	sds := []exchange.VerifiedSubmissionData{{InputDescriptorID: "id"}}
+	// newHandler creates a handler which errors on its first failures calls, then accepts
+	newHandler := func(failures int32) (CustomHandler, *atomic.Int32) {
+		var calls atomic.Int32
+		return CustomHandler{
+			InputDescriptorID: "id",
+			Handler: func(_ context.Context, _ exchange.VerifiedSubmissionData) (bool, error) {
+				if calls.Add(1) <= failures {
+					return false, errors.New("service unavailable")
+				}
+				return true, nil
+			},
+		}, &calls
+	}
+
+	t.Run("timeout", func(tt *testing.T) {
+		ch := CustomHandler{
+			InputDescriptorID: "id",
+			Handler: func(_ context.Context, _ exchange.VerifiedSubmissionData) (bool, error) {
+				// ignores its context
+				time.Sleep(time.Second)
+				return true, nil
+			},
+			Timeout: 20 * time.Millisecond,
+		}
+		start := time.Now()
+		handled, err := ch.apply(context.Background(), sds)
+		assert.Less(tt, time.Since(start), 500*time.Millisecond)
+		assert.False(tt, handled)
+		assert.ErrorIs(tt, err, context.DeadlineExceeded)
+		assert.Contains(tt, err.Error(), "timed out after 20ms")
+	})
+
+	t.Run("retry transient errors", func(tt *testing.T) {
+		ch, calls := newHandler(2)
+		ch.Retry = &RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}
+		handled, err := ch.apply(context.Background(), sds)
+		assert.NoError(tt, err)
+		assert.True(tt, handled)
+		assert.Equal(tt, int32(3), calls.Load())
+
+		ch, calls = newHandler(5)
+		ch.Retry = &RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}
+		handled, err = ch.apply(context.Background(), sds)
+		assert.False(tt, handled)
+		assert.Contains(tt, err.Error(), "after 3 attempts")
+		assert.Equal(tt, int32(3), calls.Load())
+	})
+
+	t.Run("no retry of rejections or permanent errors", func(tt *testing.T) {
+		var calls atomic.Int32
+		ch := CustomHandler{
+			InputDescriptorID: "id",
+			Handler: func(_ context.Context, _ exchange.VerifiedSubmissionData) (bool, error) {
+				calls.Add(1)
+				return false, nil
+			},
+			Retry: &RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond},
+		}
+		handled, err := ch.apply(context.Background(), sds)
+		assert.NoError(tt, err)
+		assert.False(tt, handled)
+		assert.Equal(tt, int32(1), calls.Load())
+
+		calls.Store(0)
+		ch.Handler = func(_ context.Context, _ exchange.VerifiedSubmissionData) (bool, error) {
+			calls.Add(1)
+			return false, PermanentHandlerError(errors.New("malformed credential"))
+		}
+		_, err = ch.apply(context.Background(), sds)
+		assert.EqualError(tt, err, "malformed credential")
+		assert.Equal(tt, int32(1), calls.Load())
+	})
+
+	t.Run("backoff", func(tt *testing.T) {
+		policy := RetryPolicy{Backoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+		assert.Equal(tt, 10*time.Millisecond, policy.backoff(1))
+		assert.Equal(tt, 20*time.Millisecond, policy.backoff(2))
+		assert.Equal(tt, 40*time.Millisecond, policy.backoff(3))
+		assert.Equal(tt, 50*time.Millisecond, policy.backoff(4))
+		assert.Equal(tt, 50*time.Millisecond, policy.backoff(100))
+		assert.Equal(tt, defaultRetryBackoff, RetryPolicy{}.backoff(1))
+	})
+
+	t.Run("circuit breaker fails closed", func(tt *testing.T) {
+		now := time.Now()
+		breaker, err := NewCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 2, Cooldown: time.Minute})
+		require.NoError(tt, err)
+		breaker.now = func() time.Time { return now }
+		ch, calls := newHandler(3)
+		ch.CircuitBreaker = breaker
+
+		for i := 0; i < 2; i++ {
+			_, err = ch.apply(context.Background(), sds)
+			assert.Contains(tt, err.Error(), "service unavailable")
+		}
+		assert.True(tt, breaker.Open())
+		_, err = ch.apply(context.Background(), sds)
+		assert.ErrorIs(tt, err, ErrCircuitOpen)
+		assert.Equal(tt, int32(2), calls.Load())
+
+		// a failed trial call after the cooldown reopens the breaker, and a successful one closes it
+		now = now.Add(time.Minute)
+		_, err = ch.apply(context.Background(), sds)
+		assert.Contains(tt, err.Error(), "service unavailable")
+		_, err = ch.apply(context.Background(), sds)
+		assert.ErrorIs(tt, err, ErrCircuitOpen)
+		now = now.Add(time.Minute)
+		handled, err := ch.apply(context.Background(), sds)
+		assert.NoError(tt, err)
+		assert.True(tt, handled)
+		assert.False(tt, breaker.Open())
+		assert.Equal(tt, int32(4), calls.Load())
+	})
+
+	t.Run("circuit breaker fails open", func(tt *testing.T) {
+		breaker, err := NewCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1, FailOpen: true})
+		require.NoError(tt, err)
+		ch, calls := newHandler(10)
+		ch.CircuitBreaker = breaker
+
+		_, err = ch.apply(context.Background(), sds)
+		assert.Error(tt, err)
+		handled, err := ch.apply(context.Background(), sds)
+		assert.NoError(tt, err)
+		assert.True(tt, handled)
+		assert.Equal(tt, int32(1), calls.Load())
+
+		_, err = NewCircuitBreaker(CircuitBreakerConfig{})
+		assert.Error(tt, err)
+	})
+
+	t.Run("circuit breaker ignores cancelled submissions", func(tt *testing.T) {
+		breaker, err := NewCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1})
+		require.NoError(tt, err)
+		ch := CustomHandler{
+			InputDescriptorID: "id",
+			Handler: func(ctx context.Context, _ exchange.VerifiedSubmissionData) (bool, error) {
+				return false, ctx.Err()
+			},
+			CircuitBreaker: breaker,
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = ch.apply(ctx, sds)
+		assert.ErrorIs(tt, err, context.Canceled)
+		assert.False(tt, breaker.Open())
+	})
+
+	t.Run("invalid settings", func(tt *testing.T) {
+		ch, _ := newHandler(0)
+		ch.Timeout = -time.Second
+		assert.Error(tt, ch.IsValid())
+		ch.Timeout = 0
+		ch.Retry = &RetryPolicy{MaxAttempts: -1}
+		assert.Error(tt, ch.IsValid())
+	})
+
+	t.Run("handler reference", func(tt *testing.T) {
+		registry := NewHandlerRegistry()
+		require.NoError(tt, registry.Register("claim", newTestClaimHandler,
+			HandlerParameter{Name: "claim", Type: ParameterString}, HandlerParameter{Name: "values", Type: ParameterArray}))
+		ch, err := registry.Create(context.Background(), "id", HandlerReference{
+			Handler:        "claim",
+			Timeout:        "2s",
+			Retry:          &RetryReference{MaxAttempts: 3, Backoff: "50ms"},
+			CircuitBreaker: &CircuitBreakerReference{FailureThreshold: 5, Cooldown: "1m", FailOpen: true},
+		})
+		require.NoError(tt, err)
+		assert.Equal(tt, 2*time.Second, ch.Timeout)
+		assert.Equal(tt, &RetryPolicy{MaxAttempts: 3, Backoff: 50 * time.Millisecond}, ch.Retry)
+		require.NotNil(tt, ch.CircuitBreaker)
+		assert.Equal(tt, CircuitBreakerConfig{FailureThreshold: 5, Cooldown: time.Minute, FailOpen: true}, ch.CircuitBreaker.config)
+
+		_, err = registry.Create(context.Background(), "id", HandlerReference{Handler: "claim", Retry: &RetryReference{Backoff: "soon"}})
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "retry.backoff")
+		_, err = registry.Create(context.Background(), "id", HandlerReference{Handler: "claim", CircuitBreaker: &CircuitBreakerReference{}})
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "failure threshold")
+	})
+}
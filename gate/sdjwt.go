@@ -0,0 +1,553 @@
+package gate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+
+	"github.com/TBD54566975/ssi-sdk/credential"
+	"github.com/TBD54566975/ssi-sdk/credential/exchange"
+	"github.com/TBD54566975/ssi-sdk/crypto/jwx"
+	didjwk "github.com/TBD54566975/ssi-sdk/did/jwk"
+	"github.com/TBD54566975/ssi-sdk/schema"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/oliveagle/jsonpath"
+	"github.com/pkg/errors"
+
+	"github.com/TBD54566975/credential-gate/resolver"
+)
+
+const (
+	// sdJWTFormat is the claim format of SD-JWT credentials, as per
+	// https://datatracker.ietf.org/doc/html/draft-ietf-oauth-sd-jwt-vc
+	sdJWTFormat = "vc+sd-jwt"
+
+	keyBindingJWTType    = "kb+jwt"
+	sdJWTSeparator       = "~"
+	sdProperty           = "_sd"
+	sdAlgProperty        = "_sd_alg"
+	sdArrayProperty      = "..."
+	sdHashProperty       = "sd_hash"
+	confirmationProperty = "cnf"
+	vctProperty          = "vct"
+	statusProperty       = "status"
+	sdHashAlgorithm      = "sha-256"
+)
+
+// sdJWT is an SD-JWT credential as presented to the gate: the issuer-signed JWT, the disclosures the holder
+// chose to reveal, and a key binding JWT proving possession of the key the credential is bound to
+type sdJWT struct {
+	issuerJWT     string
+	disclosures   []string
+	keyBindingJWT string
+
+	// presented is the SD-JWT without its key binding JWT, over which the key binding JWT's sd_hash is computed
+	presented string
+
+	headers      jws.Headers
+	token        jwt.Token
+	confirmation *confirmation
+
+	// claims is the payload of the issuer-signed JWT with the disclosed claims in place of their digests, and
+	// without any undisclosed digests
+	claims map[string]any
+}
+
+// confirmation is the cnf claim of an SD-JWT, naming the key the credential is bound to either as a JWK or
+// as a DID URL
+type confirmation struct {
+	JWK *jwx.PublicKeyJWK `json:"jwk,omitempty"`
+	KID string            `json:"kid,omitempty"`
+}
+
+// disclosure is a decoded disclosure of an SD-JWT. Disclosures of object properties have a name, while
+// disclosures of array elements do not.
+type disclosure struct {
+	name           string
+	value          any
+	isArrayElement bool
+	referenced     bool
+}
+
+// isSDJWT returns whether a credential embedded in a VP is an SD-JWT. The separator of an SD-JWT never
+// appears in a JWT, so any string containing it is taken to be an SD-JWT.
+func isSDJWT(vc any) bool {
+	s, ok := vc.(string)
+	return ok && strings.Contains(s, sdJWTSeparator)
+}
+
+// parseSDJWT parses an SD-JWT of the form <issuer-signed JWT>~<disclosure>~...~<key binding JWT> and
+// reconstructs its disclosed claims. No signature verification happens here.
+func parseSDJWT(s string) (*sdJWT, error) {
+	parts := strings.Split(s, sdJWTSeparator)
+	if len(parts) < 2 {
+		return nil, errors.New("SD-JWT has no separator")
+	}
+	sd := sdJWT{
+		issuerJWT:     parts[0],
+		disclosures:   parts[1 : len(parts)-1],
+		keyBindingJWT: parts[len(parts)-1],
+		presented:     s[:strings.LastIndex(s, sdJWTSeparator)+1],
+	}
+
+	msg, err := jws.Parse([]byte(sd.issuerJWT))
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing issuer-signed JWT of SD-JWT")
+	}
+	if len(msg.Signatures()) != 1 {
+		return nil, errors.Errorf("expected 1 signature on issuer-signed JWT of SD-JWT, got %d", len(msg.Signatures()))
+	}
+	sd.headers = msg.Signatures()[0].ProtectedHeaders()
+	if sd.token, err = jwt.ParseInsecure([]byte(sd.issuerJWT)); err != nil {
+		return nil, errors.Wrap(err, "parsing issuer-signed JWT of SD-JWT")
+	}
+	var payload map[string]any
+	if err = json.Unmarshal(msg.Payload(), &payload); err != nil {
+		return nil, errors.Wrap(err, "unmarshalling payload of SD-JWT")
+	}
+
+	// the key the credential is bound to is never selectively disclosable, so it is read from the signed payload
+	if cnf, ok := payload[confirmationProperty]; ok {
+		cnfBytes, err := json.Marshal(cnf)
+		if err != nil {
+			return nil, errors.Wrap(err, "marshalling cnf claim of SD-JWT")
+		}
+		if err = json.Unmarshal(cnfBytes, &sd.confirmation); err != nil {
+			return nil, errors.Wrap(err, "unmarshalling cnf claim of SD-JWT")
+		}
+	}
+	if sd.claims, err = discloseClaims(payload, sd.disclosures); err != nil {
+		return nil, errors.Wrap(err, "reconstructing disclosed claims of SD-JWT")
+	}
+	return &sd, nil
+}
+
+// discloseClaims replaces the digests in an SD-JWT payload with the claims of the matching disclosures, as per
+// https://datatracker.ietf.org/doc/html/draft-ietf-oauth-selective-disclosure-jwt#name-verification-of-the-sd-jwt.
+// Digests without a matching disclosure are removed, and every disclosure must be referenced exactly once.
+func discloseClaims(payload map[string]any, encodedDisclosures []string) (map[string]any, error) {
+	if alg, ok := payload[sdAlgProperty]; ok && alg != sdHashAlgorithm {
+		return nil, errors.Errorf("unsupported SD-JWT hash algorithm: %v", alg)
+	}
+	d := discloser{
+		disclosures: make(map[string]*disclosure, len(encodedDisclosures)),
+		digests:     make(map[string]bool),
+	}
+	for _, encoded := range encodedDisclosures {
+		digest := sdHash(encoded)
+		if _, ok := d.disclosures[digest]; ok {
+			return nil, errors.New("disclosure presented more than once")
+		}
+		decoded, err := decodeDisclosure(encoded)
+		if err != nil {
+			return nil, err
+		}
+		d.disclosures[digest] = decoded
+	}
+	claims, err := d.object(payload)
+	if err != nil {
+		return nil, err
+	}
+	delete(claims, sdAlgProperty)
+	for _, disc := range d.disclosures {
+		if !disc.referenced {
+			return nil, errors.Errorf("disclosure of %q is not referenced by the SD-JWT", disc.name)
+		}
+	}
+	return claims, nil
+}
+
+// decodeDisclosure decodes a disclosure, a base64url encoded JSON array of either a salt, a claim name, and a
+// claim value, or of a salt and an array element
+func decodeDisclosure(encoded string) (*disclosure, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding disclosure")
+	}
+	var elements []any
+	if err = json.Unmarshal(decoded, &elements); err != nil {
+		return nil, errors.Wrap(err, "unmarshalling disclosure")
+	}
+	if len(elements) < 2 || len(elements) > 3 {
+		return nil, errors.Errorf("disclosure has %d elements", len(elements))
+	}
+	if _, ok := elements[0].(string); !ok {
+		return nil, errors.New("disclosure salt is not a string")
+	}
+	if len(elements) == 2 {
+		return &disclosure{value: elements[1], isArrayElement: true}, nil
+	}
+	name, ok := elements[1].(string)
+	if !ok {
+		return nil, errors.New("disclosure claim name is not a string")
+	}
+	if name == sdProperty || name == sdArrayProperty {
+		return nil, errors.Errorf("disclosure has reserved claim name %q", name)
+	}
+	return &disclosure{name: name, value: elements[2]}, nil
+}
+
+// sdHash is the base64url encoded SHA-256 digest of an SD-JWT component
+func sdHash(s string) string {
+	digest := sha256.Sum256([]byte(s))
+	return base64.RawURLEncoding.EncodeToString(digest[:])
+}
+
+// discloser reconstructs the disclosed claims of an SD-JWT payload
+type discloser struct {
+	// disclosures are the presented disclosures by digest
+	disclosures map[string]*disclosure
+	// digests are the digests seen in the payload, none of which may appear twice
+	digests map[string]bool
+}
+
+// use returns the disclosure matching a digest of the payload, or nil if the digest is undisclosed or a decoy
+func (d discloser) use(digest any) (*disclosure, error) {
+	s, ok := digest.(string)
+	if !ok {
+		return nil, errors.Errorf("digest is not a string: %v", digest)
+	}
+	if d.digests[s] {
+		return nil, errors.Errorf("digest<%s> appears more than once", s)
+	}
+	d.digests[s] = true
+	disc, ok := d.disclosures[s]
+	if !ok {
+		return nil, nil
+	}
+	disc.referenced = true
+	return disc, nil
+}
+
+func (d discloser) object(obj map[string]any) (map[string]any, error) {
+	claims := make(map[string]any, len(obj))
+	for k, v := range obj {
+		if k == sdProperty {
+			continue
+		}
+		value, err := d.value(v)
+		if err != nil {
+			return nil, err
+		}
+		claims[k] = value
+	}
+	digests, ok := obj[sdProperty]
+	if !ok {
+		return claims, nil
+	}
+	digestList, ok := digests.([]any)
+	if !ok {
+		return nil, errors.Errorf("%s is not an array", sdProperty)
+	}
+	for _, digest := range digestList {
+		disc, err := d.use(digest)
+		if err != nil {
+			return nil, err
+		}
+		if disc == nil {
+			continue
+		}
+		if disc.isArrayElement {
+			return nil, errors.New("disclosure of an array element is referenced as a claim")
+		}
+		if _, ok := claims[disc.name]; ok {
+			return nil, errors.Errorf("claim %q is disclosed more than once", disc.name)
+		}
+		value, err := d.value(disc.value)
+		if err != nil {
+			return nil, err
+		}
+		claims[disc.name] = value
+	}
+	return claims, nil
+}
+
+func (d discloser) value(v any) (any, error) {
+	switch v := v.(type) {
+	case map[string]any:
+		return d.object(v)
+	case []any:
+		elements := make([]any, 0, len(v))
+		for _, element := range v {
+			if digest, ok := arrayElementDigest(element); ok {
+				disc, err := d.use(digest)
+				if err != nil {
+					return nil, err
+				}
+				if disc == nil {
+					continue
+				}
+				if !disc.isArrayElement {
+					return nil, errors.Errorf("disclosure of claim %q is referenced as an array element", disc.name)
+				}
+				value, err := d.value(disc.value)
+				if err != nil {
+					return nil, err
+				}
+				elements = append(elements, value)
+				continue
+			}
+			value, err := d.value(element)
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, value)
+		}
+		return elements, nil
+	}
+	return v, nil
+}
+
+// arrayElementDigest returns the digest of an array element which is selectively disclosable, represented as
+// an object with the single property "..."
+func arrayElementDigest(element any) (any, bool) {
+	obj, ok := element.(map[string]any)
+	if !ok || len(obj) != 1 {
+		return nil, false
+	}
+	digest, ok := obj[sdArrayProperty]
+	return digest, ok
+}
+
+// holder returns the DID of the key the credential is bound to: the DID of a DID URL in cnf.kid, or the
+// did:jwk of a key in cnf.jwk
+func (sd *sdJWT) holder() (string, error) {
+	switch {
+	case sd.confirmation == nil:
+		return "", errors.New("SD-JWT is not bound to a key")
+	case sd.confirmation.KID != "":
+		holder, _, found := strings.Cut(sd.confirmation.KID, "#")
+		if !found || !strings.HasPrefix(holder, "did:") {
+			return "", errors.Errorf("cnf kid<%s> of SD-JWT is not a DID URL", sd.confirmation.KID)
+		}
+		return holder, nil
+	case sd.confirmation.JWK != nil:
+		holder, err := didjwk.CreateDIDJWK(*sd.confirmation.JWK)
+		if err != nil {
+			return "", errors.Wrap(err, "creating did:jwk for cnf jwk of SD-JWT")
+		}
+		return holder.String(), nil
+	}
+	return "", errors.New("cnf claim of SD-JWT has neither a jwk nor a kid")
+}
+
+// credential returns a view of the disclosed claims as a credential, for the checks which apply to credentials
+// of every format: the issuer is the iss claim, the type is the vct claim, and the subject is made up of all
+// disclosed claims with the sub claim as its id
+func (sd *sdJWT) credential() *credential.VerifiableCredential {
+	subject := make(map[string]any, len(sd.claims))
+	for k, v := range sd.claims {
+		subject[k] = v
+	}
+	if sub := sd.token.Subject(); sub != "" {
+		subject[credential.VerifiableCredentialIDProperty] = sub
+	}
+	cred := credential.VerifiableCredential{
+		ID:                sd.token.JwtID(),
+		Issuer:            sd.token.Issuer(),
+		CredentialSubject: subject,
+	}
+	if vct, ok := sd.claims[vctProperty].(string); ok {
+		cred.Type = []string{vct}
+	}
+	return &cred
+}
+
+// toCredential parses a credential embedded in a VP. SD-JWT credentials are represented by their disclosed
+// claims, as described by sdJWT.credential.
+func toCredential(vc any) (*credential.VerifiableCredential, error) {
+	if isSDJWT(vc) {
+		sd, err := parseSDJWT(vc.(string))
+		if err != nil {
+			return nil, err
+		}
+		return sd.credential(), nil
+	}
+	_, _, cred, err := credential.ToCredential(vc)
+	return cred, err
+}
+
+// parseSDJWTPresentation parses an SD-JWT submitted on its own, without a VP. Its key binding JWT stands in
+// for the VP: the holder of the key the credential is bound to is the submitter, the key binding JWT's nonce
+// may answer a challenge issued by the gate, and the key binding JWT itself is used for replay protection.
+func parseSDJWTPresentation(submission string) (*presentation, error) {
+	sd, err := parseSDJWT(submission)
+	if err != nil {
+		return nil, err
+	}
+	submitter, err := sd.holder()
+	if err != nil {
+		return nil, err
+	}
+	if sd.keyBindingJWT == "" {
+		return nil, errors.New("SD-JWT submitted without a key binding JWT")
+	}
+	keyBinding, err := jwt.ParseInsecure([]byte(sd.keyBindingJWT))
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing key binding JWT")
+	}
+	var challenges []string
+	if nonce, ok := keyBinding.Get(credential.NonceProperty); ok {
+		if nonce, ok := nonce.(string); ok && nonce != "" {
+			challenges = append(challenges, nonce)
+		}
+	}
+	return &presentation{
+		format: sdJWTFormat,
+		vp: &credential.VerifiablePresentation{
+			Context:              []any{"https://www.w3.org/2018/credentials/v1"},
+			Type:                 []string{"VerifiablePresentation"},
+			Holder:               submitter,
+			VerifiableCredential: []any{submission},
+		},
+		submitter:  submitter,
+		id:         sdHash(sd.keyBindingJWT),
+		challenges: challenges,
+		expiry:     keyBinding.Expiration(),
+	}, nil
+}
+
+// verifySDJWT verifies the issuer's signature over an SD-JWT credential, and that the holder has bound its
+// presentation to the gate and to the presented disclosures with a key binding JWT. The key binding JWT is
+// signed with the key in the credential's cnf claim; when that is a DID URL, the key must be in the
+// configured verification relationship for presentations, which is authentication unless configured otherwise.
+func (cg *CredentialGate) verifySDJWT(ctx context.Context, s string) error {
+	sd, err := parseSDJWT(s)
+	if err != nil {
+		return newDenial(ReasonInvalidSubmission, err)
+	}
+	if err = verifySDJWTIssuer(ctx, cg.resolver, cg.validityClock(), sd); err != nil {
+		return err
+	}
+	return cg.verifyKeyBinding(ctx, sd)
+}
+
+// verifySDJWTIssuer verifies the issuer-signed JWT of an SD-JWT against the issuer's DID, and that the
+// credential is currently valid by the clock
+func verifySDJWTIssuer(ctx context.Context, r *resolver.Resolver, clock validityClock, sd *sdJWT) error {
+	if sd.headers.Type() != sdJWTFormat {
+		return newDenial(ReasonInvalidSubmission, errors.Errorf("unexpected typ of SD-JWT: %s", sd.headers.Type()))
+	}
+	kid := sd.headers.KeyID()
+	if kid == "" {
+		return newDenial(ReasonInvalidSubmission, errors.New("missing kid in header of SD-JWT"))
+	}
+	if err := verifyJWTSignature(ctx, r, sd.issuerJWT, sd.token.Issuer(), kid, ""); err != nil {
+		return err
+	}
+	return clock.checkJWT(sd.token, "SD-JWT "+credentialName(sd.token.JwtID(), sd.token.Issuer()))
+}
+
+// verifyKeyBinding verifies the key binding JWT of an SD-JWT is signed with the key the credential is bound to,
+// is addressed to the gate, and covers exactly the presented disclosures
+func (cg *CredentialGate) verifyKeyBinding(ctx context.Context, sd *sdJWT) error {
+	if sd.keyBindingJWT == "" {
+		return newDenial(ReasonHolderMismatch, errors.New("SD-JWT presented without a key binding JWT"))
+	}
+	holder, err := sd.holder()
+	if err != nil {
+		return newDenial(ReasonHolderMismatch, err)
+	}
+	headers, err := jwx.GetJWSHeaders([]byte(sd.keyBindingJWT))
+	if err != nil {
+		return newDenial(ReasonInvalidSubmission, errors.Wrap(err, "parsing key binding JWT"))
+	}
+	if headers.Type() != keyBindingJWTType {
+		return newDenial(ReasonInvalidSubmission, errors.Errorf("unexpected typ of key binding JWT: %s", headers.Type()))
+	}
+	token, err := jwt.ParseInsecure([]byte(sd.keyBindingJWT))
+	if err != nil {
+		return newDenial(ReasonInvalidSubmission, errors.Wrap(err, "parsing key binding JWT"))
+	}
+
+	if sd.confirmation.KID != "" {
+		relationship := cg.config.PresentationKeyRelationship
+		if relationship == "" {
+			relationship = AuthenticationRelationship
+		}
+		if err = verifyJWTSignature(ctx, cg.resolver, sd.keyBindingJWT, holder, sd.confirmation.KID, relationship); err != nil {
+			return errors.Wrap(err, "verifying key binding JWT")
+		}
+	} else {
+		verifier, err := jwx.NewJWXVerifierFromJWK(holder, *sd.confirmation.JWK)
+		if err != nil {
+			return newDenial(ReasonInvalidSubmission, errors.Wrap(err, "constructing key binding JWT verifier"))
+		}
+		if err = verifier.VerifyJWS(sd.keyBindingJWT); err != nil {
+			return newDenial(ReasonSignatureInvalid, errors.Wrap(err, "verifying key binding JWT"))
+		}
+	}
+
+	if token.IssuedAt().IsZero() {
+		return newDenial(ReasonInvalidSubmission, errors.New("missing iat in key binding JWT"))
+	}
+	clock := cg.validityClock()
+	if err = clock.checkJWT(token, "key binding JWT"); err != nil {
+		return err
+	}
+	if err = clock.checkAge(token.IssuedAt(), cg.config.MaxPresentationAge, "key binding JWT"); err != nil {
+		return err
+	}
+	if sdHashClaim, _ := token.Get(sdHashProperty); sdHashClaim != sdHash(sd.presented) {
+		return newDenial(ReasonSignatureInvalid, errors.New("sd_hash of key binding JWT does not match the presented SD-JWT"))
+	}
+	return cg.checkAudience("key binding JWT audience", token.Audience())
+}
+
+// verifyDisclosedClaims checks that the disclosed claims of an SD-JWT credential fulfill an input descriptor,
+// evaluating its fields in the same way as for other claim formats. Only disclosed claims are visible to the
+// input descriptor, and the verified submission data holds the disclosed claims as its claim. The claim formats
+// of an input descriptor cannot name SD-JWT, so input descriptors which restrict formats are never fulfilled.
+// No signature verification happens here.
+func verifyDisclosedClaims(inputDescriptor exchange.InputDescriptor, claim string) ([]exchange.VerifiedSubmissionData, error) {
+	if inputDescriptor.Format != nil {
+		return nil, errors.Errorf("input descriptor<%s> does not accept the %s format", inputDescriptor.ID, sdJWTFormat)
+	}
+	sd, err := parseSDJWT(claim)
+	if err != nil {
+		return nil, err
+	}
+	verified := exchange.VerifiedSubmissionData{InputDescriptorID: inputDescriptor.ID, Claim: sd.claims}
+	constraints := inputDescriptor.Constraints
+	if constraints == nil {
+		return []exchange.VerifiedSubmissionData{verified}, nil
+	}
+	for _, field := range constraints.Fields {
+		pathedData, err := getDisclosedClaim(sd.claims, field.Path)
+		if err != nil {
+			if field.Optional {
+				continue
+			}
+			return nil, errors.Wrapf(err, "input descriptor<%s> not fulfilled for non-optional field: %s", inputDescriptor.ID, field.ID)
+		}
+		if field.Filter != nil {
+			filterJSON, err := field.Filter.ToJSON()
+			if err != nil {
+				return nil, errors.Wrap(err, "turning filter into JSON schema")
+			}
+			if err = schema.IsAnyValidAgainstJSONSchema(pathedData, filterJSON); err != nil && !field.Optional {
+				return nil, errors.Wrapf(err, "unable to apply filter<%s> to data from path: %s", filterJSON, field.Path)
+			}
+		}
+		verified.FilteredData = pathedData
+	}
+	if constraints.SubjectIsIssuer != nil && *constraints.SubjectIsIssuer == exchange.Required {
+		if sd.token.Subject() != sd.token.Issuer() {
+			return nil, errors.Errorf("subject<%s> is not the same as issuer<%s>", sd.token.Subject(), sd.token.Issuer())
+		}
+	}
+	return []exchange.VerifiedSubmissionData{verified}, nil
+}
+
+// getDisclosedClaim returns the data at the first of the paths found in the disclosed claims
+func getDisclosedClaim(claims map[string]any, paths []string) (any, error) {
+	for _, path := range paths {
+		if data, err := jsonpath.JsonPathLookup(claims, path); err == nil {
+			return data, nil
+		}
+	}
+	return nil, errors.New("matching path for claim could not be found")
+}
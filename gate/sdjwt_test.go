@@ -0,0 +1,315 @@
+package gate
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TBD54566975/ssi-sdk/credential/exchange"
+	"github.com/TBD54566975/ssi-sdk/crypto/jwx"
+	"github.com/google/uuid"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildTestDisclosure encodes a disclosure of a claim, or of an array element if name is empty
+func buildTestDisclosure(t *testing.T, name string, value any) string {
+	elements := []any{uuid.NewString(), name, value}
+	if name == "" {
+		elements = []any{uuid.NewString(), value}
+	}
+	disclosureBytes, err := json.Marshal(elements)
+	require.NoError(t, err)
+	return base64.RawURLEncoding.EncodeToString(disclosureBytes)
+}
+
+// buildTestSDJWT builds an SD-JWT without a key binding JWT, in which the claims are always disclosed and each
+// of the selective claims has a disclosure. The SD-JWT is bound to the holder's key.
+func buildTestSDJWT(t *testing.T, issuer, holder jwx.Signer, claims, selective map[string]any) string {
+	token := jwt.New()
+	require.NoError(t, token.Set(jwt.IssuerKey, issuer.ID))
+	require.NoError(t, token.Set(jwt.SubjectKey, holder.ID))
+	require.NoError(t, token.Set(jwt.IssuedAtKey, time.Now().Unix()))
+	require.NoError(t, token.Set(vctProperty, "https://example.com/identity_credential"))
+	require.NoError(t, token.Set(confirmationProperty, map[string]any{"kid": holder.KID}))
+	require.NoError(t, token.Set(sdAlgProperty, sdHashAlgorithm))
+	for k, v := range claims {
+		require.NoError(t, token.Set(k, v))
+	}
+	var disclosures, digests []string
+	for name, value := range selective {
+		disclosure := buildTestDisclosure(t, name, value)
+		disclosures = append(disclosures, disclosure)
+		digests = append(digests, sdHash(disclosure))
+	}
+	require.NoError(t, token.Set(sdProperty, digests))
+
+	headers := jws.NewHeaders()
+	require.NoError(t, headers.Set(jws.KeyIDKey, issuer.KID))
+	require.NoError(t, headers.Set(jws.TypeKey, sdJWTFormat))
+	signed, err := jwt.Sign(token, jwt.WithKey(jwa.SignatureAlgorithm(issuer.ALG), issuer.PrivateKey, jws.WithProtectedHeaders(headers)))
+	require.NoError(t, err)
+	return string(signed) + sdJWTSeparator + strings.Join(disclosures, sdJWTSeparator) + sdJWTSeparator
+}
+
+// addTestKeyBinding appends a key binding JWT to an SD-JWT, addressed to the audience. Any extra claims are set on
+// the key binding JWT.
+func addTestKeyBinding(t *testing.T, holder jwx.Signer, sdJWT, audience string, claims map[string]any) string {
+	token := jwt.New()
+	require.NoError(t, token.Set(jwt.AudienceKey, audience))
+	require.NoError(t, token.Set(jwt.IssuedAtKey, time.Now().Unix()))
+	require.NoError(t, token.Set(sdHashProperty, sdHash(sdJWT)))
+	for k, v := range claims {
+		require.NoError(t, token.Set(k, v))
+	}
+	headers := jws.NewHeaders()
+	require.NoError(t, headers.Set(jws.TypeKey, keyBindingJWTType))
+	signed, err := jwt.Sign(token, jwt.WithKey(jwa.SignatureAlgorithm(holder.ALG), holder.PrivateKey, jws.WithProtectedHeaders(headers)))
+	require.NoError(t, err)
+	return sdJWT + string(signed)
+}
+
+// withoutDisclosure removes the disclosure of the claim from an SD-JWT
+func withoutDisclosure(t *testing.T, sdJWT, name string) string {
+	parts := strings.Split(sdJWT, sdJWTSeparator)
+	kept := []string{parts[0]}
+	for _, encoded := range parts[1 : len(parts)-1] {
+		disc, err := decodeDisclosure(encoded)
+		require.NoError(t, err)
+		if disc.name != name {
+			kept = append(kept, encoded)
+		}
+	}
+	return strings.Join(append(kept, parts[len(parts)-1]), sdJWTSeparator)
+}
+
+func TestSDJWT(t *testing.T) {
+	requesterID := "did:test:admin"
+	inputDescriptorID := "name"
+	presentationDefinition := exchange.PresentationDefinition{
+		ID: uuid.New().String(),
+		InputDescriptors: []exchange.InputDescriptor{
+			{
+				ID: inputDescriptorID,
+				Constraints: &exchange.Constraints{
+					Fields: []exchange.Field{{Path: []string{"$.given_name"}, Filter: &exchange.Filter{Type: "string", Const: "Satoshi"}}},
+				},
+			},
+		},
+	}
+	newGate := func(t *testing.T, config CredentialGateConfig) *CredentialGate {
+		config.AdminDID = requesterID
+		if len(config.PresentationDefinition.InputDescriptors) == 0 {
+			config.PresentationDefinition = presentationDefinition
+		}
+		gate, err := NewCredentialGate(config)
+		require.NoError(t, err)
+		return gate
+	}
+
+	issuer := newTestSigner(t)
+	holder := newTestSigner(t)
+	buildSDJWT := func(t *testing.T) string {
+		return buildTestSDJWT(t, issuer, holder, nil, map[string]any{"given_name": "Satoshi", "family_name": "Nakamoto"})
+	}
+
+	t.Run("SD-JWT with disclosed claims", func(tt *testing.T) {
+		var handled exchange.VerifiedSubmissionData
+		gate := newGate(tt, CredentialGateConfig{
+			CustomHandlers: map[string]CustomHandler{
+				inputDescriptorID: {
+					InputDescriptorID: inputDescriptorID,
+					Handler: func(_ context.Context, vsd exchange.VerifiedSubmissionData) (bool, error) {
+						handled = vsd
+						return true, nil
+					},
+				},
+			},
+		})
+		sdJWT := withoutDisclosure(tt, buildSDJWT(tt), "family_name")
+		result, err := gate.ValidatePresentation(context.Background(), []byte(addTestKeyBinding(tt, holder, sdJWT, requesterID, nil)))
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+		assert.Equal(tt, holder.ID, result.Submitter)
+
+		claims, ok := handled.Claim.(map[string]any)
+		require.True(tt, ok)
+		assert.Equal(tt, "Satoshi", claims["given_name"])
+		assert.NotContains(tt, claims, "family_name")
+		assert.NotContains(tt, claims, sdProperty)
+		assert.NotContains(tt, claims, sdAlgProperty)
+		assert.Equal(tt, "Satoshi", handled.FilteredData)
+	})
+
+	t.Run("SD-JWT bound to a JWK", func(tt *testing.T) {
+		holderJWK, err := jwx.PublicKeyToPublicKeyJWK("", holder.PrivateKey.(ed25519.PrivateKey).Public())
+		require.NoError(tt, err)
+		sdJWT := buildTestSDJWT(tt, issuer, holder, map[string]any{
+			confirmationProperty: map[string]any{"jwk": holderJWK},
+		}, map[string]any{"given_name": "Satoshi"})
+		result, err := newGate(tt, CredentialGateConfig{}).ValidatePresentation(context.Background(), []byte(addTestKeyBinding(tt, holder, sdJWT, requesterID, nil)))
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+		assert.True(tt, strings.HasPrefix(result.Submitter, "did:jwk:"))
+	})
+
+	t.Run("undisclosed claim", func(tt *testing.T) {
+		def := exchange.PresentationDefinition{
+			ID: uuid.New().String(),
+			InputDescriptors: []exchange.InputDescriptor{{
+				ID:          inputDescriptorID,
+				Constraints: &exchange.Constraints{Fields: []exchange.Field{{Path: []string{"$.family_name"}}}},
+			}},
+		}
+		gate := newGate(tt, CredentialGateConfig{PresentationDefinition: def})
+		sdJWT := withoutDisclosure(tt, buildSDJWT(tt), "family_name")
+		result, err := gate.ValidatePresentation(context.Background(), []byte(addTestKeyBinding(tt, holder, sdJWT, requesterID, nil)))
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonConstraintFailed, result.Reason.Code)
+		assert.Equal(tt, inputDescriptorID, result.Reason.InputDescriptorID)
+	})
+
+	t.Run("disclosure not in the SD-JWT", func(tt *testing.T) {
+		sdJWT := buildSDJWT(tt) + buildTestDisclosure(tt, "given_name", "Hal") + sdJWTSeparator
+		result, err := newGate(tt, CredentialGateConfig{}).ValidatePresentation(context.Background(), []byte(addTestKeyBinding(tt, holder, sdJWT, requesterID, nil)))
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonInvalidSubmission, result.Reason.Code)
+	})
+
+	t.Run("without key binding", func(tt *testing.T) {
+		result, err := newGate(tt, CredentialGateConfig{}).ValidatePresentation(context.Background(), []byte(buildSDJWT(tt)))
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonInvalidSubmission, result.Reason.Code)
+	})
+
+	t.Run("key binding for another audience", func(tt *testing.T) {
+		result, err := newGate(tt, CredentialGateConfig{}).ValidatePresentation(context.Background(), []byte(addTestKeyBinding(tt, holder, buildSDJWT(tt), "did:test:other", nil)))
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonAudienceMismatch, result.Reason.Code)
+	})
+
+	t.Run("key binding over other disclosures", func(tt *testing.T) {
+		presented := addTestKeyBinding(tt, holder, buildSDJWT(tt), requesterID, nil)
+		result, err := newGate(tt, CredentialGateConfig{}).ValidatePresentation(context.Background(), []byte(withoutDisclosure(tt, presented, "family_name")))
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonSignatureInvalid, result.Reason.Code)
+	})
+
+	t.Run("key binding signed by another key", func(tt *testing.T) {
+		result, err := newGate(tt, CredentialGateConfig{}).ValidatePresentation(context.Background(), []byte(addTestKeyBinding(tt, newTestSigner(tt), buildSDJWT(tt), requesterID, nil)))
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonSignatureInvalid, result.Reason.Code)
+	})
+
+	t.Run("key binding answering a challenge", func(tt *testing.T) {
+		gate := newGate(tt, CredentialGateConfig{RequireChallenge: true})
+		challenge, err := gate.NewChallenge(context.Background())
+		require.NoError(tt, err)
+
+		presented := addTestKeyBinding(tt, holder, buildSDJWT(tt), requesterID, map[string]any{"nonce": challenge.Nonce})
+		result, err := gate.ValidatePresentation(context.Background(), []byte(presented))
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+
+		result, err = gate.ValidatePresentation(context.Background(), []byte(presented))
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonChallengeFailed, result.Reason.Code)
+	})
+
+	t.Run("replayed key binding", func(tt *testing.T) {
+		gate := newGate(tt, CredentialGateConfig{})
+		presented := addTestKeyBinding(tt, holder, buildSDJWT(tt), requesterID, nil)
+		_, err := gate.ValidatePresentation(context.Background(), []byte(presented))
+		assert.NoError(tt, err)
+
+		result, err := gate.ValidatePresentation(context.Background(), []byte(presented))
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonReplayed, result.Reason.Code)
+	})
+
+	t.Run("SD-JWT with a status", func(tt *testing.T) {
+		sdJWT := buildTestSDJWT(tt, issuer, holder, map[string]any{
+			statusProperty: map[string]any{"status_list": map[string]any{"idx": 0, "uri": "https://example.com/statuslists/1"}},
+		}, map[string]any{"given_name": "Satoshi"})
+		result, err := newGate(tt, CredentialGateConfig{}).ValidatePresentation(context.Background(), []byte(addTestKeyBinding(tt, holder, sdJWT, requesterID, nil)))
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonStatusUnverifiable, result.Reason.Code)
+	})
+
+	t.Run("SD-JWT in a VP JWT", func(tt *testing.T) {
+		sdJWT := addTestKeyBinding(tt, holder, buildSDJWT(tt), requesterID, nil)
+		submission := exchange.PresentationSubmission{
+			ID:           uuid.NewString(),
+			DefinitionID: presentationDefinition.ID,
+			DescriptorMap: []exchange.SubmissionDescriptor{{
+				ID:     inputDescriptorID,
+				Format: sdJWTFormat,
+				Path:   "$.verifiableCredential[0]",
+			}},
+		}
+		submissionJWT := buildTestPresentationJWT(tt, holder, requesterID, &submission, [][]byte{[]byte(sdJWT)}, nil)
+		result, err := newGate(tt, CredentialGateConfig{}).ValidatePresentation(context.Background(), []byte(submissionJWT))
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+
+		submissionJWT = buildTestPresentationJWT(tt, holder, requesterID, &submission, [][]byte{[]byte(buildSDJWT(tt))}, nil)
+		result, err = newGate(tt, CredentialGateConfig{}).ValidatePresentation(context.Background(), []byte(submissionJWT))
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonHolderMismatch, result.Reason.Code)
+		assert.Equal(tt, inputDescriptorID, result.Reason.InputDescriptorID)
+	})
+}
+
+func TestDiscloseClaims(t *testing.T) {
+	t.Run("nested claims and array elements", func(tt *testing.T) {
+		street := buildTestDisclosure(tt, "street_address", "123 Main St")
+		address := buildTestDisclosure(tt, "address", map[string]any{sdProperty: []any{sdHash(street)}, "country": "US"})
+		nationality := buildTestDisclosure(tt, "", "US")
+		payload := map[string]any{
+			sdAlgProperty: sdHashAlgorithm,
+			sdProperty:    []any{sdHash(address), sdHash("decoy")},
+			"nationalities": []any{
+				map[string]any{sdArrayProperty: sdHash(nationality)},
+				map[string]any{sdArrayProperty: sdHash(buildTestDisclosure(tt, "", "DE"))},
+			},
+		}
+		claims, err := discloseClaims(payload, []string{address, street, nationality})
+		assert.NoError(tt, err)
+		assert.Equal(tt, map[string]any{
+			"address":       map[string]any{"street_address": "123 Main St", "country": "US"},
+			"nationalities": []any{"US"},
+		}, claims)
+	})
+
+	t.Run("unreferenced disclosure", func(tt *testing.T) {
+		_, err := discloseClaims(map[string]any{}, []string{buildTestDisclosure(tt, "given_name", "Satoshi")})
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "not referenced")
+	})
+
+	t.Run("repeated digest", func(tt *testing.T) {
+		given := buildTestDisclosure(tt, "given_name", "Satoshi")
+		_, err := discloseClaims(map[string]any{sdProperty: []any{sdHash(given), sdHash(given)}}, []string{given})
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "more than once")
+	})
+
+	t.Run("claim disclosed over a plain claim", func(tt *testing.T) {
+		given := buildTestDisclosure(tt, "given_name", "Hal")
+		_, err := discloseClaims(map[string]any{"given_name": "Satoshi", sdProperty: []any{sdHash(given)}}, []string{given})
+		assert.Error(tt, err)
+	})
+
+	t.Run("unsupported hash algorithm", func(tt *testing.T) {
+		_, err := discloseClaims(map[string]any{sdAlgProperty: "sha-512"}, nil)
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "unsupported SD-JWT hash algorithm: sha-512")
+	})
+}
@@ -0,0 +1,429 @@
+package gate
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/TBD54566975/ssi-sdk/credential"
+	"github.com/pkg/errors"
+)
+
+const (
+	statusList2021EntryType      = "StatusList2021Entry"
+	statusList2021Type           = "StatusList2021"
+	bitstringStatusListEntryType = "BitstringStatusListEntry"
+	bitstringStatusListType      = "BitstringStatusList"
+
+	revocationPurpose = "revocation"
+	suspensionPurpose = "suspension"
+
+	// maxStatusListSize bounds the size of a fetched status list credential, and of its decompressed bitstring
+	maxStatusListSize = 16 << 20
+)
+
+// StatusListFetcher fetches the status list credential published at a URL. The credential is returned as it
+// would be embedded in a VP: either a JWT string or a JSON object.
+type StatusListFetcher interface {
+	FetchStatusList(ctx context.Context, url string) (any, error)
+}
+
+// HTTPStatusListFetcher fetches status list credentials with a GET request to their URL. The URL is taken from a
+// submitted credential, so only https URLs are fetched and redirects are never followed.
+type HTTPStatusListFetcher struct {
+	// Client is the client used to make requests
+	// If empty, a client which only connects to public addresses is used
+	Client *http.Client
+
+	// AllowedHosts are the hosts status lists may be fetched from
+	// If empty, status lists may be fetched from any host
+	AllowedHosts []string
+}
+
+var _ StatusListFetcher = (*HTTPStatusListFetcher)(nil)
+
+// defaultStatusListClient refuses to connect to loopback, private, and link-local addresses, so a submitted
+// credential cannot direct the gate to services on its own network
+var defaultStatusListClient = &http.Client{
+	Timeout: 30 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: func(_, address string, _ syscall.RawConn) error {
+				return checkPublicAddress(address)
+			},
+		}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+}
+
+func (f HTTPStatusListFetcher) FetchStatusList(ctx context.Context, statusListURL string) (any, error) {
+	if err := f.checkURL(statusListURL); err != nil {
+		return nil, err
+	}
+	client := defaultStatusListClient
+	if f.Client != nil {
+		client = f.Client
+	}
+	noRedirects := *client
+	noRedirects.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return errors.New("status list redirects are not followed")
+	}
+	client = &noRedirects
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, statusListURL, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating request")
+	}
+	req.Header.Set("Accept", "application/vc+jwt, application/vc+ld+json, application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "performing http get")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unexpected status code fetching status list: %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxStatusListSize))
+	if err != nil {
+		return nil, errors.Wrap(err, "reading status list")
+	}
+
+	// status list credentials secured with a proof are JSON objects, all others are JWTs
+	body = bytes.TrimSpace(body)
+	if bytes.HasPrefix(body, []byte("{")) {
+		var statusListCredential map[string]any
+		if err = json.Unmarshal(body, &statusListCredential); err != nil {
+			return nil, errors.Wrap(err, "unmarshalling status list")
+		}
+		return statusListCredential, nil
+	}
+	return string(body), nil
+}
+
+// checkURL makes sure a status list URL is an https URL of an allowed host
+func (f HTTPStatusListFetcher) checkURL(statusListURL string) error {
+	u, err := url.Parse(statusListURL)
+	if err != nil {
+		return errors.Wrap(err, "parsing status list URL")
+	}
+	if u.Scheme != "https" {
+		return errors.Errorf("status list URL scheme<%s> is not https", u.Scheme)
+	}
+	if len(f.AllowedHosts) > 0 && !contains(f.AllowedHosts, u.Hostname()) {
+		return errors.Errorf("status list host<%s> is not allowed", u.Hostname())
+	}
+	return nil
+}
+
+// checkPublicAddress makes sure the IP address being dialed is not a loopback, private, link-local, or unspecified
+// address
+func checkPublicAddress(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return errors.Wrap(err, "parsing address")
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return errors.Errorf("address<%s> is not an IP address", host)
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+		return errors.Errorf("address<%s> is not public", ip)
+	}
+	return nil
+}
+
+// StaticStatusListFetcher serves status list credentials from memory, keyed by URL
+type StaticStatusListFetcher map[string]any
+
+var _ StatusListFetcher = (StaticStatusListFetcher)(nil)
+
+func (f StaticStatusListFetcher) FetchStatusList(_ context.Context, statusListURL string) (any, error) {
+	statusListCredential, ok := f[statusListURL]
+	if !ok {
+		return nil, errors.Errorf("status list<%s> not found", statusListURL)
+	}
+	return statusListCredential, nil
+}
+
+// statusEntry is a credentialStatus entry of a credential, of type StatusList2021Entry or BitstringStatusListEntry
+// https://www.w3.org/TR/vc-bitstring-status-list/#bitstringstatuslistentry
+type statusEntry struct {
+	Type                 string `json:"type"`
+	StatusPurpose        string `json:"statusPurpose"`
+	StatusListIndex      any    `json:"statusListIndex"`
+	StatusListCredential string `json:"statusListCredential"`
+	StatusSize           int    `json:"statusSize,omitempty"`
+}
+
+// statusList is a verified status list credential with its bitstring expanded
+type statusList struct {
+	issuer    string
+	listType  string
+	purposes  []string
+	bitstring []byte
+}
+
+// checkCredentialStatus checks the status of each submitted credential which has a credentialStatus, denying
+// submissions of revoked or suspended credentials. Status purposes other than revocation and suspension do not
+// affect whether a credential is accepted.
+func (cg *CredentialGate) checkCredentialStatus(ctx context.Context, submitted []submittedCredential) error {
+	// a status list is often shared by many credentials, so each is fetched at most once per submission
+	statusLists := make(map[string]*statusList)
+	for _, sc := range submitted {
+		if isSDJWT(sc.vc) {
+			if err := checkSDJWTStatus(sc.vc.(string)); err != nil {
+				return newInputDescriptorDenial(getReason(err).Code, sc.inputDescriptorID, nil, errors.Wrapf(err, "credential %d", sc.index))
+			}
+			continue
+		}
+		if sc.credential.CredentialStatus == nil {
+			continue
+		}
+		issuer, err := getCredentialIssuer(sc.credential)
+		if err != nil {
+			return newInputDescriptorDenial(ReasonInvalidSubmission, sc.inputDescriptorID, nil, errors.Wrapf(err, "credential %d", sc.index))
+		}
+		entries, err := getStatusEntries(sc.credential.CredentialStatus)
+		if err != nil {
+			return newInputDescriptorDenial(ReasonStatusUnverifiable, sc.inputDescriptorID, nil,
+				errors.Wrapf(err, "credential %d", sc.index))
+		}
+		for _, entry := range entries {
+			if err = cg.checkStatusEntry(ctx, issuer, entry, statusLists); err != nil {
+				reason := getReason(err)
+				return newInputDescriptorDenial(reason.Code, sc.inputDescriptorID, nil,
+					errors.Wrapf(err, "checking status of credential %d", sc.index))
+			}
+		}
+	}
+	return nil
+}
+
+// checkSDJWTStatus denies SD-JWT credentials with a status claim, since the status lists they reference are
+// not supported
+func checkSDJWTStatus(vc string) error {
+	sd, err := parseSDJWT(vc)
+	if err != nil {
+		return newDenial(ReasonInvalidSubmission, err)
+	}
+	if _, ok := sd.claims[statusProperty]; ok {
+		return newDenial(ReasonStatusUnverifiable, errors.New("status of SD-JWT credentials is not supported"))
+	}
+	return nil
+}
+
+// getStatusEntries returns the entries of a credentialStatus property, which is either a single entry or a list
+func getStatusEntries(credentialStatus any) ([]statusEntry, error) {
+	statusBytes, err := json.Marshal(credentialStatus)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshalling credential status")
+	}
+	var entries []statusEntry
+	if _, ok := credentialStatus.([]any); ok {
+		err = json.Unmarshal(statusBytes, &entries)
+	} else {
+		var entry statusEntry
+		err = json.Unmarshal(statusBytes, &entry)
+		entries = append(entries, entry)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "unmarshalling credential status")
+	}
+	return entries, nil
+}
+
+// checkStatusEntry checks the status of a credential in the status list of an entry, which must have been issued by
+// the issuer of the credential
+func (cg *CredentialGate) checkStatusEntry(ctx context.Context, issuer string, entry statusEntry, statusLists map[string]*statusList) error {
+	var denialCode ReasonCode
+	switch entry.StatusPurpose {
+	case revocationPurpose:
+		denialCode = ReasonRevoked
+	case suspensionPurpose:
+		denialCode = ReasonSuspended
+	default:
+		return nil
+	}
+
+	var listType string
+	switch entry.Type {
+	case statusList2021EntryType:
+		listType = statusList2021Type
+	case bitstringStatusListEntryType:
+		listType = bitstringStatusListType
+	default:
+		return newDenial(ReasonStatusUnverifiable, errors.Errorf("unsupported credential status type: %s", entry.Type))
+	}
+	if entry.StatusSize > 1 {
+		return newDenial(ReasonStatusUnverifiable, errors.Errorf("unsupported status size for %s: %d", entry.StatusPurpose, entry.StatusSize))
+	}
+	index, err := getStatusListIndex(entry.StatusListIndex)
+	if err != nil {
+		return newDenial(ReasonStatusUnverifiable, err)
+	}
+
+	list, ok := statusLists[entry.StatusListCredential]
+	if !ok {
+		if list, err = cg.getStatusList(ctx, entry.StatusListCredential); err != nil {
+			return err
+		}
+		statusLists[entry.StatusListCredential] = list
+	}
+	if list.issuer != issuer {
+		return newDenial(ReasonStatusUnverifiable, errors.Errorf("status list<%s> was issued by %s, not the credential issuer %s",
+			entry.StatusListCredential, list.issuer, issuer))
+	}
+	if list.listType != listType {
+		return newDenial(ReasonStatusUnverifiable, errors.Errorf("status list<%s> is a %s, not a %s",
+			entry.StatusListCredential, list.listType, listType))
+	}
+	if !contains(list.purposes, entry.StatusPurpose) {
+		return newDenial(ReasonStatusUnverifiable, errors.Errorf("status list<%s> does not have purpose %s",
+			entry.StatusListCredential, entry.StatusPurpose))
+	}
+
+	set, err := isBitSet(list.bitstring, index)
+	if err != nil {
+		return newDenial(ReasonStatusUnverifiable, errors.Wrapf(err, "status list<%s>", entry.StatusListCredential))
+	}
+	if set {
+		return newDenial(denialCode, errors.Errorf("credential has status %s in status list<%s>", entry.StatusPurpose, entry.StatusListCredential))
+	}
+	return nil
+}
+
+// getStatusList fetches a status list credential, verifies it with the gate's resolver, and expands its bitstring
+func (cg *CredentialGate) getStatusList(ctx context.Context, url string) (*statusList, error) {
+	fetched, err := cg.statusListFetcher.FetchStatusList(ctx, url)
+	if err != nil {
+		return nil, newDenial(ReasonStatusUnverifiable, errors.Wrapf(err, "fetching status list<%s>", url))
+	}
+	if err = verifyCredential(ctx, cg.resolver, cg.documentLoader, cg.validityClock(), fetched); err != nil {
+		return nil, newDenial(ReasonStatusUnverifiable, errors.Wrapf(err, "verifying status list<%s>", url))
+	}
+	_, _, statusListCredential, err := credential.ToCredential(fetched)
+	if err != nil {
+		return nil, newDenial(ReasonStatusUnverifiable, errors.Wrapf(err, "parsing status list<%s>", url))
+	}
+	issuer, err := getCredentialIssuer(*statusListCredential)
+	if err != nil {
+		return nil, newDenial(ReasonStatusUnverifiable, errors.Wrapf(err, "status list<%s>", url))
+	}
+
+	subjectBytes, err := json.Marshal(statusListCredential.CredentialSubject)
+	if err != nil {
+		return nil, newDenial(ReasonStatusUnverifiable, errors.Wrapf(err, "marshalling status list<%s> subject", url))
+	}
+	var subject struct {
+		Type          string `json:"type"`
+		StatusPurpose any    `json:"statusPurpose"`
+		EncodedList   string `json:"encodedList"`
+	}
+	if err = json.Unmarshal(subjectBytes, &subject); err != nil {
+		return nil, newDenial(ReasonStatusUnverifiable, errors.Wrapf(err, "unmarshalling status list<%s> subject", url))
+	}
+	bitstring, err := expandBitstring(subject.EncodedList)
+	if err != nil {
+		return nil, newDenial(ReasonStatusUnverifiable, errors.Wrapf(err, "expanding status list<%s>", url))
+	}
+
+	// a bitstring status list may have more than one purpose
+	var purposes []string
+	switch purpose := subject.StatusPurpose.(type) {
+	case string:
+		purposes = append(purposes, purpose)
+	case []any:
+		for _, p := range purpose {
+			if s, ok := p.(string); ok {
+				purposes = append(purposes, s)
+			}
+		}
+	}
+	return &statusList{issuer: issuer, listType: subject.Type, purposes: purposes, bitstring: bitstring}, nil
+}
+
+// getStatusListIndex parses the index of a credential in a status list, which should be a string but is
+// sometimes a number
+func getStatusListIndex(maybeIndex any) (int, error) {
+	var index int
+	switch i := maybeIndex.(type) {
+	case string:
+		parsed, err := strconv.Atoi(i)
+		if err != nil {
+			return 0, errors.Wrapf(err, "invalid status list index: %s", i)
+		}
+		index = parsed
+	case float64:
+		if i != float64(int(i)) {
+			return 0, errors.Errorf("invalid status list index: %v", i)
+		}
+		index = int(i)
+	default:
+		return 0, errors.Errorf("invalid status list index: %v", maybeIndex)
+	}
+	if index < 0 {
+		return 0, errors.Errorf("invalid status list index: %d", index)
+	}
+	return index, nil
+}
+
+// expandBitstring decodes and decompresses the encoded list of a status list credential as per
+// https://www.w3.org/TR/vc-bitstring-status-list/#bitstring-expansion-algorithm. Bitstring status lists are
+// multibase base64url encoded, while StatusList2021 lists may be base64 or base64url encoded without a multibase
+// prefix; padding is optional for all.
+func expandBitstring(encodedList string) ([]byte, error) {
+	if encodedList == "" {
+		return nil, errors.New("missing encoded list")
+	}
+
+	// GZIP compressed data always starts with 'H' once base64 encoded, so a leading 'u' can only be the prefix
+	// of multibase base64url
+	encodedList = strings.TrimPrefix(encodedList, "u")
+	encodedList = strings.NewReplacer("-", "+", "_", "/").Replace(strings.TrimRight(encodedList, "="))
+	compressed, err := base64.RawStdEncoding.DecodeString(encodedList)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding encoded list")
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, errors.Wrap(err, "decompressing encoded list")
+	}
+	defer zr.Close()
+	bitstring, err := io.ReadAll(io.LimitReader(zr, maxStatusListSize+1))
+	if err != nil {
+		return nil, errors.Wrap(err, "decompressing encoded list")
+	}
+	if len(bitstring) > maxStatusListSize {
+		return nil, errors.New("encoded list is too large")
+	}
+	return bitstring, nil
+}
+
+// isBitSet returns whether the bit at the given index is set, where the first index is the left-most bit
+func isBitSet(bitstring []byte, index int) (bool, error) {
+	if index/8 >= len(bitstring) {
+		return false, errors.Errorf("index %d is out of range of a status list of %d entries", index, len(bitstring)*8)
+	}
+	return bitstring[index/8]&(1<<(7-index%8)) != 0, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
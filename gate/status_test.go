@@ -0,0 +1,355 @@
+package gate
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/TBD54566975/ssi-sdk/credential"
+	"github.com/TBD54566975/ssi-sdk/credential/exchange"
+	"github.com/TBD54566975/ssi-sdk/crypto/jwx"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestCredentialStatus(t *testing.T) {
+	requesterID := "did:test:admin"
+	inputDescriptorID := "name"
+	presentationDefinition := exchange.PresentationDefinition{
+		ID: uuid.New().String(),
+		InputDescriptors: []exchange.InputDescriptor{
+			{
+				ID: inputDescriptorID,
+				Constraints: &exchange.Constraints{
+					Fields: []exchange.Field{{Path: []string{"$.vc.credentialSubject.name"}}},
+				},
+			},
+		},
+	}
+
+	issuer := newTestSigner(t)
+	holder := newTestSigner(t)
+
+	// revocation lists have index 3 set, suspension lists have index 5 set
+	revocationList2021 := "https://example.com/status/revocation/2021"
+	suspensionList2021 := "https://example.com/status/suspension/2021"
+	revocationBitstringList := "https://example.com/status/revocation/bitstring"
+	fetcher := StaticStatusListFetcher{
+		revocationList2021:      buildTestStatusList(t, issuer, revocationList2021, statusList2021Type, revocationPurpose, encodeTestBitstring(t, false, 3)),
+		suspensionList2021:      buildTestStatusList(t, issuer, suspensionList2021, statusList2021Type, suspensionPurpose, encodeTestBitstring(t, false, 5)),
+		revocationBitstringList: buildTestStatusList(t, issuer, revocationBitstringList, bitstringStatusListType, revocationPurpose, encodeTestBitstring(t, true, 3)),
+	}
+
+	credentialWithStatus := func(t *testing.T, credentialStatus any) []byte {
+		vcJWT, err := credential.SignVerifiableCredentialJWT(issuer, credential.VerifiableCredential{
+			Context:           []any{"https://www.w3.org/2018/credentials/v1"},
+			Type:              []string{"VerifiableCredential"},
+			Issuer:            issuer.ID,
+			IssuanceDate:      time.Now().Format(time.RFC3339),
+			CredentialSubject: map[string]any{"id": holder.ID, "name": "Satoshi"},
+			CredentialStatus:  credentialStatus,
+		})
+		require.NoError(t, err)
+		return vcJWT
+	}
+	entry := func(entryType, purpose, index, list string) map[string]any {
+		return map[string]any{
+			"id":                   list + "#" + index,
+			"type":                 entryType,
+			"statusPurpose":        purpose,
+			"statusListIndex":      index,
+			"statusListCredential": list,
+		}
+	}
+	validate := func(t *testing.T, fetcher StatusListFetcher, vcJWT []byte) (*Result, error) {
+		gate, err := NewCredentialGate(CredentialGateConfig{
+			AdminDID:               requesterID,
+			PresentationDefinition: presentationDefinition,
+			StatusListFetcher:      fetcher,
+		})
+		require.NoError(t, err)
+		submissionJWT := buildTestSubmissionJWT(t, holder, requesterID, presentationDefinition, [][]byte{vcJWT}, nil)
+		return gate.ValidatePresentationSubmission(context.Background(), submissionJWT)
+	}
+
+	t.Run("credential without status", func(tt *testing.T) {
+		result, err := validate(tt, fetcher, credentialWithStatus(tt, nil))
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+	})
+
+	t.Run("credential not revoked", func(tt *testing.T) {
+		vcJWT := credentialWithStatus(tt, entry(statusList2021EntryType, revocationPurpose, "4", revocationList2021))
+		result, err := validate(tt, fetcher, vcJWT)
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+	})
+
+	t.Run("credential revoked", func(tt *testing.T) {
+		vcJWT := credentialWithStatus(tt, entry(statusList2021EntryType, revocationPurpose, "3", revocationList2021))
+		result, err := validate(tt, fetcher, vcJWT)
+		assert.Error(tt, err)
+		assert.False(tt, result.Valid)
+		assert.Equal(tt, ReasonRevoked, result.Reason.Code)
+		assert.Equal(tt, inputDescriptorID, result.Reason.InputDescriptorID)
+	})
+
+	t.Run("credential suspended", func(tt *testing.T) {
+		vcJWT := credentialWithStatus(tt, []any{
+			entry(statusList2021EntryType, revocationPurpose, "5", revocationList2021),
+			entry(statusList2021EntryType, suspensionPurpose, "5", suspensionList2021),
+		})
+		result, err := validate(tt, fetcher, vcJWT)
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonSuspended, result.Reason.Code)
+	})
+
+	t.Run("credential revoked in bitstring status list", func(tt *testing.T) {
+		vcJWT := credentialWithStatus(tt, entry(bitstringStatusListEntryType, revocationPurpose, "3", revocationBitstringList))
+		result, err := validate(tt, fetcher, vcJWT)
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonRevoked, result.Reason.Code)
+
+		vcJWT = credentialWithStatus(tt, entry(bitstringStatusListEntryType, revocationPurpose, "2", revocationBitstringList))
+		result, err = validate(tt, fetcher, vcJWT)
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+	})
+
+	t.Run("other status purposes are ignored", func(tt *testing.T) {
+		vcJWT := credentialWithStatus(tt, entry(bitstringStatusListEntryType, "refresh", "3", "https://example.com/unknown"))
+		result, err := validate(tt, fetcher, vcJWT)
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+	})
+
+	t.Run("status list type mismatch", func(tt *testing.T) {
+		vcJWT := credentialWithStatus(tt, entry(bitstringStatusListEntryType, revocationPurpose, "4", revocationList2021))
+		result, err := validate(tt, fetcher, vcJWT)
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonStatusUnverifiable, result.Reason.Code)
+	})
+
+	t.Run("status purpose mismatch", func(tt *testing.T) {
+		vcJWT := credentialWithStatus(tt, entry(statusList2021EntryType, suspensionPurpose, "4", revocationList2021))
+		result, err := validate(tt, fetcher, vcJWT)
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonStatusUnverifiable, result.Reason.Code)
+	})
+
+	t.Run("status list not found", func(tt *testing.T) {
+		vcJWT := credentialWithStatus(tt, entry(statusList2021EntryType, revocationPurpose, "4", "https://example.com/missing"))
+		result, err := validate(tt, fetcher, vcJWT)
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonStatusUnverifiable, result.Reason.Code)
+		assert.Equal(tt, inputDescriptorID, result.Reason.InputDescriptorID)
+	})
+
+	t.Run("status list with invalid signature", func(tt *testing.T) {
+		forger := newTestSigner(tt)
+		forger.ID = issuer.ID
+		forger.KID = issuer.KID
+		forgedFetcher := StaticStatusListFetcher{
+			revocationList2021: buildTestStatusList(tt, forger, revocationList2021, statusList2021Type, revocationPurpose, encodeTestBitstring(tt, false)),
+		}
+		vcJWT := credentialWithStatus(tt, entry(statusList2021EntryType, revocationPurpose, "3", revocationList2021))
+		result, err := validate(tt, forgedFetcher, vcJWT)
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonStatusUnverifiable, result.Reason.Code)
+	})
+
+	t.Run("status list index out of range", func(tt *testing.T) {
+		vcJWT := credentialWithStatus(tt, entry(statusList2021EntryType, revocationPurpose, "1000000", revocationList2021))
+		result, err := validate(tt, fetcher, vcJWT)
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonStatusUnverifiable, result.Reason.Code)
+	})
+
+	t.Run("status list issued by another issuer", func(tt *testing.T) {
+		other := newTestSigner(tt)
+		otherFetcher := StaticStatusListFetcher{
+			revocationList2021: buildTestStatusList(tt, other, revocationList2021, statusList2021Type, revocationPurpose, encodeTestBitstring(tt, false)),
+		}
+		vcJWT := credentialWithStatus(tt, entry(statusList2021EntryType, revocationPurpose, "3", revocationList2021))
+		result, err := validate(tt, otherFetcher, vcJWT)
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonStatusUnverifiable, result.Reason.Code)
+		assert.Contains(tt, result.Reason.Message, "not the credential issuer")
+	})
+
+	t.Run("retried after status list fetch fails", func(tt *testing.T) {
+		gate, err := NewCredentialGate(CredentialGateConfig{
+			AdminDID:               requesterID,
+			PresentationDefinition: presentationDefinition,
+			StatusListFetcher:      &failingStatusListFetcher{StatusListFetcher: fetcher, failures: 1},
+			RequireChallenge:       true,
+		})
+		require.NoError(tt, err)
+		challenge, err := gate.NewChallenge(context.Background())
+		require.NoError(tt, err)
+		vcJWT := credentialWithStatus(tt, entry(statusList2021EntryType, revocationPurpose, "4", revocationList2021))
+		submissionJWT := buildTestSubmissionJWT(tt, holder, requesterID, presentationDefinition, [][]byte{vcJWT},
+			map[string]any{"nonce": challenge.Nonce, "jti": uuid.NewString()})
+
+		result, err := gate.ValidatePresentationSubmission(context.Background(), submissionJWT)
+		assert.Error(tt, err)
+		assert.False(tt, result.Valid)
+
+		// the failed attempt consumed neither the challenge nor the jti
+		result, err = gate.ValidatePresentationSubmission(context.Background(), submissionJWT)
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+	})
+
+	t.Run("status list fetched over HTTP", func(tt *testing.T) {
+		defer gock.Off()
+		gock.New("https://example.com").
+			Get("/status/revocation/2021").
+			Reply(200).
+			BodyString(fetcher[revocationList2021].(string))
+		client := &http.Client{}
+		gock.InterceptClient(client)
+
+		vcJWT := credentialWithStatus(tt, entry(statusList2021EntryType, revocationPurpose, "3", revocationList2021))
+		result, err := validate(tt, HTTPStatusListFetcher{Client: client, AllowedHosts: []string{"example.com"}}, vcJWT)
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonRevoked, result.Reason.Code)
+		assert.True(tt, gock.IsDone())
+	})
+}
+
+// failingStatusListFetcher fails to fetch status lists the given number of times before fetching them as usual
+type failingStatusListFetcher struct {
+	StatusListFetcher
+	failures int
+}
+
+func (f *failingStatusListFetcher) FetchStatusList(ctx context.Context, url string) (any, error) {
+	if f.failures > 0 {
+		f.failures--
+		return nil, errors.New("status list unavailable")
+	}
+	return f.StatusListFetcher.FetchStatusList(ctx, url)
+}
+
+func TestHTTPStatusListFetcher(t *testing.T) {
+	t.Run("only https URLs are fetched", func(tt *testing.T) {
+		_, err := HTTPStatusListFetcher{}.FetchStatusList(context.Background(), "http://example.com/status")
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "is not https")
+
+		_, err = HTTPStatusListFetcher{}.FetchStatusList(context.Background(), "file:///etc/passwd")
+		assert.Error(tt, err)
+	})
+
+	t.Run("only allowed hosts are fetched", func(tt *testing.T) {
+		fetcher := HTTPStatusListFetcher{AllowedHosts: []string{"status.example.com"}}
+		_, err := fetcher.FetchStatusList(context.Background(), "https://other.example.com/status")
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "is not allowed")
+	})
+
+	t.Run("redirects are not followed", func(tt *testing.T) {
+		defer gock.Off()
+		gock.New("https://example.com").
+			Get("/status").
+			Reply(http.StatusFound).
+			SetHeader("Location", "https://internal.example.com/status")
+		client := &http.Client{}
+		gock.InterceptClient(client)
+
+		_, err := HTTPStatusListFetcher{Client: client}.FetchStatusList(context.Background(), "https://example.com/status")
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "redirects are not followed")
+	})
+
+	t.Run("non-public addresses are not fetched", func(tt *testing.T) {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte("status list"))
+		}))
+		defer server.Close()
+
+		_, err := HTTPStatusListFetcher{}.FetchStatusList(context.Background(), server.URL)
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "is not public")
+
+		assert.Error(tt, checkPublicAddress("10.0.0.1:443"))
+		assert.Error(tt, checkPublicAddress("169.254.169.254:80"))
+		assert.Error(tt, checkPublicAddress("[::1]:443"))
+		assert.NoError(tt, checkPublicAddress("93.184.216.34:443"))
+	})
+}
+
+func TestExpandBitstring(t *testing.T) {
+	t.Run("bitstring status list example", func(tt *testing.T) {
+		// https://www.w3.org/TR/vc-bitstring-status-list/#example-example-bitstringstatuslistcredential
+		bitstring, err := expandBitstring("uH4sIAAAAAAAAA-3BMQEAAADCoPVPbQwfoAAAAAAAAAAAAAAAAAAAAIC3AYbSVKsAQAAA")
+		assert.NoError(tt, err)
+		assert.Len(tt, bitstring, 16*1024)
+		assert.Equal(tt, make([]byte, 16*1024), bitstring)
+	})
+
+	t.Run("bits are indexed from the left", func(tt *testing.T) {
+		bitstring, err := expandBitstring(encodeTestBitstring(tt, false, 0, 9))
+		assert.NoError(tt, err)
+		for i, expected := range []bool{true, false, false, false, false, false, false, false, false, true, false} {
+			set, err := isBitSet(bitstring, i)
+			assert.NoError(tt, err)
+			assert.Equal(tt, expected, set, i)
+		}
+	})
+
+	t.Run("invalid encoded list", func(tt *testing.T) {
+		_, err := expandBitstring("")
+		assert.Error(tt, err)
+
+		_, err = expandBitstring("not!base64")
+		assert.Error(tt, err)
+
+		_, err = expandBitstring(base64.StdEncoding.EncodeToString([]byte("not gzip")))
+		assert.Error(tt, err)
+	})
+}
+
+// encodeTestBitstring encodes a 16KB bitstring with the given indices set, multibase encoded if required
+func encodeTestBitstring(t *testing.T, multibase bool, setIndices ...int) string {
+	bitstring := make([]byte, 16*1024)
+	for _, i := range setIndices {
+		bitstring[i/8] |= 1 << (7 - i%8)
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write(bitstring)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	if multibase {
+		return "u" + base64.RawURLEncoding.EncodeToString(buf.Bytes())
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func buildTestStatusList(t *testing.T, signer jwx.Signer, url, listType, purpose, encodedList string) string {
+	statusListJWT, err := credential.SignVerifiableCredentialJWT(signer, credential.VerifiableCredential{
+		Context:      []any{"https://www.w3.org/2018/credentials/v1"},
+		ID:           url,
+		Type:         []string{"VerifiableCredential", listType + "Credential"},
+		Issuer:       signer.ID,
+		IssuanceDate: time.Now().Format(time.RFC3339),
+		CredentialSubject: map[string]any{
+			"id":            url + "#list",
+			"type":          listType,
+			"statusPurpose": purpose,
+			"encodedList":   encodedList,
+		},
+	})
+	require.NoError(t, err)
+	return string(statusListJWT)
+}
@@ -0,0 +1,113 @@
+package gate
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultStoreShards = 32
+	storeSweepInterval = time.Minute
+)
+
+// ReplayStore records the IDs of presentation submissions accepted by the gate so that a captured
+// submission cannot be replayed.
+type ReplayStore interface {
+	// CheckAndStore records the submission ID until the given expiry. It returns false if the ID
+	// has already been recorded and has not yet expired.
+	CheckAndStore(ctx context.Context, id string, expiry time.Time) (bool, error)
+}
+
+// NonceStore holds the challenges issued by the gate until they are answered or expire.
+type NonceStore interface {
+	// Put records an outstanding nonce until the given expiry.
+	Put(ctx context.Context, nonce string, expiry time.Time) error
+	// Consume removes a nonce, returning true if it was outstanding and had not expired.
+	Consume(ctx context.Context, nonce string) (bool, error)
+}
+
+// MemoryStore is an in-memory ReplayStore and NonceStore. Entries are spread across a number of
+// shards, each with its own lock, and expired entries are evicted as shards are written to.
+type MemoryStore struct {
+	shards []*memoryShard
+}
+
+var (
+	_ ReplayStore = (*MemoryStore)(nil)
+	_ NonceStore  = (*MemoryStore)(nil)
+)
+
+type memoryShard struct {
+	mu        sync.Mutex
+	entries   map[string]time.Time
+	lastSweep time.Time
+}
+
+// NewMemoryStore creates a new MemoryStore with the given number of shards
+// If shards is not positive, a default number of shards is used
+func NewMemoryStore(shards int) *MemoryStore {
+	if shards <= 0 {
+		shards = defaultStoreShards
+	}
+	s := MemoryStore{shards: make([]*memoryShard, shards)}
+	for i := range s.shards {
+		s.shards[i] = &memoryShard{entries: make(map[string]time.Time), lastSweep: time.Now()}
+	}
+	return &s
+}
+
+func (s *MemoryStore) CheckAndStore(_ context.Context, id string, expiry time.Time) (bool, error) {
+	shard := s.shardFor(id)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	now := time.Now()
+	shard.sweep(now)
+	if existing, ok := shard.entries[id]; ok && now.Before(existing) {
+		return false, nil
+	}
+	shard.entries[id] = expiry
+	return true, nil
+}
+
+func (s *MemoryStore) Put(_ context.Context, nonce string, expiry time.Time) error {
+	shard := s.shardFor(nonce)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	shard.sweep(time.Now())
+	shard.entries[nonce] = expiry
+	return nil
+}
+
+func (s *MemoryStore) Consume(_ context.Context, nonce string) (bool, error) {
+	shard := s.shardFor(nonce)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	expiry, ok := shard.entries[nonce]
+	if !ok {
+		return false, nil
+	}
+	delete(shard.entries, nonce)
+	return time.Now().Before(expiry), nil
+}
+
+func (s *MemoryStore) shardFor(key string) *memoryShard {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return s.shards[h.Sum32()%uint32(len(s.shards))]
+}
+
+// sweep evicts expired entries from the shard, at most once per sweep interval
+// the caller must hold the shard's lock
+func (m *memoryShard) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < storeSweepInterval {
+		return
+	}
+	for k, expiry := range m.entries {
+		if !now.Before(expiry) {
+			delete(m.entries, k)
+		}
+	}
+	m.lastSweep = now
+}
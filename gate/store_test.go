@@ -0,0 +1,82 @@
+package gate
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStore(t *testing.T) {
+	t.Run("check and store", func(tt *testing.T) {
+		store := NewMemoryStore(4)
+		id := uuid.NewString()
+
+		fresh, err := store.CheckAndStore(context.Background(), id, time.Now().Add(time.Hour))
+		assert.NoError(tt, err)
+		assert.True(tt, fresh)
+
+		fresh, err = store.CheckAndStore(context.Background(), id, time.Now().Add(time.Hour))
+		assert.NoError(tt, err)
+		assert.False(tt, fresh)
+	})
+
+	t.Run("expired submission IDs can be stored again", func(tt *testing.T) {
+		store := NewMemoryStore(4)
+		id := uuid.NewString()
+
+		fresh, err := store.CheckAndStore(context.Background(), id, time.Now().Add(-time.Second))
+		assert.NoError(tt, err)
+		assert.True(tt, fresh)
+
+		fresh, err = store.CheckAndStore(context.Background(), id, time.Now().Add(time.Hour))
+		assert.NoError(tt, err)
+		assert.True(tt, fresh)
+	})
+
+	t.Run("put and consume", func(tt *testing.T) {
+		store := NewMemoryStore(4)
+		nonce := uuid.NewString()
+
+		consumed, err := store.Consume(context.Background(), nonce)
+		assert.NoError(tt, err)
+		assert.False(tt, consumed)
+
+		assert.NoError(tt, store.Put(context.Background(), nonce, time.Now().Add(time.Hour)))
+		consumed, err = store.Consume(context.Background(), nonce)
+		assert.NoError(tt, err)
+		assert.True(tt, consumed)
+
+		// nonces can only be consumed once
+		consumed, err = store.Consume(context.Background(), nonce)
+		assert.NoError(tt, err)
+		assert.False(tt, consumed)
+
+		// expired nonces cannot be consumed
+		assert.NoError(tt, store.Put(context.Background(), nonce, time.Now().Add(-time.Second)))
+		consumed, err = store.Consume(context.Background(), nonce)
+		assert.NoError(tt, err)
+		assert.False(tt, consumed)
+	})
+
+	t.Run("expired entries are evicted", func(tt *testing.T) {
+		store := NewMemoryStore(1)
+		shard := store.shards[0]
+
+		for i := 0; i < 10; i++ {
+			_, err := store.CheckAndStore(context.Background(), uuid.NewString(), time.Now().Add(-time.Second))
+			assert.NoError(tt, err)
+		}
+		assert.Len(tt, shard.entries, 10)
+
+		// force the next write to sweep the shard
+		shard.lastSweep = time.Now().Add(-2 * storeSweepInterval)
+		id := uuid.NewString()
+		_, err := store.CheckAndStore(context.Background(), id, time.Now().Add(time.Hour))
+		assert.NoError(tt, err)
+		assert.Len(tt, shard.entries, 1)
+		assert.Contains(tt, shard.entries, id)
+	})
+}
@@ -0,0 +1,363 @@
+package gate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/TBD54566975/ssi-sdk/credential"
+	"github.com/TBD54566975/ssi-sdk/credential/exchange"
+	"github.com/TBD54566975/ssi-sdk/util"
+	"github.com/google/uuid"
+	"github.com/oliveagle/jsonpath"
+	"github.com/pkg/errors"
+)
+
+// verifySubmission selects the presentation definition the VP is validated against and verifies the VP's
+// credentials fulfill it, returning the verified submission data for each input descriptor. If the VP does not
+// contain a presentation submission, one is built in place by matching the VP's credentials against the
+// presentation definition's input descriptors, and set on the VP so later stages know which credential was
+// submitted for each input descriptor. No signature verification happens here, so a presentation submission may
+// only point to the credentials of the VP, whose signatures are verified beforehand.
+func (cg *CredentialGate) verifySubmission(ctx context.Context, definitionKey string, vp *credential.VerifiablePresentation) (*PresentationDefinitionConfig, []exchange.VerifiedSubmissionData, error) {
+	definition, err := cg.selectDefinition(definitionKey, *vp)
+	if err != nil {
+		return definition, nil, err
+	}
+	def := definition.PresentationDefinition
+	if err = checkSubmissionPaths(*vp); err != nil {
+		return definition, nil, err
+	}
+	traceFromContext(ctx).addInputDescriptors(def, *vp)
+	if vp.PresentationSubmission == nil {
+		submission, err := buildPresentationSubmission(def, *vp)
+		if err != nil {
+			return definition, nil, errors.Wrap(err, "building presentation submission")
+		}
+		vp.PresentationSubmission = *submission
+	}
+	if len(def.SubmissionRequirements) > 0 {
+		verifiedSubmissionData, err := verifySubmissionRequirements(def, vp)
+		return definition, verifiedSubmissionData, err
+	}
+	if containsSDJWT(*vp) {
+		// presentation submissions with SD-JWT credentials are not understood by the SDK, so each submission
+		// descriptor is verified on its own
+		verifiedSubmissionData, err := verifyEachSubmissionDescriptor(def, *vp)
+		return definition, verifiedSubmissionData, err
+	}
+	verifiedSubmissionData, err := exchange.VerifyPresentationSubmissionVP(def, *vp)
+	if err != nil {
+		return definition, nil, diagnoseSubmissionFailure(def, *vp, err)
+	}
+	verifiedSubmissionData, err = verifyAllSubmissionDescriptors(def, *vp, verifiedSubmissionData)
+	return definition, verifiedSubmissionData, err
+}
+
+// submissionPathPattern matches the only submission descriptor paths accepted, those of a credential of the VP
+var submissionPathPattern = regexp.MustCompile(`^\$\.verifiableCredential\[(0|[1-9][0-9]*)\]$`)
+
+// checkSubmissionPaths makes sure each submission descriptor of the VP's presentation submission, if it has one,
+// points to a credential of the VP, so that only credentials whose signatures are verified are evaluated
+func checkSubmissionPaths(vp credential.VerifiablePresentation) error {
+	if vp.PresentationSubmission == nil {
+		return nil
+	}
+	submission, err := toPresentationSubmission(vp.PresentationSubmission)
+	if err != nil {
+		return newDenial(ReasonInvalidSubmission, err)
+	}
+	for _, d := range submission.DescriptorMap {
+		if _, err = credentialIndex(d, vp); err != nil {
+			return newInputDescriptorDenial(ReasonInvalidSubmission, d.ID, nil, err)
+		}
+	}
+	return nil
+}
+
+// credentialIndex returns the index of the credential of the VP a submission descriptor points to. Nested paths
+// are not supported, and the path must be exactly $.verifiableCredential[n] for a credential of the VP.
+func credentialIndex(d exchange.SubmissionDescriptor, vp credential.VerifiablePresentation) (int, error) {
+	if d.PathNested != nil {
+		return 0, errors.Errorf("submission descriptor<%s> has a nested path, which is not supported", d.ID)
+	}
+	match := submissionPathPattern.FindStringSubmatch(d.Path)
+	if match == nil {
+		return 0, errors.Errorf("submission descriptor<%s> path<%s> does not point to a credential of the VP", d.ID, d.Path)
+	}
+	index, err := strconv.Atoi(match[1])
+	if err != nil || index >= len(vp.VerifiableCredential) {
+		return 0, errors.Errorf("submission descriptor<%s> path<%s> points past the %d credentials of the VP", d.ID, d.Path, len(vp.VerifiableCredential))
+	}
+	return index, nil
+}
+
+// submittedCredential is a credential of the VP submitted for an input descriptor
+type submittedCredential struct {
+	inputDescriptorID string
+	// index is the index of the credential in the VP
+	index int
+	// vc is the credential as embedded in the VP
+	vc         any
+	credential credential.VerifiableCredential
+}
+
+// claims returns the claims of the credential which are mapped to attributes and selected into access tokens: the
+// credential in the VC data model, or the disclosed claims of an SD-JWT credential
+func (sc submittedCredential) claims() (map[string]any, error) {
+	if isSDJWT(sc.vc) {
+		sd, err := parseSDJWT(sc.vc.(string))
+		if err != nil {
+			return nil, err
+		}
+		return sd.claims, nil
+	}
+	cred, _, err := getExpressionClaims(sc.vc)
+	return cred, err
+}
+
+// getSubmittedCredentials returns the credential each submission descriptor of the VP's presentation submission
+// points to, once the submission is verified. Only credentials of the VP are returned, so each has had its
+// signature verified.
+func getSubmittedCredentials(vp credential.VerifiablePresentation) ([]submittedCredential, error) {
+	submission, err := toPresentationSubmission(vp.PresentationSubmission)
+	if err != nil {
+		return nil, newDenial(ReasonInvalidSubmission, err)
+	}
+	submitted := make([]submittedCredential, 0, len(submission.DescriptorMap))
+	for _, d := range submission.DescriptorMap {
+		index, err := credentialIndex(d, vp)
+		if err != nil {
+			return nil, newInputDescriptorDenial(ReasonInvalidSubmission, d.ID, nil, err)
+		}
+		vc := vp.VerifiableCredential[index]
+		cred, err := toCredential(vc)
+		if err != nil {
+			return nil, newInputDescriptorDenial(ReasonInvalidSubmission, d.ID, nil,
+				errors.Wrapf(err, "parsing credential for submission descriptor<%s>", d.ID))
+		}
+		submitted = append(submitted, submittedCredential{inputDescriptorID: d.ID, index: index, vc: vc, credential: *cred})
+	}
+	return submitted, nil
+}
+
+// diagnoseSubmissionFailure finds the input descriptor, and where possible the field, which a presentation
+// submission failed to fulfill
+func diagnoseSubmissionFailure(def exchange.PresentationDefinition, vp credential.VerifiablePresentation, err error) error {
+	submission, parseErr := toPresentationSubmission(vp.PresentationSubmission)
+	if parseErr != nil {
+		return newDenial(ReasonInvalidSubmission, err)
+	}
+	for _, inputDescriptor := range def.InputDescriptors {
+		var fulfilled bool
+		for _, d := range submission.DescriptorMap {
+			if d.ID != inputDescriptor.ID {
+				continue
+			}
+			fulfilled = true
+			if _, descriptorErr := verifySubmissionDescriptor(def.ID, inputDescriptor, d, vp); descriptorErr == nil {
+				continue
+			}
+			return newInputDescriptorDenial(ReasonConstraintFailed, inputDescriptor.ID, findFailedField(def.ID, inputDescriptor, d, vp), err)
+		}
+		if !fulfilled {
+			return newInputDescriptorDenial(ReasonConstraintFailed, inputDescriptor.ID, nil, err)
+		}
+	}
+	return newDenial(ReasonInvalidSubmission, err)
+}
+
+// findFailedField returns the path of the first required field of the input descriptor that the submitted
+// claim does not fulfill on its own, or nil if the failure is not due to a single field
+func findFailedField(definitionID string, inputDescriptor exchange.InputDescriptor, descriptor exchange.SubmissionDescriptor, vp credential.VerifiablePresentation) []string {
+	if inputDescriptor.Constraints == nil {
+		return nil
+	}
+	for _, field := range inputDescriptor.Constraints.Fields {
+		if field.Optional {
+			continue
+		}
+		fieldDescriptor := inputDescriptor
+		fieldDescriptor.Constraints = &exchange.Constraints{Fields: []exchange.Field{field}}
+		if _, err := verifySubmissionDescriptor(definitionID, fieldDescriptor, descriptor, vp); err != nil {
+			return field.Path
+		}
+	}
+	return nil
+}
+
+// buildPresentationSubmission builds a presentation submission for a VP which omits one. For each input
+// descriptor the first credential in the VP that fulfills it is used; a credential may fulfill more than
+// one input descriptor. If any input descriptor cannot be fulfilled, an error is returned, unless the
+// presentation definition has submission requirements, which decide which input descriptors must be fulfilled.
+func buildPresentationSubmission(def exchange.PresentationDefinition, vp credential.VerifiablePresentation) (*exchange.PresentationSubmission, error) {
+	submission := exchange.PresentationSubmission{
+		ID:           uuid.NewString(),
+		DefinitionID: def.ID,
+	}
+	for _, inputDescriptor := range def.InputDescriptors {
+		descriptor, ok := matchInputDescriptor(def.ID, inputDescriptor, vp)
+		if !ok && len(def.SubmissionRequirements) > 0 {
+			continue
+		}
+		if !ok {
+			return nil, newInputDescriptorDenial(ReasonConstraintFailed, inputDescriptor.ID, nil,
+				errors.Errorf("input descriptor<%s> could not be fulfilled by any credential in the presentation", inputDescriptor.ID))
+		}
+		submission.DescriptorMap = append(submission.DescriptorMap, *descriptor)
+	}
+	return &submission, nil
+}
+
+// matchInputDescriptor finds the first credential in the VP which fulfills the input descriptor, returning
+// a submission descriptor pointing to it
+func matchInputDescriptor(definitionID string, inputDescriptor exchange.InputDescriptor, vp credential.VerifiablePresentation) (*exchange.SubmissionDescriptor, bool) {
+	for i, vc := range vp.VerifiableCredential {
+		descriptor := exchange.SubmissionDescriptor{
+			ID:     inputDescriptor.ID,
+			Format: getCredentialFormat(vc),
+			Path:   fmt.Sprintf("$.verifiableCredential[%d]", i),
+		}
+		if _, err := verifySubmissionDescriptor(definitionID, inputDescriptor, descriptor, vp); err == nil {
+			return &descriptor, true
+		}
+	}
+	return nil, false
+}
+
+// verifySubmissionDescriptor checks that the claim a single submission descriptor points to fulfills the
+// input descriptor, using the same verification as a complete submission. SD-JWT claims are checked against
+// their disclosed claims. No signature verification happens here.
+func verifySubmissionDescriptor(definitionID string, inputDescriptor exchange.InputDescriptor, descriptor exchange.SubmissionDescriptor, vp credential.VerifiablePresentation) ([]exchange.VerifiedSubmissionData, error) {
+	if containsSDJWT(vp) {
+		vpJSON, err := util.ToJSONMap(vp)
+		if err != nil {
+			return nil, errors.Wrap(err, "converting VP to JSON")
+		}
+		claim, err := jsonpath.JsonPathLookup(vpJSON, descriptor.Path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "resolving submission descriptor<%s> with path: %s", descriptor.ID, descriptor.Path)
+		}
+		if isSDJWT(claim) {
+			return verifyDisclosedClaims(inputDescriptor, claim.(string))
+		}
+	}
+	trialDefinition := exchange.PresentationDefinition{
+		ID:               definitionID,
+		InputDescriptors: []exchange.InputDescriptor{inputDescriptor},
+	}
+	trialVP := vp
+	trialVP.PresentationSubmission = exchange.PresentationSubmission{
+		ID:            uuid.NewString(),
+		DefinitionID:  definitionID,
+		DescriptorMap: []exchange.SubmissionDescriptor{descriptor},
+	}
+	return exchange.VerifyPresentationSubmissionVP(trialDefinition, trialVP)
+}
+
+// verifyAllSubmissionDescriptors accounts for submissions in which several credentials fulfill a single input
+// descriptor. Verification of a presentation submission only yields data for one submission descriptor per
+// input descriptor, so when an input descriptor is referenced more than once each submission descriptor is
+// verified on its own. The signatures of all credentials in the VP must already have been verified.
+func verifyAllSubmissionDescriptors(def exchange.PresentationDefinition, vp credential.VerifiablePresentation, verified []exchange.VerifiedSubmissionData) ([]exchange.VerifiedSubmissionData, error) {
+	if vp.PresentationSubmission == nil {
+		return verified, nil
+	}
+	submission, err := toPresentationSubmission(vp.PresentationSubmission)
+	if err != nil {
+		return nil, newDenial(ReasonInvalidSubmission, err)
+	}
+	counts := make(map[string]int)
+	hasDuplicates := false
+	for _, d := range submission.DescriptorMap {
+		counts[d.ID]++
+		hasDuplicates = hasDuplicates || counts[d.ID] > 1
+	}
+	if !hasDuplicates {
+		return verified, nil
+	}
+	return verifyEachSubmissionDescriptor(def, vp)
+}
+
+// verifyEachSubmissionDescriptor verifies every submission descriptor of the VP's presentation submission on its
+// own, making sure each input descriptor is fulfilled by at least one of them
+func verifyEachSubmissionDescriptor(def exchange.PresentationDefinition, vp credential.VerifiablePresentation) ([]exchange.VerifiedSubmissionData, error) {
+	submission, err := getPresentationSubmission(def, vp)
+	if err != nil {
+		return nil, err
+	}
+	var allVerified []exchange.VerifiedSubmissionData
+	for _, inputDescriptor := range def.InputDescriptors {
+		fulfilled := false
+		for _, d := range submission.DescriptorMap {
+			if d.ID != inputDescriptor.ID {
+				continue
+			}
+			fulfilled = true
+			data, err := verifySubmissionDescriptor(def.ID, inputDescriptor, d, vp)
+			if err != nil {
+				return nil, newInputDescriptorDenial(ReasonConstraintFailed, d.ID, findFailedField(def.ID, inputDescriptor, d, vp),
+					errors.Wrapf(err, "verifying submission descriptor<%s> with path: %s", d.ID, d.Path))
+			}
+			allVerified = append(allVerified, data...)
+		}
+		if !fulfilled {
+			return nil, newInputDescriptorDenial(ReasonConstraintFailed, inputDescriptor.ID, nil,
+				errors.Errorf("unfulfilled input descriptor<%s>; submission not valid", inputDescriptor.ID))
+		}
+	}
+	return allVerified, nil
+}
+
+// getPresentationSubmission returns the VP's presentation submission, making sure it is well formed and is for
+// the presentation definition
+func getPresentationSubmission(def exchange.PresentationDefinition, vp credential.VerifiablePresentation) (*exchange.PresentationSubmission, error) {
+	submission, err := toPresentationSubmission(vp.PresentationSubmission)
+	if err != nil {
+		return nil, newDenial(ReasonInvalidSubmission, err)
+	}
+	if err = util.IsValidStruct(*submission); err != nil {
+		return nil, newDenial(ReasonInvalidSubmission, errors.Wrap(err, "invalid presentation submission"))
+	}
+	if submission.DefinitionID != def.ID {
+		return nil, newDenial(ReasonInvalidSubmission, errors.Errorf("mismatched between presentation definition ID<%s> and submission's definition ID<%s>",
+			def.ID, submission.DefinitionID))
+	}
+	return submission, nil
+}
+
+// containsSDJWT returns whether any credential in the VP is an SD-JWT
+func containsSDJWT(vp credential.VerifiablePresentation) bool {
+	for _, vc := range vp.VerifiableCredential {
+		if isSDJWT(vc) {
+			return true
+		}
+	}
+	return false
+}
+
+func toPresentationSubmission(maybeSubmission any) (*exchange.PresentationSubmission, error) {
+	submissionBytes, err := json.Marshal(maybeSubmission)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshalling presentation submission")
+	}
+	var submission exchange.PresentationSubmission
+	if err = json.Unmarshal(submissionBytes, &submission); err != nil {
+		return nil, errors.Wrap(err, "unmarshalling presentation submission")
+	}
+	return &submission, nil
+}
+
+// getCredentialFormat returns the claim format of a credential embedded in a VP: JWT and SD-JWT credentials are
+// represented as strings, and all others are assumed to be secured with a linked data proof
+func getCredentialFormat(vc any) string {
+	if isSDJWT(vc) {
+		return sdJWTFormat
+	}
+	if _, ok := vc.(string); ok {
+		return exchange.JWTVC.String()
+	}
+	return exchange.LDPVC.String()
+}
@@ -0,0 +1,176 @@
+package gate
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/TBD54566975/ssi-sdk/credential"
+	"github.com/TBD54566975/ssi-sdk/credential/exchange"
+	"github.com/TBD54566975/ssi-sdk/crypto"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPresentationWithoutSubmission(t *testing.T) {
+	requesterID := "did:test:admin"
+	presentationDefinition := exchange.PresentationDefinition{
+		ID: uuid.New().String(),
+		InputDescriptors: []exchange.InputDescriptor{
+			{
+				ID: "name",
+				Format: &exchange.ClaimFormat{
+					JWTVC: &exchange.JWTType{Alg: []crypto.SignatureAlgorithm{crypto.EdDSA}},
+				},
+				Constraints: &exchange.Constraints{
+					Fields: []exchange.Field{
+						{
+							Path: []string{"$.vc.credentialSubject.name"},
+						},
+					},
+				},
+			},
+			{
+				ID: "email",
+				Format: &exchange.ClaimFormat{
+					JWTVC: &exchange.JWTType{Alg: []crypto.SignatureAlgorithm{crypto.EdDSA}},
+				},
+				Constraints: &exchange.Constraints{
+					Fields: []exchange.Field{
+						{
+							Path: []string{"$.vc.credentialSubject.email"},
+						},
+					},
+				},
+			},
+		},
+	}
+	gate, err := NewCredentialGate(CredentialGateConfig{
+		AdminDID:               requesterID,
+		PresentationDefinition: presentationDefinition,
+	})
+	require.NoError(t, err)
+
+	signer := newTestSigner(t)
+	signCredential := func(subject map[string]any) []byte {
+		subject["id"] = signer.ID
+		vcJWT, err := credential.SignVerifiableCredentialJWT(signer, credential.VerifiableCredential{
+			Context:           []any{"https://www.w3.org/2018/credentials/v1"},
+			Type:              []string{"VerifiableCredential"},
+			Issuer:            signer.ID,
+			IssuanceDate:      time.Now().Format(time.RFC3339),
+			CredentialSubject: subject,
+		})
+		require.NoError(t, err)
+		return vcJWT
+	}
+	nameVCJWT := signCredential(map[string]any{"name": "Satoshi"})
+	emailVCJWT := signCredential(map[string]any{"email": "satoshi@example.com"})
+
+	t.Run("submission built in place", func(tt *testing.T) {
+		// credentials are in a different order than the input descriptors
+		presentationJWT := buildTestPresentationJWT(tt, signer, requesterID, nil, [][]byte{emailVCJWT, nameVCJWT}, nil)
+		result, err := gate.ValidatePresentationSubmission(context.Background(), presentationJWT)
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+	})
+
+	t.Run("one credential fulfills both input descriptors", func(tt *testing.T) {
+		bothVCJWT := signCredential(map[string]any{"name": "Satoshi", "email": "satoshi@example.com"})
+		presentationJWT := buildTestPresentationJWT(tt, signer, requesterID, nil, [][]byte{bothVCJWT}, nil)
+		result, err := gate.ValidatePresentationSubmission(context.Background(), presentationJWT)
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+	})
+
+	t.Run("input descriptor not fulfilled", func(tt *testing.T) {
+		presentationJWT := buildTestPresentationJWT(tt, signer, requesterID, nil, [][]byte{nameVCJWT}, nil)
+		result, err := gate.ValidatePresentationSubmission(context.Background(), presentationJWT)
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "input descriptor<email> could not be fulfilled")
+		assert.False(tt, result.Valid)
+	})
+
+	t.Run("presentation for another audience", func(tt *testing.T) {
+		presentationJWT := buildTestPresentationJWT(tt, signer, "did:test:other", nil, [][]byte{emailVCJWT, nameVCJWT}, nil)
+		result, err := gate.ValidatePresentationSubmission(context.Background(), presentationJWT)
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "audience mismatch")
+		assert.False(tt, result.Valid)
+	})
+}
+
+func TestSubmissionPaths(t *testing.T) {
+	requesterID := "did:test:admin"
+	def := exchange.PresentationDefinition{
+		ID: "name-definition",
+		InputDescriptors: []exchange.InputDescriptor{{
+			ID:          "name",
+			Constraints: &exchange.Constraints{Fields: []exchange.Field{{Path: []string{"$.credentialSubject.name", "$.vc.credentialSubject.name"}}}},
+		}},
+	}
+	issuer := newTestSigner(t)
+	holder := newTestSigner(t)
+	gate, err := NewCredentialGate(CredentialGateConfig{
+		AdminDID:               requesterID,
+		PresentationDefinition: def,
+		TrustedIssuers:         TrustedIssuers{"name": {{DID: issuer.ID}}},
+		HolderBinding:          HolderBindingSubject,
+	})
+	require.NoError(t, err)
+
+	// an unsigned credential claiming to be from the trusted issuer
+	forged := map[string]any{
+		"@context":          []any{"https://www.w3.org/2018/credentials/v1"},
+		"type":              []any{"VerifiableCredential"},
+		"issuer":            issuer.ID,
+		"issuanceDate":      time.Now().Format(time.RFC3339),
+		"credentialSubject": map[string]any{"id": holder.ID, "name": "Satoshi"},
+	}
+	vcJWT, err := credential.SignVerifiableCredentialJWT(issuer, credential.VerifiableCredential{
+		Context:           []any{"https://www.w3.org/2018/credentials/v1"},
+		Type:              []string{"VerifiableCredential"},
+		Issuer:            issuer.ID,
+		IssuanceDate:      time.Now().Format(time.RFC3339),
+		CredentialSubject: map[string]any{"id": holder.ID, "name": "Satoshi"},
+	})
+	require.NoError(t, err)
+
+	// submit builds a VP JWT whose presentation submission points the input descriptor at the given path
+	submit := func(tt *testing.T, path string, vp map[string]any) (*Result, error) {
+		vp["presentation_submission"] = map[string]any{
+			"id":             uuid.NewString(),
+			"definition_id":  def.ID,
+			"descriptor_map": []any{map[string]any{"id": "name", "format": exchange.JWTVC.String(), "path": path}},
+		}
+		return gate.ValidatePresentationSubmission(context.Background(), signTestPresentationJWT(tt, holder, requesterID, vp))
+	}
+
+	t.Run("credential of the VP", func(tt *testing.T) {
+		result, err := submit(tt, "$.verifiableCredential[0]", map[string]any{"verifiableCredential": []any{string(vcJWT)}})
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+	})
+
+	t.Run("path outside the credentials of the VP", func(tt *testing.T) {
+		result, err := submit(tt, "$.proof", map[string]any{"proof": forged})
+		assert.Error(tt, err)
+		assert.False(tt, result.Valid)
+		assert.Equal(tt, ReasonInvalidSubmission, result.Reason.Code)
+		assert.Equal(tt, "name", result.Reason.InputDescriptorID)
+		assert.Contains(tt, result.Reason.Message, "does not point to a credential of the VP")
+
+		result, err = submit(tt, "$.verifiableCredential[*]", map[string]any{"verifiableCredential": []any{string(vcJWT)}})
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonInvalidSubmission, result.Reason.Code)
+	})
+
+	t.Run("index out of range", func(tt *testing.T) {
+		result, err := submit(tt, "$.verifiableCredential[1]", map[string]any{"verifiableCredential": []any{string(vcJWT)}})
+		assert.Error(tt, err)
+		assert.False(tt, result.Valid)
+		assert.Equal(tt, ReasonInvalidSubmission, result.Reason.Code)
+		assert.Contains(tt, result.Reason.Message, "points past the 1 credentials of the VP")
+	})
+}
@@ -0,0 +1,158 @@
+package gate
+
+import (
+	"context"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/pkg/errors"
+)
+
+// validityClock checks the validity periods of presentations and credentials against the current time, allowing
+// for clock skew between the gate and their signers
+type validityClock struct {
+	now  func() time.Time
+	skew time.Duration
+}
+
+// systemClock checks validity periods against the system clock, allowing no skew
+func systemClock() validityClock {
+	return validityClock{now: time.Now}
+}
+
+// validityClock returns the clock the gate checks validity periods with
+func (cg *CredentialGate) validityClock() validityClock {
+	clock := validityClock{now: cg.config.Clock, skew: cg.config.ClockSkew}
+	if clock.now == nil {
+		clock.now = time.Now
+	}
+	return clock
+}
+
+// systemExpiry converts a time by the clock to the time by the system clock, by which stores expire what they hold
+func (c validityClock) systemExpiry(t time.Time) time.Time {
+	return t.Add(time.Since(c.now()))
+}
+
+type clockKey struct{}
+
+// withClock makes the gate's clock available to the custom handlers run with the context
+func withClock(ctx context.Context, clock validityClock) context.Context {
+	return context.WithValue(ctx, clockKey{}, clock)
+}
+
+// nowFromContext returns the current time by the clock of the gate running a custom handler, or by the system clock
+func nowFromContext(ctx context.Context) time.Time {
+	if clock, ok := ctx.Value(clockKey{}).(validityClock); ok {
+		return clock.now()
+	}
+	return time.Now()
+}
+
+// checkJWT makes sure a JWT is not expired, is valid from its nbf, and was not issued in the future
+func (c validityClock) checkJWT(token jwt.Token, name string) error {
+	now := c.now()
+	if exp := token.Expiration(); !exp.IsZero() && !now.Before(exp.Add(c.skew)) {
+		return newDenial(ReasonExpired, errors.Errorf("%s expired at %s", name, exp.Format(time.RFC3339)))
+	}
+	if nbf := token.NotBefore(); !nbf.IsZero() && now.Before(nbf.Add(-c.skew)) {
+		return newDenial(ReasonNotYetValid, errors.Errorf("%s is not valid before %s", name, nbf.Format(time.RFC3339)))
+	}
+	if iat := token.IssuedAt(); !iat.IsZero() && now.Before(iat.Add(-c.skew)) {
+		return newDenial(ReasonNotYetValid, errors.Errorf("%s was issued in the future at %s", name, iat.Format(time.RFC3339)))
+	}
+	return nil
+}
+
+// checkCredentialDates makes sure a credential in the VC data model is within the validity period stated by its
+// issuanceDate and expirationDate https://www.w3.org/TR/vc-data-model/#validity-period, or its validFrom and
+// validUntil https://www.w3.org/TR/vc-data-model-2.0/#validity-period
+func (c validityClock) checkCredentialDates(vc map[string]any, name string) error {
+	now := c.now()
+	for _, property := range []string{"issuanceDate", "validFrom"} {
+		from, err := getDateProperty(vc, property)
+		if err != nil {
+			return newDenial(ReasonInvalidSubmission, errors.Wrap(err, name))
+		}
+		if !from.IsZero() && now.Before(from.Add(-c.skew)) {
+			return newDenial(ReasonNotYetValid, errors.Errorf("%s is not valid before its %s %s", name, property, from.Format(time.RFC3339)))
+		}
+	}
+	for _, property := range []string{"expirationDate", "validUntil"} {
+		until, err := getDateProperty(vc, property)
+		if err != nil {
+			return newDenial(ReasonInvalidSubmission, errors.Wrap(err, name))
+		}
+		if !until.IsZero() && !now.Before(until.Add(c.skew)) {
+			return newDenial(ReasonExpired, errors.Errorf("%s expired at its %s %s", name, property, until.Format(time.RFC3339)))
+		}
+	}
+	return nil
+}
+
+// checkExpiry makes sure something which expires at the given time, if it expires, has not yet expired
+func (c validityClock) checkExpiry(expiry time.Time, name string) error {
+	if !expiry.IsZero() && !c.now().Before(expiry.Add(c.skew)) {
+		return newDenial(ReasonExpired, errors.Errorf("%s expired at %s", name, expiry.Format(time.RFC3339)))
+	}
+	return nil
+}
+
+// checkProof makes sure a Data Integrity proof was not created in the future and, if it expires, has not yet
+// expired, returning when it was created, or the zero time if it does not say
+func (c validityClock) checkProof(proof dataIntegrityProof, name string) (time.Time, error) {
+	created, err := parseProofTime(proof.Created)
+	if err != nil {
+		return time.Time{}, newDenial(ReasonInvalidSubmission, errors.Wrapf(err, "parsing created time of %s", name))
+	}
+	if !created.IsZero() && c.now().Before(created.Add(-c.skew)) {
+		return time.Time{}, newDenial(ReasonNotYetValid, errors.Errorf("%s was created in the future at %s", name, created.Format(time.RFC3339)))
+	}
+	expires, err := parseProofTime(proof.Expires)
+	if err != nil {
+		return time.Time{}, newDenial(ReasonInvalidSubmission, errors.Wrapf(err, "parsing expiry of %s", name))
+	}
+	if err = c.checkExpiry(expires, name); err != nil {
+		return time.Time{}, err
+	}
+	return created, nil
+}
+
+// parseProofTime parses a time of a Data Integrity proof, or returns the zero time if it is not set
+func parseProofTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// checkAge makes sure something issued at the given time is no older than the maximum age, if there is one
+func (c validityClock) checkAge(issuedAt time.Time, maxAge time.Duration, name string) error {
+	if maxAge == 0 {
+		return nil
+	}
+	if issuedAt.IsZero() {
+		return newDenial(ReasonInvalidSubmission, errors.Errorf("%s has no issuance time to check its age against", name))
+	}
+	if age := c.now().Sub(issuedAt); age > maxAge+c.skew {
+		return newDenial(ReasonExpired, errors.Errorf("%s issued at %s is older than %s", name, issuedAt.Format(time.RFC3339), maxAge))
+	}
+	return nil
+}
+
+// getDateProperty returns the time of a date property of a credential, or the zero time if it is not set
+func getDateProperty(vc map[string]any, property string) (time.Time, error) {
+	value, ok := vc[property]
+	if !ok || value == nil || value == "" {
+		return time.Time{}, nil
+	}
+	s, ok := value.(string)
+	if !ok {
+		return time.Time{}, errors.Errorf("%s is not a string", property)
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "parsing %s", property)
+	}
+	return t, nil
+}
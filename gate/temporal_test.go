@@ -0,0 +1,205 @@
+package gate
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/TBD54566975/ssi-sdk/credential"
+	"github.com/TBD54566975/ssi-sdk/credential/exchange"
+	"github.com/google/uuid"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemporalValidity(t *testing.T) {
+	admin := "did:test:admin"
+	def := exchange.PresentationDefinition{
+		ID: "name-definition",
+		InputDescriptors: []exchange.InputDescriptor{{
+			ID:          "name",
+			Constraints: &exchange.Constraints{Fields: []exchange.Field{{Path: []string{"$.vc.credentialSubject.name"}}}},
+		}},
+	}
+	submitter := newTestSigner(t)
+	// the gate's clock is an hour behind the system clock
+	now := time.Now().Add(-time.Hour).Truncate(time.Second)
+	newGate := func(tt *testing.T, skew, maxAge time.Duration) *CredentialGate {
+		gate, err := NewCredentialGate(CredentialGateConfig{
+			AdminDID:               admin,
+			PresentationDefinition: def,
+			Clock:                  func() time.Time { return now },
+			ClockSkew:              skew,
+			MaxPresentationAge:     maxAge,
+		})
+		require.NoError(tt, err)
+		return gate
+	}
+	// vcJWT signs a credential JWT with the given claims, and the given properties set on its vc claim
+	vcJWT := func(tt *testing.T, claims, vcProperties map[string]any) []byte {
+		vc := map[string]any{
+			"@context":          []any{"https://www.w3.org/2018/credentials/v1"},
+			"type":              []any{"VerifiableCredential"},
+			"issuer":            submitter.ID,
+			"credentialSubject": map[string]any{"id": submitter.ID, "name": "Satoshi"},
+		}
+		for k, v := range vcProperties {
+			vc[k] = v
+		}
+		token := jwt.New()
+		require.NoError(tt, token.Set(jwt.JwtIDKey, "urn:uuid:"+uuid.NewString()))
+		require.NoError(tt, token.Set(jwt.IssuerKey, submitter.ID))
+		require.NoError(tt, token.Set(jwt.SubjectKey, submitter.ID))
+		require.NoError(tt, token.Set(credential.VCJWTProperty, vc))
+		for k, v := range claims {
+			require.NoError(tt, token.Set(k, v))
+		}
+		headers := jws.NewHeaders()
+		require.NoError(tt, headers.Set(jws.KeyIDKey, submitter.KID))
+		signed, err := jwt.Sign(token, jwt.WithKey(jwa.SignatureAlgorithm(submitter.ALG), submitter.PrivateKey, jws.WithProtectedHeaders(headers)))
+		require.NoError(tt, err)
+		return signed
+	}
+	validate := func(tt *testing.T, gate *CredentialGate, vpClaims, vcClaims, vcProperties map[string]any) (*Result, error) {
+		claims := map[string]any{jwt.IssuedAtKey: now.Unix()}
+		for k, v := range vpClaims {
+			claims[k] = v
+		}
+		submission := buildTestSubmissionJWT(tt, submitter, admin, def, [][]byte{vcJWT(tt, vcClaims, vcProperties)}, claims)
+		return gate.ValidatePresentationSubmission(context.Background(), submission)
+	}
+	assertDenied := func(tt *testing.T, result *Result, err error, code ReasonCode, message string) {
+		assert.Error(tt, err)
+		require.NotNil(tt, result.Reason)
+		assert.Equal(tt, code, result.Reason.Code, message)
+		assert.Contains(tt, result.Reason.Message, message)
+	}
+
+	t.Run("valid by the gate's clock", func(tt *testing.T) {
+		// expired by the system clock, but not by the gate's
+		result, err := validate(tt, newGate(tt, 0, 0),
+			map[string]any{jwt.ExpirationKey: now.Add(time.Minute).Unix()},
+			map[string]any{jwt.ExpirationKey: now.Add(time.Minute).Unix()},
+			map[string]any{"validUntil": now.Add(time.Minute).Format(time.RFC3339)})
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+	})
+
+	t.Run("presentation", func(tt *testing.T) {
+		gate := newGate(tt, 0, 0)
+		result, err := validate(tt, gate, map[string]any{jwt.ExpirationKey: now.Unix()}, nil, nil)
+		assertDenied(tt, result, err, ReasonExpired, "VP JWT expired at")
+
+		result, err = validate(tt, gate, map[string]any{jwt.NotBeforeKey: now.Add(time.Minute).Unix()}, nil, nil)
+		assertDenied(tt, result, err, ReasonNotYetValid, "VP JWT is not valid before")
+
+		result, err = validate(tt, gate, map[string]any{jwt.IssuedAtKey: now.Add(time.Minute).Unix()}, nil, nil)
+		assertDenied(tt, result, err, ReasonNotYetValid, "VP JWT was issued in the future")
+	})
+
+	t.Run("credential", func(tt *testing.T) {
+		gate := newGate(tt, 0, 0)
+		for name, test := range map[string]struct {
+			claims     map[string]any
+			properties map[string]any
+			code       ReasonCode
+			message    string
+		}{
+			"exp":            {claims: map[string]any{jwt.ExpirationKey: now.Add(-time.Second).Unix()}, code: ReasonExpired, message: "expired at"},
+			"nbf":            {claims: map[string]any{jwt.NotBeforeKey: now.Add(time.Minute).Unix()}, code: ReasonNotYetValid, message: "is not valid before"},
+			"iat":            {claims: map[string]any{jwt.IssuedAtKey: now.Add(time.Minute).Unix()}, code: ReasonNotYetValid, message: "was issued in the future"},
+			"expirationDate": {properties: map[string]any{"expirationDate": now.Format(time.RFC3339)}, code: ReasonExpired, message: "expired at its expirationDate"},
+			"validUntil":     {properties: map[string]any{"validUntil": now.Add(-time.Minute).Format(time.RFC3339)}, code: ReasonExpired, message: "expired at its validUntil"},
+			"validFrom":      {properties: map[string]any{"validFrom": now.Add(time.Minute).Format(time.RFC3339)}, code: ReasonNotYetValid, message: "is not valid before its validFrom"},
+			"issuanceDate":   {properties: map[string]any{"issuanceDate": now.Add(time.Minute).Format(time.RFC3339)}, code: ReasonNotYetValid, message: "is not valid before its issuanceDate"},
+		} {
+			result, err := validate(tt, gate, nil, test.claims, test.properties)
+			assertDenied(tt, result, err, test.code, test.message)
+			// the denial names the credential and the input descriptor it was submitted for
+			assert.Contains(tt, result.Reason.Message, "credential<urn:uuid:", name)
+			assert.Equal(tt, "name", result.Reason.InputDescriptorID, name)
+		}
+
+		// a credential without an ID is named by its issuer
+		result, err := validate(tt, gate, nil, map[string]any{jwt.JwtIDKey: ""}, map[string]any{"validUntil": now.Format(time.RFC3339)})
+		assertDenied(tt, result, err, ReasonExpired, "credential issued by "+submitter.ID+" expired at its validUntil")
+
+		result, err = validate(tt, gate, nil, nil, map[string]any{"validUntil": "tomorrow"})
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonInvalidSubmission, result.Reason.Code)
+	})
+
+	t.Run("clock skew", func(tt *testing.T) {
+		gate := newGate(tt, time.Minute, 0)
+		result, err := validate(tt, gate,
+			map[string]any{jwt.IssuedAtKey: now.Add(30 * time.Second).Unix()},
+			map[string]any{jwt.ExpirationKey: now.Add(-30 * time.Second).Unix()},
+			map[string]any{"validFrom": now.Add(30 * time.Second).Format(time.RFC3339)})
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+
+		result, err = validate(tt, gate, nil, map[string]any{jwt.ExpirationKey: now.Add(-2 * time.Minute).Unix()}, nil)
+		assertDenied(tt, result, err, ReasonExpired, "expired at")
+	})
+
+	t.Run("max presentation age", func(tt *testing.T) {
+		gate := newGate(tt, 0, 5*time.Minute)
+		result, err := validate(tt, gate, map[string]any{jwt.IssuedAtKey: now.Add(-4 * time.Minute).Unix()}, nil, nil)
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+
+		result, err = validate(tt, gate, map[string]any{jwt.IssuedAtKey: now.Add(-6 * time.Minute).Unix()}, nil, nil)
+		assertDenied(tt, result, err, ReasonExpired, "is older than 5m0s")
+	})
+
+	t.Run("challenges and expressions by the gate's clock", func(tt *testing.T) {
+		gate, err := NewCredentialGate(CredentialGateConfig{
+			AdminDID:               admin,
+			PresentationDefinition: def,
+			Clock:                  func() time.Time { return now },
+			RequireChallenge:       true,
+			HandlerRegistry:        NewHandlerRegistry(),
+			Handlers: map[string]HandlerReference{
+				"name": {Handler: ExpressionHandlerName, Params: map[string]any{"expression": "now < timestamp('" + now.Add(time.Minute).Format(time.RFC3339) + "')"}},
+			},
+		})
+		require.NoError(tt, err)
+
+		challenge, err := gate.NewChallenge(context.Background())
+		require.NoError(tt, err)
+		assert.Equal(tt, now.Add(defaultChallengeTTL), challenge.ExpiresAt)
+
+		result, err := validate(tt, gate, map[string]any{"nonce": challenge.Nonce}, nil, nil)
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+	})
+
+	t.Run("invalid config", func(tt *testing.T) {
+		_, err := NewCredentialGate(CredentialGateConfig{AdminDID: admin, PresentationDefinition: def, ClockSkew: -time.Second})
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "clock skew")
+		_, err = NewCredentialGate(CredentialGateConfig{AdminDID: admin, PresentationDefinition: def, MaxPresentationAge: -time.Second})
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "max presentation age")
+	})
+}
+
+func TestValidityClock(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := validityClock{now: func() time.Time { return now }}
+
+	assert.NoError(t, clock.checkCredentialDates(map[string]any{}, "credential"))
+	assert.NoError(t, clock.checkCredentialDates(map[string]any{"issuanceDate": "2023-12-31T00:00:00Z", "validUntil": "2024-01-02T00:00:00Z"}, "credential"))
+	assert.Error(t, clock.checkCredentialDates(map[string]any{"expirationDate": 1}, "credential"))
+
+	assert.NoError(t, clock.checkExpiry(time.Time{}, "proof"))
+	assert.Error(t, clock.checkExpiry(now, "proof"))
+
+	assert.NoError(t, clock.checkAge(time.Time{}, 0, "VP"))
+	err := clock.checkAge(time.Time{}, time.Minute, "VP")
+	assert.Error(t, err)
+	assert.Equal(t, ReasonInvalidSubmission, getReason(err).Code)
+}
@@ -0,0 +1,169 @@
+package gate
+
+import (
+	"context"
+	"time"
+
+	"github.com/TBD54566975/ssi-sdk/credential"
+	"github.com/TBD54566975/ssi-sdk/credential/exchange"
+
+	"github.com/TBD54566975/credential-gate/resolver"
+)
+
+// ValidateOption configures a single call to ValidatePresentationSubmission or ValidatePresentation
+type ValidateOption func(*validateOptions)
+
+type validateOptions struct {
+	trace      bool
+	definition string
+}
+
+// WithTrace attaches a trace of the evaluation of the presentation submission to the result
+func WithTrace() ValidateOption {
+	return func(o *validateOptions) {
+		o.trace = true
+	}
+}
+
+// Trace is a record of how the gate evaluated a presentation submission, in the order evaluation happened
+type Trace struct {
+	// Steps holds the outcome of each stage of validation which was run
+	Steps []StepTrace `json:"steps"`
+
+	// Resolutions holds each DID resolved to verify a signature
+	Resolutions []ResolutionTrace `json:"resolutions,omitempty"`
+
+	// InputDescriptors holds the outcome of each input descriptor's constraints against the credentials
+	// submitted for it
+	InputDescriptors []InputDescriptorTrace `json:"inputDescriptors,omitempty"`
+
+	// CustomHandlers holds the outcome of each custom handler which was run
+	CustomHandlers []CustomHandlerTrace `json:"customHandlers,omitempty"`
+}
+
+// StepTrace is the outcome of a single stage of validation
+type StepTrace struct {
+	Name     string        `json:"name"`
+	Passed   bool          `json:"passed"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// ResolutionTrace is the outcome of resolving a DID
+type ResolutionTrace struct {
+	DID      string          `json:"did"`
+	Source   resolver.Source `json:"source,omitempty"`
+	Error    string          `json:"error,omitempty"`
+	Duration time.Duration   `json:"duration"`
+}
+
+// InputDescriptorTrace is the outcome of evaluating an input descriptor's constraints against a credential
+// submitted for it. An input descriptor no credential was submitted for has a single trace with no path.
+type InputDescriptorTrace struct {
+	InputDescriptorID string `json:"inputDescriptorId"`
+	Path              string `json:"path,omitempty"`
+	Fulfilled         bool   `json:"fulfilled"`
+
+	// FieldPath is the path of the field the credential failed to fulfill, if known
+	FieldPath []string `json:"fieldPath,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// CustomHandlerTrace is the outcome of running a custom handler
+type CustomHandlerTrace struct {
+	InputDescriptorID string        `json:"inputDescriptorId"`
+	Passed            bool          `json:"passed"`
+	Error             string        `json:"error,omitempty"`
+	Duration          time.Duration `json:"duration"`
+}
+
+type traceKey struct{}
+
+// withTrace returns a context carrying the trace, so that stages of validation can add to it
+func withTrace(ctx context.Context, t *Trace) context.Context {
+	if t == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, traceKey{}, t)
+}
+
+// traceFromContext returns the trace carried by the context, or nil if validation is not being traced.
+// All methods adding to a trace are safe to call on a nil trace.
+func traceFromContext(ctx context.Context) *Trace {
+	t, _ := ctx.Value(traceKey{}).(*Trace)
+	return t
+}
+
+func (t *Trace) addStep(name string, start time.Time, err error) {
+	if t == nil {
+		return
+	}
+	t.Steps = append(t.Steps, StepTrace{Name: name, Passed: err == nil, Error: errorString(err), Duration: time.Since(start)})
+}
+
+func (t *Trace) addResolution(did string, source resolver.Source, start time.Time, err error) {
+	if t == nil {
+		return
+	}
+	t.Resolutions = append(t.Resolutions, ResolutionTrace{DID: did, Source: source, Error: errorString(err), Duration: time.Since(start)})
+}
+
+func (t *Trace) addCustomHandler(inputDescriptorID string, passed bool, duration time.Duration, err error) {
+	if t == nil {
+		return
+	}
+	t.CustomHandlers = append(t.CustomHandlers, CustomHandlerTrace{
+		InputDescriptorID: inputDescriptorID,
+		Passed:            passed,
+		Error:             errorString(err),
+		Duration:          duration,
+	})
+}
+
+// addInputDescriptors evaluates every input descriptor against each credential submitted for it on its own, so
+// that the trace holds an outcome for every input descriptor, not only the first to fail. If the VP omits a
+// presentation submission, each input descriptor is evaluated against the first credential that fulfills it.
+func (t *Trace) addInputDescriptors(def exchange.PresentationDefinition, vp credential.VerifiablePresentation) {
+	if t == nil {
+		return
+	}
+	var descriptors []exchange.SubmissionDescriptor
+	if vp.PresentationSubmission == nil {
+		for _, inputDescriptor := range def.InputDescriptors {
+			if descriptor, ok := matchInputDescriptor(def.ID, inputDescriptor, vp); ok {
+				descriptors = append(descriptors, *descriptor)
+			}
+		}
+	} else if submission, err := toPresentationSubmission(vp.PresentationSubmission); err == nil {
+		descriptors = submission.DescriptorMap
+	}
+	for _, inputDescriptor := range def.InputDescriptors {
+		submitted := false
+		for _, d := range descriptors {
+			if d.ID != inputDescriptor.ID {
+				continue
+			}
+			submitted = true
+			idTrace := InputDescriptorTrace{InputDescriptorID: inputDescriptor.ID, Path: d.Path, Fulfilled: true}
+			if _, err := verifySubmissionDescriptor(def.ID, inputDescriptor, d, vp); err != nil {
+				idTrace.Fulfilled = false
+				idTrace.FieldPath = findFailedField(def.ID, inputDescriptor, d, vp)
+				idTrace.Error = err.Error()
+			}
+			t.InputDescriptors = append(t.InputDescriptors, idTrace)
+		}
+		if !submitted {
+			t.InputDescriptors = append(t.InputDescriptors, InputDescriptorTrace{
+				InputDescriptorID: inputDescriptor.ID,
+				Error:             "no credential in the presentation was submitted for, or fulfills, the input descriptor",
+			})
+		}
+	}
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,176 @@
+package gate
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/TBD54566975/ssi-sdk/credential"
+	"github.com/TBD54566975/ssi-sdk/credential/exchange"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TBD54566975/credential-gate/resolver"
+)
+
+func TestTrace(t *testing.T) {
+	requesterID := "did:test:admin"
+	presentationDefinition := exchange.PresentationDefinition{
+		ID: uuid.New().String(),
+		InputDescriptors: []exchange.InputDescriptor{
+			{
+				ID: "name",
+				Constraints: &exchange.Constraints{
+					Fields: []exchange.Field{{Path: []string{"$.vc.credentialSubject.name"}}},
+				},
+			},
+			{
+				ID: "age",
+				Constraints: &exchange.Constraints{
+					Fields: []exchange.Field{
+						{
+							Path:   []string{"$.vc.credentialSubject.age"},
+							Filter: &exchange.Filter{Type: "number", Minimum: 21},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	signer := newTestSigner(t)
+	vcJWT := func(subject map[string]any) []byte {
+		subject["id"] = signer.ID
+		signed, err := credential.SignVerifiableCredentialJWT(signer, credential.VerifiableCredential{
+			Context:           []any{"https://www.w3.org/2018/credentials/v1"},
+			Type:              []string{"VerifiableCredential"},
+			Issuer:            signer.ID,
+			IssuanceDate:      time.Now().Format(time.RFC3339),
+			CredentialSubject: subject,
+		})
+		require.NoError(t, err)
+		return signed
+	}
+
+	// a single credential is submitted for both input descriptors
+	submissionJWT := func(t *testing.T, subject map[string]any) string {
+		submission := exchange.PresentationSubmission{
+			ID:           uuid.NewString(),
+			DefinitionID: presentationDefinition.ID,
+			DescriptorMap: []exchange.SubmissionDescriptor{
+				{ID: "name", Format: exchange.JWTVC.String(), Path: "$.verifiableCredential[0]"},
+				{ID: "age", Format: exchange.JWTVC.String(), Path: "$.verifiableCredential[0]"},
+			},
+		}
+		return buildTestPresentationJWT(t, signer, requesterID, &submission, [][]byte{vcJWT(subject)}, nil)
+	}
+
+	newGate := func(t *testing.T) *CredentialGate {
+		gate, err := NewCredentialGate(CredentialGateConfig{
+			AdminDID:               requesterID,
+			PresentationDefinition: presentationDefinition,
+			CustomHandlers: map[string]CustomHandler{
+				"name": {
+					InputDescriptorID: "name",
+					Handler: func(context.Context, exchange.VerifiedSubmissionData) (bool, error) {
+						return true, nil
+					},
+				},
+			},
+		})
+		require.NoError(t, err)
+		return gate
+	}
+
+	t.Run("no trace without option", func(tt *testing.T) {
+		submission := submissionJWT(tt, map[string]any{"name": "Satoshi", "age": 30})
+		result, err := newGate(tt).ValidatePresentationSubmission(context.Background(), submission)
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+		assert.Nil(tt, result.Trace)
+	})
+
+	t.Run("trace of valid submission", func(tt *testing.T) {
+		submission := submissionJWT(tt, map[string]any{"name": "Satoshi", "age": 30})
+		result, err := newGate(tt).ValidatePresentationSubmission(context.Background(), submission, WithTrace())
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+		require.NotNil(tt, result.Trace)
+
+		var steps []string
+		for _, step := range result.Trace.Steps {
+			assert.True(tt, step.Passed, step.Name)
+			steps = append(steps, step.Name)
+		}
+		assert.Equal(tt, []string{"parse", "checkDIDMethods", "verifyPresentation", "verifyCredentials",
+			"verifySubmission", "checkHolderBinding", "checkTrustedIssuers", "checkCredentialStatus", "mapClaims", "applyCustomHandlers", "checkChallenge", "checkReplay"}, steps)
+
+		// the submitter and the issuer of the credential are both resolved
+		require.Len(tt, result.Trace.Resolutions, 2)
+		for _, resolution := range result.Trace.Resolutions {
+			assert.Equal(tt, signer.ID, resolution.DID)
+			assert.Equal(tt, resolver.LocalSource, resolution.Source)
+			assert.Empty(tt, resolution.Error)
+		}
+
+		require.Len(tt, result.Trace.InputDescriptors, 2)
+		for _, idTrace := range result.Trace.InputDescriptors {
+			assert.True(tt, idTrace.Fulfilled, idTrace.InputDescriptorID)
+			assert.Equal(tt, "$.verifiableCredential[0]", idTrace.Path)
+		}
+
+		require.Len(tt, result.Trace.CustomHandlers, 1)
+		assert.Equal(tt, "name", result.Trace.CustomHandlers[0].InputDescriptorID)
+		assert.True(tt, result.Trace.CustomHandlers[0].Passed)
+
+		// the trace is part of the result's JSON
+		resultJSON, err := json.Marshal(result)
+		require.NoError(tt, err)
+		assert.Contains(tt, string(resultJSON), `"trace"`)
+	})
+
+	t.Run("trace of each input descriptor of a denied submission", func(tt *testing.T) {
+		submission := submissionJWT(tt, map[string]any{"name": "Satoshi", "age": 18})
+		result, err := newGate(tt).ValidatePresentationSubmission(context.Background(), submission, WithTrace())
+		assert.Error(tt, err)
+		assert.False(tt, result.Valid)
+		require.NotNil(tt, result.Trace)
+
+		lastStep := result.Trace.Steps[len(result.Trace.Steps)-1]
+		assert.Equal(tt, "verifySubmission", lastStep.Name)
+		assert.False(tt, lastStep.Passed)
+		assert.NotEmpty(tt, lastStep.Error)
+
+		require.Len(tt, result.Trace.InputDescriptors, 2)
+		assert.Equal(tt, "name", result.Trace.InputDescriptors[0].InputDescriptorID)
+		assert.True(tt, result.Trace.InputDescriptors[0].Fulfilled)
+		assert.Equal(tt, "age", result.Trace.InputDescriptors[1].InputDescriptorID)
+		assert.False(tt, result.Trace.InputDescriptors[1].Fulfilled)
+		assert.Equal(tt, []string{"$.vc.credentialSubject.age"}, result.Trace.InputDescriptors[1].FieldPath)
+		assert.Empty(tt, result.Trace.CustomHandlers)
+	})
+
+	t.Run("trace of presentation without a submission", func(tt *testing.T) {
+		presentationJWT := buildTestPresentationJWT(tt, signer, requesterID, nil,
+			[][]byte{vcJWT(map[string]any{"name": "Satoshi"})}, nil)
+		result, err := newGate(tt).ValidatePresentationSubmission(context.Background(), presentationJWT, WithTrace())
+		assert.Error(tt, err)
+		require.NotNil(tt, result.Trace)
+
+		require.Len(tt, result.Trace.InputDescriptors, 2)
+		assert.True(tt, result.Trace.InputDescriptors[0].Fulfilled)
+		assert.False(tt, result.Trace.InputDescriptors[1].Fulfilled)
+		assert.Empty(tt, result.Trace.InputDescriptors[1].Path)
+	})
+
+	t.Run("trace of unparseable submission", func(tt *testing.T) {
+		result, err := newGate(tt).ValidatePresentationSubmission(context.Background(), "not a jwt", WithTrace())
+		assert.Error(tt, err)
+		require.NotNil(tt, result.Trace)
+		require.Len(tt, result.Trace.Steps, 1)
+		assert.Equal(tt, "parse", result.Trace.Steps[0].Name)
+		assert.False(tt, result.Trace.Steps[0].Passed)
+	})
+}
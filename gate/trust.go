@@ -0,0 +1,215 @@
+package gate
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/TBD54566975/ssi-sdk/credential"
+	"github.com/TBD54566975/ssi-sdk/util"
+	"github.com/pkg/errors"
+
+	"github.com/TBD54566975/credential-gate/resolver"
+)
+
+// TrustedIssuer is an issuer trusted to issue credentials for an input descriptor
+type TrustedIssuer struct {
+	// DID is the DID of the issuer, or a pattern matching the DIDs of a number of issuers, such as did:key:* or
+	// did:web:*.example.com. Each colon separated segment of the pattern is matched against the same segment of the
+	// DID using the syntax of path.Match, so a wildcard never matches across a colon, or a percent-encoded colon, and
+	// the DID must have as many segments as the pattern; did:web:*.example.com trusts did:web:issuer.example.com but
+	// neither did:web:attacker.com:evil.example.com nor did:web:issuer.example.com:users:alice.
+	DID string `json:"did" validate:"required"`
+
+	// Types restricts the credentials the issuer is trusted for to those with at least one of the given types
+	// If empty, credentials of any type are trusted
+	Types []string `json:"types,omitempty"`
+}
+
+// IsValid checks the issuer's DID pattern is well-formed
+func (ti TrustedIssuer) IsValid() error {
+	if err := util.IsValidStruct(ti); err != nil {
+		return err
+	}
+	for _, segment := range strings.Split(ti.DID, ":") {
+		if _, err := path.Match(segment, ""); err != nil {
+			return errors.Wrapf(err, "invalid DID pattern: %s", ti.DID)
+		}
+	}
+	return nil
+}
+
+// trusts returns whether the issuer is trusted to issue a credential of the given issuer and types
+func (ti TrustedIssuer) trusts(issuer string, types []string) bool {
+	if !matchDIDPattern(ti.DID, issuer) {
+		return false
+	}
+	if len(ti.Types) == 0 {
+		return true
+	}
+	for _, t := range types {
+		if contains(ti.Types, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchDIDPattern returns whether a DID matches a pattern segment by segment, such that wildcards in a segment
+// of the pattern only match within the same segment of the DID. A segment containing a percent-encoded colon, as
+// in the port of a did:web DID, only matches a pattern segment which is not a wildcard.
+func matchDIDPattern(pattern, did string) bool {
+	patternSegments := strings.Split(pattern, ":")
+	didSegments := strings.Split(did, ":")
+	if len(patternSegments) != len(didSegments) {
+		return false
+	}
+	for i, patternSegment := range patternSegments {
+		if patternSegment == didSegments[i] {
+			continue
+		}
+		if strings.Contains(strings.ToLower(didSegments[i]), "%3a") {
+			return false
+		}
+		if matched, err := path.Match(patternSegment, didSegments[i]); err != nil || !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// TrustRegistry looks up the issuers trusted to issue credentials for an input descriptor
+type TrustRegistry interface {
+	// TrustedIssuers returns the issuers trusted for an input descriptor. If none are returned, credentials from
+	// any issuer are accepted for the input descriptor.
+	TrustedIssuers(ctx context.Context, inputDescriptorID string) ([]TrustedIssuer, error)
+}
+
+// TrustedIssuers is a static TrustRegistry mapping input descriptor IDs to the issuers trusted for them
+type TrustedIssuers map[string][]TrustedIssuer
+
+var _ TrustRegistry = (TrustedIssuers)(nil)
+
+func (t TrustedIssuers) TrustedIssuers(_ context.Context, inputDescriptorID string) ([]TrustedIssuer, error) {
+	return t[inputDescriptorID], nil
+}
+
+// IsValid checks each trusted issuer is valid
+func (t TrustedIssuers) IsValid() error {
+	for id, issuers := range t {
+		for _, issuer := range issuers {
+			if err := issuer.IsValid(); err != nil {
+				return errors.Wrapf(err, "trusted issuer for input descriptor<%s>", id)
+			}
+		}
+	}
+	return nil
+}
+
+// LoadTrustedIssuers loads trusted issuers from a JSON file mapping input descriptor IDs to trusted issuers
+func LoadTrustedIssuers(filePath string) (TrustedIssuers, error) {
+	trustedIssuersBytes, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading trusted issuers file %s", filePath)
+	}
+	var trustedIssuers TrustedIssuers
+	if err = json.Unmarshal(trustedIssuersBytes, &trustedIssuers); err != nil {
+		return nil, errors.Wrapf(err, "unmarshalling trusted issuers file %s", filePath)
+	}
+	if err = trustedIssuers.IsValid(); err != nil {
+		return nil, errors.Wrapf(err, "invalid trusted issuers file %s", filePath)
+	}
+	return trustedIssuers, nil
+}
+
+// LoadTrustList loads trusted issuers from a trust list: a credential issued by a publisher the gate trusts,
+// whose subject has a trustedIssuers property mapping input descriptor IDs to trusted issuers. The trust list's
+// signature is verified with the given resolver, and it must be issued by the given publisher. Only standard
+// contexts are loaded for a JSON-LD trust list, so any other terms it uses must be defined inline.
+func LoadTrustList(ctx context.Context, r *resolver.Resolver, trustList any, publisher string) (TrustedIssuers, error) {
+	loader, err := newDocumentLoader(nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating JSON-LD document loader")
+	}
+	if err = verifyCredential(ctx, r, loader, systemClock(), trustList); err != nil {
+		return nil, errors.Wrap(err, "verifying trust list")
+	}
+	_, _, trustListCredential, err := credential.ToCredential(trustList)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing trust list")
+	}
+	issuer, err := getCredentialIssuer(*trustListCredential)
+	if err != nil {
+		return nil, errors.Wrap(err, "trust list")
+	}
+	if issuer != publisher {
+		return nil, errors.Errorf("trust list issued by %s, not the trusted publisher %s", issuer, publisher)
+	}
+
+	subjectBytes, err := json.Marshal(trustListCredential.CredentialSubject)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshalling trust list subject")
+	}
+	var subject struct {
+		TrustedIssuers TrustedIssuers `json:"trustedIssuers"`
+	}
+	if err = json.Unmarshal(subjectBytes, &subject); err != nil {
+		return nil, errors.Wrap(err, "unmarshalling trust list subject")
+	}
+	if err = subject.TrustedIssuers.IsValid(); err != nil {
+		return nil, errors.Wrap(err, "invalid trust list")
+	}
+	return subject.TrustedIssuers, nil
+}
+
+// checkTrustedIssuers makes sure each credential submitted for an input descriptor with trusted issuers was
+// issued by one of them
+func (cg *CredentialGate) checkTrustedIssuers(ctx context.Context, submitted []submittedCredential) error {
+	for _, sc := range submitted {
+		trustedIssuers, err := cg.trustRegistry.TrustedIssuers(ctx, sc.inputDescriptorID)
+		if err != nil {
+			return errors.Wrapf(err, "looking up trusted issuers for input descriptor<%s>", sc.inputDescriptorID)
+		}
+		if len(trustedIssuers) == 0 {
+			continue
+		}
+		issuer, err := getCredentialIssuer(sc.credential)
+		if err != nil {
+			return newInputDescriptorDenial(ReasonInvalidSubmission, sc.inputDescriptorID, nil, err)
+		}
+		types := getCredentialTypes(sc.credential)
+		trusted := false
+		for _, ti := range trustedIssuers {
+			if ti.trusts(issuer, types) {
+				trusted = true
+				break
+			}
+		}
+		if !trusted {
+			return newInputDescriptorDenial(ReasonIssuerUntrusted, sc.inputDescriptorID, nil,
+				errors.Errorf("issuer %s is not trusted for input descriptor<%s>", issuer, sc.inputDescriptorID))
+		}
+	}
+	return nil
+}
+
+// getCredentialTypes returns the types of a credential, which are either a string or a list of strings
+func getCredentialTypes(cred credential.VerifiableCredential) []string {
+	switch types := cred.Type.(type) {
+	case string:
+		return []string{types}
+	case []string:
+		return types
+	case []any:
+		var typeStrings []string
+		for _, t := range types {
+			if s, ok := t.(string); ok {
+				typeStrings = append(typeStrings, s)
+			}
+		}
+		return typeStrings
+	}
+	return nil
+}
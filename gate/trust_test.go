@@ -0,0 +1,229 @@
+package gate
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/TBD54566975/ssi-sdk/credential"
+	"github.com/TBD54566975/ssi-sdk/credential/exchange"
+	didsdk "github.com/TBD54566975/ssi-sdk/did"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TBD54566975/credential-gate/resolver"
+)
+
+type erroringTrustRegistry struct{}
+
+func (erroringTrustRegistry) TrustedIssuers(context.Context, string) ([]TrustedIssuer, error) {
+	return nil, errors.New("registry unavailable")
+}
+
+func TestTrustedIssuers(t *testing.T) {
+	requesterID := "did:test:admin"
+	inputDescriptorID := "name"
+	presentationDefinition := exchange.PresentationDefinition{
+		ID: uuid.New().String(),
+		InputDescriptors: []exchange.InputDescriptor{
+			{
+				ID: inputDescriptorID,
+				Constraints: &exchange.Constraints{
+					Fields: []exchange.Field{{Path: []string{"$.vc.credentialSubject.name"}}},
+				},
+			},
+		},
+	}
+
+	issuer := newTestSigner(t)
+	holder := newTestSigner(t)
+	vcJWT, err := credential.SignVerifiableCredentialJWT(issuer, credential.VerifiableCredential{
+		Context:           []any{"https://www.w3.org/2018/credentials/v1"},
+		Type:              []string{"VerifiableCredential", "NameCredential"},
+		Issuer:            issuer.ID,
+		IssuanceDate:      time.Now().Format(time.RFC3339),
+		CredentialSubject: map[string]any{"id": holder.ID, "name": "Satoshi"},
+	})
+	require.NoError(t, err)
+
+	validate := func(t *testing.T, config CredentialGateConfig, submissionJWT string) (*Result, error) {
+		config.AdminDID = requesterID
+		config.PresentationDefinition = presentationDefinition
+		gate, err := NewCredentialGate(config)
+		require.NoError(t, err)
+		return gate.ValidatePresentationSubmission(context.Background(), submissionJWT)
+	}
+	submissionJWT := buildTestSubmissionJWT(t, holder, requesterID, presentationDefinition, [][]byte{vcJWT}, nil)
+
+	t.Run("any issuer trusted without trusted issuers", func(tt *testing.T) {
+		result, err := validate(tt, CredentialGateConfig{}, submissionJWT)
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+	})
+
+	t.Run("trusted issuer", func(tt *testing.T) {
+		result, err := validate(tt, CredentialGateConfig{
+			TrustedIssuers: TrustedIssuers{inputDescriptorID: {{DID: "did:key:other"}, {DID: issuer.ID}}},
+		}, submissionJWT)
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+	})
+
+	t.Run("trusted issuer pattern", func(tt *testing.T) {
+		result, err := validate(tt, CredentialGateConfig{
+			TrustedIssuers: TrustedIssuers{inputDescriptorID: {{DID: "did:key:*", Types: []string{"NameCredential"}}}},
+		}, submissionJWT)
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+	})
+
+	t.Run("trusted issuer pattern matches within segments", func(tt *testing.T) {
+		trusted := TrustedIssuer{DID: "did:web:*.example.com"}
+		assert.True(tt, trusted.trusts("did:web:issuer.example.com", nil))
+		assert.False(tt, trusted.trusts("did:web:attacker.com:evil.example.com", nil))
+		assert.False(tt, trusted.trusts("did:web:attacker.com%3A8443:x.example.com", nil))
+		assert.False(tt, trusted.trusts("did:web:attacker.com%3a8443.example.com", nil))
+		assert.False(tt, trusted.trusts("did:web:issuer.example.com:users:alice", nil))
+		assert.False(tt, trusted.trusts("did:web:example.com", nil))
+
+		// a percent-encoded port is trusted only when it is named exactly
+		assert.True(tt, TrustedIssuer{DID: "did:web:issuer.example.com%3A8443"}.trusts("did:web:issuer.example.com%3A8443", nil))
+		assert.False(tt, TrustedIssuer{DID: "did:web:*"}.trusts("did:web:issuer.example.com%3A8443", nil))
+
+		assert.True(tt, TrustedIssuer{DID: "did:key:*"}.trusts("did:key:z6MkhaXgBZDvotDkL5257faiztiGiC2QtKLGpbnnEGta2doK", nil))
+		assert.Error(tt, TrustedIssuer{DID: "did:web:[.example.com"}.IsValid())
+	})
+
+	t.Run("untrusted issuer", func(tt *testing.T) {
+		result, err := validate(tt, CredentialGateConfig{
+			TrustedIssuers: TrustedIssuers{inputDescriptorID: {{DID: "did:web:*"}}},
+		}, submissionJWT)
+		assert.Error(tt, err)
+		assert.False(tt, result.Valid)
+		assert.Equal(tt, ReasonIssuerUntrusted, result.Reason.Code)
+		assert.Equal(tt, inputDescriptorID, result.Reason.InputDescriptorID)
+	})
+
+	t.Run("issuer untrusted for credential type", func(tt *testing.T) {
+		result, err := validate(tt, CredentialGateConfig{
+			TrustedIssuers: TrustedIssuers{inputDescriptorID: {{DID: issuer.ID, Types: []string{"DriversLicense"}}}},
+		}, submissionJWT)
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonIssuerUntrusted, result.Reason.Code)
+	})
+
+	t.Run("trusted issuers of presentation without a submission", func(tt *testing.T) {
+		presentationJWT := buildTestPresentationJWT(tt, holder, requesterID, nil, [][]byte{vcJWT}, nil)
+		result, err := validate(tt, CredentialGateConfig{
+			TrustedIssuers: TrustedIssuers{inputDescriptorID: {{DID: "did:web:*"}}},
+		}, presentationJWT)
+		assert.Error(tt, err)
+		assert.Equal(tt, ReasonIssuerUntrusted, result.Reason.Code)
+	})
+
+	t.Run("trust registry used instead of trusted issuers", func(tt *testing.T) {
+		result, err := validate(tt, CredentialGateConfig{
+			TrustedIssuers: TrustedIssuers{inputDescriptorID: {{DID: issuer.ID}}},
+			TrustRegistry:  erroringTrustRegistry{},
+		}, submissionJWT)
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "registry unavailable")
+		assert.Equal(tt, ReasonInternalError, result.Reason.Code)
+	})
+
+	t.Run("invalid trusted issuers", func(tt *testing.T) {
+		_, err := NewCredentialGate(CredentialGateConfig{
+			AdminDID:               requesterID,
+			PresentationDefinition: presentationDefinition,
+			TrustedIssuers:         TrustedIssuers{"unknown": {{DID: issuer.ID}}},
+		})
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "not found in presentation definition")
+
+		_, err = NewCredentialGate(CredentialGateConfig{
+			AdminDID:               requesterID,
+			PresentationDefinition: presentationDefinition,
+			TrustedIssuers:         TrustedIssuers{inputDescriptorID: {{DID: "did:key:["}}},
+		})
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "invalid DID pattern")
+	})
+}
+
+func TestLoadTrustedIssuers(t *testing.T) {
+	t.Run("load from file", func(tt *testing.T) {
+		filePath := filepath.Join(tt.TempDir(), "trusted-issuers.json")
+		require.NoError(tt, os.WriteFile(filePath, []byte(`{"name": [{"did": "did:web:*.example.com", "types": ["NameCredential"]}]}`), 0600))
+
+		trustedIssuers, err := LoadTrustedIssuers(filePath)
+		assert.NoError(tt, err)
+		assert.Equal(tt, TrustedIssuers{"name": {{DID: "did:web:*.example.com", Types: []string{"NameCredential"}}}}, trustedIssuers)
+	})
+
+	t.Run("missing file", func(tt *testing.T) {
+		_, err := LoadTrustedIssuers(filepath.Join(tt.TempDir(), "missing.json"))
+		assert.Error(tt, err)
+	})
+
+	t.Run("invalid file", func(tt *testing.T) {
+		filePath := filepath.Join(tt.TempDir(), "trusted-issuers.json")
+		require.NoError(tt, os.WriteFile(filePath, []byte(`{"name": [{"types": ["NameCredential"]}]}`), 0600))
+		_, err := LoadTrustedIssuers(filePath)
+		assert.Error(tt, err)
+	})
+}
+
+func TestLoadTrustList(t *testing.T) {
+	r, err := resolver.NewResolver([]didsdk.Method{didsdk.KeyMethod}, "")
+	require.NoError(t, err)
+
+	publisher := newTestSigner(t)
+	buildTrustList := func() credential.VerifiableCredential {
+		return credential.VerifiableCredential{
+			Context:      []any{"https://www.w3.org/2018/credentials/v1"},
+			Type:         []string{"VerifiableCredential", "TrustListCredential"},
+			Issuer:       publisher.ID,
+			IssuanceDate: time.Now().Format(time.RFC3339),
+			CredentialSubject: map[string]any{
+				"id": "https://example.com/trust-list",
+				"trustedIssuers": map[string]any{
+					"name": []any{map[string]any{"did": "did:web:issuer.example.com"}},
+				},
+			},
+		}
+	}
+
+	t.Run("load trust list", func(tt *testing.T) {
+		trustListJWT, err := credential.SignVerifiableCredentialJWT(publisher, buildTrustList())
+		require.NoError(tt, err)
+
+		trustedIssuers, err := LoadTrustList(context.Background(), r, string(trustListJWT), publisher.ID)
+		assert.NoError(tt, err)
+		assert.Equal(tt, TrustedIssuers{"name": {{DID: "did:web:issuer.example.com"}}}, trustedIssuers)
+	})
+
+	t.Run("trust list from another publisher", func(tt *testing.T) {
+		trustListJWT, err := credential.SignVerifiableCredentialJWT(publisher, buildTrustList())
+		require.NoError(tt, err)
+
+		_, err = LoadTrustList(context.Background(), r, string(trustListJWT), "did:key:other")
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "not the trusted publisher")
+	})
+
+	t.Run("trust list with invalid signature", func(tt *testing.T) {
+		forger := newTestSigner(tt)
+		forger.ID = publisher.ID
+		forger.KID = publisher.KID
+		trustListJWT, err := credential.SignVerifiableCredentialJWT(forger, buildTrustList())
+		require.NoError(tt, err)
+
+		_, err = LoadTrustList(context.Background(), r, string(trustListJWT), publisher.ID)
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "verifying trust list")
+	})
+}
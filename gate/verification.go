@@ -0,0 +1,189 @@
+package gate
+
+import (
+	"context"
+	gocrypto "crypto"
+	"fmt"
+	"time"
+
+	"github.com/TBD54566975/ssi-sdk/credential"
+	"github.com/TBD54566975/ssi-sdk/crypto/jwx"
+	didsdk "github.com/TBD54566975/ssi-sdk/did"
+	"github.com/TBD54566975/ssi-sdk/util"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/piprate/json-gold/ld"
+	"github.com/pkg/errors"
+
+	"github.com/TBD54566975/credential-gate/resolver"
+)
+
+// verifyPresentationJWT verifies the signature of a VP JWT against the submitter's DID, that the VP is
+// currently valid, and that it is addressed to the gate. The VP must be signed with a key of the submitter's
+// DID in the configured verification relationship, which is authentication unless configured otherwise.
+func (cg *CredentialGate) verifyPresentationJWT(ctx context.Context, presentationJWT string, headers jws.Headers, token jwt.Token) error {
+	kid := headers.KeyID()
+	if kid == "" {
+		return newDenial(ReasonInvalidSubmission, errors.New("missing kid in header of VP JWT"))
+	}
+	if !kidBelongsTo(kid, token.Issuer()) {
+		return newDenial(ReasonKeyNotAuthorized, errors.Errorf("kid<%s> of VP JWT does not belong to the submitter's DID<%s>", kid, token.Issuer()))
+	}
+	relationship := cg.config.PresentationKeyRelationship
+	if relationship == "" {
+		relationship = AuthenticationRelationship
+	}
+	if err := verifyJWTSignature(ctx, cg.resolver, presentationJWT, token.Issuer(), kid, relationship); err != nil {
+		return errors.Wrap(err, "verifying VP JWT")
+	}
+	clock := cg.validityClock()
+	if err := clock.checkJWT(token, "VP JWT"); err != nil {
+		return err
+	}
+	if err := clock.checkAge(token.IssuedAt(), cg.config.MaxPresentationAge, "VP JWT"); err != nil {
+		return err
+	}
+	return cg.checkAudience("audience", token.Audience())
+}
+
+// checkAudience makes sure a submission is addressed to the gate, since the admin DID is the audience, or domain, of
+// any submission to the gate
+func (cg *CredentialGate) checkAudience(name string, audience []string) error {
+	for _, aud := range audience {
+		if aud == cg.config.AdminDID {
+			return nil
+		}
+	}
+	return newDenial(ReasonAudienceMismatch, errors.Errorf("%s mismatch: expected [%s], got %s", name, cg.config.AdminDID, audience))
+}
+
+// verifyCredentials verifies the signature of each credential in the VP, along with the key binding of SD-JWT
+// credentials. If the VP contains a presentation submission, denials name the input descriptor the failing
+// credential was submitted for.
+func (cg *CredentialGate) verifyCredentials(ctx context.Context, vp credential.VerifiablePresentation) error {
+	inputDescriptorIDs := credentialInputDescriptorIDs(vp)
+	for i, vc := range vp.VerifiableCredential {
+		var err error
+		if isSDJWT(vc) {
+			err = cg.verifySDJWT(ctx, vc.(string))
+		} else {
+			err = verifyCredential(ctx, cg.resolver, cg.documentLoader, cg.validityClock(), vc)
+		}
+		if err != nil {
+			reason := getReason(err)
+			return newInputDescriptorDenial(reason.Code, inputDescriptorIDs[i], nil, errors.Wrapf(err, "verifying credential %d", i))
+		}
+	}
+	return nil
+}
+
+// credentialInputDescriptorIDs maps the index of each credential in the VP to the ID of the input descriptor
+// it was submitted for, if the VP contains a presentation submission
+func credentialInputDescriptorIDs(vp credential.VerifiablePresentation) map[int]string {
+	inputDescriptorIDs := make(map[int]string)
+	if vp.PresentationSubmission == nil {
+		return inputDescriptorIDs
+	}
+	submission, err := toPresentationSubmission(vp.PresentationSubmission)
+	if err != nil {
+		return inputDescriptorIDs
+	}
+	for i := range vp.VerifiableCredential {
+		path := fmt.Sprintf("$.verifiableCredential[%d]", i)
+		for _, d := range submission.DescriptorMap {
+			if d.Path == path {
+				inputDescriptorIDs[i] = d.ID
+				break
+			}
+		}
+	}
+	return inputDescriptorIDs
+}
+
+// verifyCredential verifies the signature of a credential, either a JWT or a JSON-LD credential with a Data
+// Integrity proof, resolving the issuer's DID with the given resolver, and that it is currently valid by the clock
+func verifyCredential(ctx context.Context, r *resolver.Resolver, loader ld.DocumentLoader, clock validityClock, vc any) error {
+	vcJWT, ok := vc.(string)
+	if !ok {
+		vcJSON, err := util.ToJSONMap(vc)
+		if err != nil {
+			return newDenial(ReasonInvalidSubmission, errors.Wrap(err, "parsing credential"))
+		}
+		return verifyDataIntegrityCredential(ctx, r, loader, clock, vcJSON)
+	}
+
+	headers, token, _, err := credential.ParseVerifiableCredentialFromJWT(vcJWT)
+	if err != nil {
+		return newDenial(ReasonInvalidSubmission, errors.Wrap(err, "parsing credential JWT"))
+	}
+	kid := headers.KeyID()
+	if kid == "" {
+		return newDenial(ReasonInvalidSubmission, errors.Errorf("missing kid in header of %s", credentialName(token.JwtID(), token.Issuer())))
+	}
+	if err = verifyJWTSignature(ctx, r, vcJWT, token.Issuer(), kid, ""); err != nil {
+		return err
+	}
+	// the validity period of a credential JWT may be stated both by its claims and by its vc claim
+	name := credentialName(token.JwtID(), token.Issuer())
+	if err = clock.checkJWT(token, name); err != nil {
+		return err
+	}
+	if vcClaim, ok := token.Get(credential.VCJWTProperty); ok {
+		if vcJSON, ok := vcClaim.(map[string]any); ok {
+			return clock.checkCredentialDates(vcJSON, name)
+		}
+	}
+	return nil
+}
+
+// credentialName names a credential in a denial by its ID, or by its issuer if it has no ID
+func credentialName(id, issuer string) string {
+	if id == "" {
+		return fmt.Sprintf("credential issued by %s", issuer)
+	}
+	return fmt.Sprintf("credential<%s>", id)
+}
+
+// verifyJWTSignature resolves the signer's DID and verifies the signature of a JWT with the key identified by kid.
+// If a verification relationship is given, the key must be in that relationship; otherwise, any verification
+// method of the signer's DID may be used.
+func verifyJWTSignature(ctx context.Context, r *resolver.Resolver, token, signer, kid string, relationship VerificationRelationship) error {
+	pubKey, err := getVerificationKey(ctx, r, signer, kid, relationship)
+	if err != nil {
+		return err
+	}
+	verifier, err := jwx.NewJWXVerifier(signer, kid, pubKey)
+	if err != nil {
+		return errors.Wrap(err, "constructing JWT verifier")
+	}
+	if err = verifier.VerifyJWS(token); err != nil {
+		return newDenial(ReasonSignatureInvalid, err)
+	}
+	return nil
+}
+
+// getVerificationKey resolves the signer's DID and returns the public key identified by kid. If a verification
+// relationship is given, the key must be in that relationship; otherwise, any verification method of the
+// signer's DID may be used.
+func getVerificationKey(ctx context.Context, r *resolver.Resolver, signer, kid string, relationship VerificationRelationship) (gocrypto.PublicKey, error) {
+	start := time.Now()
+	resolved, source, err := r.ResolveWithSource(ctx, signer)
+	traceFromContext(ctx).addResolution(signer, source, start, err)
+	if errors.Is(err, resolver.ErrMethodNotAllowed) {
+		return nil, newDenial(ReasonDIDMethodUnsupported, errors.Wrapf(err, "resolving signer's DID<%s>", signer))
+	}
+	if err != nil {
+		return nil, newDenial(ReasonDIDUnresolvable, errors.Wrapf(err, "resolving signer's DID<%s>", signer))
+	}
+	doc := &resolved.Document
+	if relationship != "" {
+		if doc, err = getRelationshipDocument(resolved.Document, relationship, kid); err != nil {
+			return nil, err
+		}
+	}
+	pubKey, err := didsdk.GetKeyFromVerificationMethod(*doc, kid)
+	if err != nil {
+		return nil, newDenial(ReasonKeyNotFound, errors.Wrapf(err, "getting public key<%s> from signer's DID", kid))
+	}
+	return pubKey, nil
+}
@@ -0,0 +1,205 @@
+package gate
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/TBD54566975/ssi-sdk/credential/exchange"
+	"github.com/pkg/errors"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+const (
+	// WASMHandlerName is the name the WebAssembly handler is built into every HandlerRegistry under
+	WASMHandlerName = "wasm"
+
+	// wasmHostModule is the module of the host functions a WebAssembly handler may import
+	wasmHostModule = "credential_gate"
+
+	defaultWASMFunction         = "handle"
+	defaultWASMMemoryLimitPages = 16
+	defaultWASMTimeout          = time.Second
+
+	wasmAllocFunction = "alloc"
+)
+
+// WASMHandlerConfig configures a custom handler implemented by a WebAssembly module, which is run in a sandbox
+// with no access to the filesystem, network, or environment of the gate.
+//
+// The module must export its memory, an alloc function taking a size in bytes and returning a pointer to that many
+// bytes of its memory, and the handler function, which takes a pointer to and length of the JSON serialized
+// exchange.VerifiedSubmissionData and returns 1 to accept the credential, or 0 to reject it. The handler function
+// may instead fail by calling the set_error function imported from the credential_gate module with a pointer to and
+// length of an error message. WASI is available, and a module's _initialize function, if any, is called before
+// each evaluation.
+type WASMHandlerConfig struct {
+	// ModulePath is the path of the WebAssembly module
+	ModulePath string `json:"modulePath"`
+
+	// Function is the name of the exported handler function
+	// If empty, the function is named handle
+	Function string `json:"function,omitempty"`
+
+	// MemoryLimitPages is the most memory, in 64KiB pages, the module may use
+	// If empty, the module may use 16 pages (1MiB)
+	MemoryLimitPages uint32 `json:"memoryLimitPages,omitempty"`
+
+	// Timeout is how long each evaluation of the handler may run for
+	// If empty, evaluations time out after one second
+	Timeout time.Duration `json:"timeout,omitempty"`
+}
+
+type wasmErrorKey struct{}
+
+// NewWASMHandler creates a custom handler which runs a WebAssembly module against each credential submitted for
+// an input descriptor. The module is compiled, and its exports checked, when the handler is created, and a new
+// instance of it is used for every evaluation, so no state is shared between evaluations. The handler's runtime is
+// released by its Close.
+func NewWASMHandler(ctx context.Context, inputDescriptorID string, config WASMHandlerConfig) (CustomHandler, error) {
+	if config.ModulePath == "" {
+		return CustomHandler{}, errors.New("WASM handler requires a module path")
+	}
+	if config.Function == "" {
+		config.Function = defaultWASMFunction
+	}
+	if config.MemoryLimitPages == 0 {
+		config.MemoryLimitPages = defaultWASMMemoryLimitPages
+	}
+	if config.Timeout == 0 {
+		config.Timeout = defaultWASMTimeout
+	}
+	moduleBytes, err := os.ReadFile(config.ModulePath)
+	if err != nil {
+		return CustomHandler{}, errors.Wrapf(err, "reading WASM module %s", config.ModulePath)
+	}
+
+	runtime := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(config.MemoryLimitPages).
+		WithCloseOnContextDone(true))
+	compiled, err := compileWASMModule(ctx, runtime, moduleBytes, config)
+	if err != nil {
+		_ = runtime.Close(ctx)
+		return CustomHandler{}, err
+	}
+
+	return CustomHandler{
+		InputDescriptorID: inputDescriptorID,
+		Handler: func(ctx context.Context, vsd exchange.VerifiedSubmissionData) (bool, error) {
+			return runWASMHandler(ctx, runtime, compiled, config, vsd)
+		},
+		Close: func(ctx context.Context) error {
+			return errors.Wrap(runtime.Close(ctx), "closing WASM runtime")
+		},
+	}, nil
+}
+
+// compileWASMModule instantiates WASI and the host module in the runtime, then compiles the module and checks it
+// exports its memory and the functions the handler calls
+func compileWASMModule(ctx context.Context, runtime wazero.Runtime, moduleBytes []byte, config WASMHandlerConfig) (wazero.CompiledModule, error) {
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, runtime); err != nil {
+		return nil, errors.Wrap(err, "instantiating WASI")
+	}
+	_, err := runtime.NewHostModuleBuilder(wasmHostModule).
+		NewFunctionBuilder().WithFunc(setWASMError).Export("set_error").
+		Instantiate(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "instantiating WASM host module")
+	}
+	compiled, err := runtime.CompileModule(ctx, moduleBytes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "compiling WASM module %s", config.ModulePath)
+	}
+	exports := compiled.ExportedFunctions()
+	for _, name := range []string{wasmAllocFunction, config.Function} {
+		if _, ok := exports[name]; !ok {
+			return nil, errors.Errorf("WASM module %s does not export function %s", config.ModulePath, name)
+		}
+	}
+	if len(compiled.ExportedMemories()) == 0 {
+		return nil, errors.Errorf("WASM module %s does not export its memory", config.ModulePath)
+	}
+	return compiled, nil
+}
+
+// newWASMHandler is the factory of the built-in WebAssembly handler
+func newWASMHandler(ctx context.Context, inputDescriptorID string, params HandlerParams) (CustomHandler, error) {
+	config := WASMHandlerConfig{
+		ModulePath:       params.String("modulePath"),
+		Function:         params.String("function"),
+		MemoryLimitPages: uint32(params.Number("memoryLimitPages")),
+	}
+	if timeout := params.String("timeout"); timeout != "" {
+		var err error
+		if config.Timeout, err = time.ParseDuration(timeout); err != nil {
+			return CustomHandler{}, errors.Wrap(err, "parsing timeout")
+		}
+	}
+	return NewWASMHandler(ctx, inputDescriptorID, config)
+}
+
+// runWASMHandler evaluates a credential's submission data with a new instance of the module
+func runWASMHandler(ctx context.Context, runtime wazero.Runtime, compiled wazero.CompiledModule, config WASMHandlerConfig, vsd exchange.VerifiedSubmissionData) (bool, error) {
+	input, err := json.Marshal(vsd)
+	if err != nil {
+		return false, errors.Wrap(err, "marshalling submission data")
+	}
+	ctx, cancel := context.WithTimeout(ctx, config.Timeout)
+	defer cancel()
+	var handlerErr string
+	ctx = context.WithValue(ctx, wasmErrorKey{}, &handlerErr)
+
+	// an anonymous module may be instantiated any number of times
+	mod, err := runtime.InstantiateModule(ctx, compiled, wazero.NewModuleConfig().WithName("").WithStartFunctions("_initialize"))
+	if err != nil {
+		return false, errors.Wrap(err, "instantiating WASM module")
+	}
+	defer mod.Close(ctx)
+
+	allocated, err := mod.ExportedFunction(wasmAllocFunction).Call(ctx, uint64(len(input)))
+	if err != nil {
+		return false, errors.Wrap(err, "allocating WASM memory")
+	}
+	ptr := uint32(allocated[0])
+	if !mod.Memory().Write(ptr, input) {
+		return false, errors.Errorf("writing %d bytes of submission data out of range of WASM memory", len(input))
+	}
+	results, err := mod.ExportedFunction(config.Function).Call(ctx, uint64(ptr), uint64(len(input)))
+	if err != nil {
+		if ctx.Err() != nil {
+			return false, errors.Wrapf(ctx.Err(), "running WASM handler")
+		}
+		return false, errors.Wrap(err, "running WASM handler")
+	}
+	if handlerErr != "" {
+		return false, errors.New(handlerErr)
+	}
+	if len(results) != 1 {
+		return false, errors.Errorf("WASM handler returned %d results, expected 1", len(results))
+	}
+	switch api.DecodeI32(results[0]) {
+	case 0:
+		return false, nil
+	case 1:
+		return true, nil
+	default:
+		return false, errors.Errorf("WASM handler returned %d, expected 0 or 1", api.DecodeI32(results[0]))
+	}
+}
+
+// setWASMError is the set_error host function, with which a module reports an error from its handler function
+func setWASMError(ctx context.Context, m api.Module, ptr, length uint32) {
+	handlerErr, ok := ctx.Value(wasmErrorKey{}).(*string)
+	if !ok {
+		return
+	}
+	msg, ok := m.Memory().Read(ptr, length)
+	if !ok {
+		*handlerErr = "WASM handler reported an error out of range of its memory"
+		return
+	}
+	*handlerErr = string(msg)
+}
@@ -0,0 +1,194 @@
+package gate
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/TBD54566975/ssi-sdk/credential/exchange"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildTestWASMModule encodes a WebAssembly module which imports set_error, exports a page of memory, a bump
+// allocator, and a handle function with the given body, and holds the given data at address 0
+func buildTestWASMModule(memoryPages uint32, handleBody []byte, data string) []byte {
+	uleb := func(v uint32) []byte {
+		var b []byte
+		for {
+			c := byte(v & 0x7f)
+			v >>= 7
+			if v != 0 {
+				c |= 0x80
+			}
+			b = append(b, c)
+			if v == 0 {
+				return b
+			}
+		}
+	}
+	name := func(s string) []byte {
+		return append(uleb(uint32(len(s))), s...)
+	}
+	vec := func(items ...[]byte) []byte {
+		b := uleb(uint32(len(items)))
+		for _, item := range items {
+			b = append(b, item...)
+		}
+		return b
+	}
+	section := func(id byte, contents []byte) []byte {
+		return append(append([]byte{id}, uleb(uint32(len(contents)))...), contents...)
+	}
+	code := func(body []byte) []byte {
+		fn := append([]byte{0x00}, body...) // no locals
+		fn = append(fn, 0x0b)
+		return append(uleb(uint32(len(fn))), fn...)
+	}
+	const i32 = 0x7f
+
+	module := []byte{0x00, 'a', 's', 'm', 0x01, 0x00, 0x00, 0x00}
+	module = append(module, section(1, vec(
+		[]byte{0x60, 0x02, i32, i32, 0x00},      // set_error: (i32, i32) -> ()
+		[]byte{0x60, 0x01, i32, 0x01, i32},      // alloc: (i32) -> i32
+		[]byte{0x60, 0x02, i32, i32, 0x01, i32}, // handle: (i32, i32) -> i32
+	))...)
+	module = append(module, section(2, vec(
+		append(append(name(wasmHostModule), name("set_error")...), 0x00, 0x00),
+	))...)
+	module = append(module, section(3, vec([]byte{0x01}, []byte{0x02}))...)
+	module = append(module, section(5, vec(append([]byte{0x00}, uleb(memoryPages)...)))...)
+	// the heap starts at 1024, after the data
+	module = append(module, section(6, vec([]byte{i32, 0x01, 0x41, 0x80, 0x08, 0x0b}))...)
+	module = append(module, section(7, vec(
+		append(name("memory"), 0x02, 0x00),
+		append(name("alloc"), 0x00, 0x01),
+		append(name("handle"), 0x00, 0x02),
+	))...)
+	module = append(module, section(10, vec(
+		// return the heap, moving it past the allocation
+		code([]byte{0x23, 0x00, 0x23, 0x00, 0x20, 0x00, 0x6a, 0x24, 0x00}),
+		code(handleBody),
+	))...)
+	module = append(module, section(11, vec(
+		append([]byte{0x00, 0x41, 0x00, 0x0b}, name(data)...),
+	))...)
+	return module
+}
+
+var (
+	testWASMAccept = []byte{0x41, 0x01}
+	testWASMReject = []byte{0x41, 0x00}
+	// accept if the input starts with '{'
+	testWASMInspect = []byte{0x20, 0x00, 0x2d, 0x00, 0x00, 0x41, 0xfb, 0x00, 0x46}
+	// report the 13 bytes of data at address 0 as an error
+	testWASMError = []byte{0x41, 0x00, 0x41, 0x0d, 0x10, 0x00, 0x41, 0x00}
+	// loop forever
+	testWASMLoop = []byte{0x03, 0x40, 0x0c, 0x00, 0x0b, 0x41, 0x00}
+	// accept if growing memory by 64 pages fails
+	testWASMGrow = []byte{0x41, 0xc0, 0x00, 0x40, 0x00, 0x41, 0x7f, 0x46}
+	// return neither 0 nor 1
+	testWASMInvalidResult = []byte{0x41, 0x02}
+)
+
+func TestWASMHandler(t *testing.T) {
+	writeModule := func(tt *testing.T, module []byte) string {
+		modulePath := filepath.Join(tt.TempDir(), "handler.wasm")
+		require.NoError(tt, os.WriteFile(modulePath, module, 0600))
+		return modulePath
+	}
+	vsd := exchange.VerifiedSubmissionData{InputDescriptorID: "name", Claim: "claim", FilteredData: "Satoshi"}
+	run := func(tt *testing.T, handleBody []byte, config WASMHandlerConfig) (bool, error) {
+		config.ModulePath = writeModule(tt, buildTestWASMModule(1, handleBody, "handler error"))
+		ch, err := NewWASMHandler(context.Background(), "name", config)
+		require.NoError(tt, err)
+		return ch.Handler(context.Background(), vsd)
+	}
+
+	t.Run("accept and reject", func(tt *testing.T) {
+		result, err := run(tt, testWASMAccept, WASMHandlerConfig{})
+		assert.NoError(tt, err)
+		assert.True(tt, result)
+
+		result, err = run(tt, testWASMReject, WASMHandlerConfig{})
+		assert.NoError(tt, err)
+		assert.False(tt, result)
+
+		result, err = run(tt, testWASMInspect, WASMHandlerConfig{})
+		assert.NoError(tt, err)
+		assert.True(tt, result)
+	})
+
+	t.Run("handler error", func(tt *testing.T) {
+		_, err := run(tt, testWASMError, WASMHandlerConfig{})
+		assert.Error(tt, err)
+		assert.Equal(tt, "handler error", err.Error())
+
+		_, err = run(tt, testWASMInvalidResult, WASMHandlerConfig{})
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "expected 0 or 1")
+	})
+
+	t.Run("time limit", func(tt *testing.T) {
+		start := time.Now()
+		_, err := run(tt, testWASMLoop, WASMHandlerConfig{Timeout: 50 * time.Millisecond})
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "deadline exceeded")
+		assert.Less(tt, time.Since(start), 5*time.Second)
+	})
+
+	t.Run("memory limit", func(tt *testing.T) {
+		result, err := run(tt, testWASMGrow, WASMHandlerConfig{MemoryLimitPages: 16})
+		assert.NoError(tt, err)
+		assert.True(tt, result)
+
+		result, err = run(tt, testWASMGrow, WASMHandlerConfig{MemoryLimitPages: 128})
+		assert.NoError(tt, err)
+		assert.False(tt, result)
+
+		modulePath := writeModule(tt, buildTestWASMModule(32, testWASMAccept, ""))
+		_, err = NewWASMHandler(context.Background(), "name", WASMHandlerConfig{ModulePath: modulePath, MemoryLimitPages: 16})
+		assert.Error(tt, err)
+	})
+
+	t.Run("invalid modules", func(tt *testing.T) {
+		_, err := NewWASMHandler(context.Background(), "name", WASMHandlerConfig{ModulePath: filepath.Join(tt.TempDir(), "missing.wasm")})
+		assert.Error(tt, err)
+
+		_, err = NewWASMHandler(context.Background(), "name", WASMHandlerConfig{ModulePath: writeModule(tt, []byte("not wasm"))})
+		assert.Error(tt, err)
+
+		modulePath := writeModule(tt, buildTestWASMModule(1, testWASMAccept, ""))
+		_, err = NewWASMHandler(context.Background(), "name", WASMHandlerConfig{ModulePath: modulePath, Function: "evaluate"})
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "does not export function evaluate")
+	})
+
+	t.Run("referenced from config", func(tt *testing.T) {
+		modulePath := writeModule(tt, buildTestWASMModule(1, testWASMInspect, ""))
+		ch, err := NewHandlerRegistry().Create(context.Background(), "name", HandlerReference{
+			Handler: WASMHandlerName,
+			Params:  map[string]any{"modulePath": modulePath, "timeout": "100ms", "memoryLimitPages": float64(4)},
+		})
+		require.NoError(tt, err)
+		result, err := ch.Handler(context.Background(), vsd)
+		assert.NoError(tt, err)
+		assert.True(tt, result)
+
+		_, err = NewHandlerRegistry().Create(context.Background(), "name", HandlerReference{
+			Handler: WASMHandlerName,
+			Params:  map[string]any{"modulePath": modulePath, "timeout": "soon"},
+		})
+		assert.Error(tt, err)
+	})
+	t.Run("closed handler", func(tt *testing.T) {
+		ch, err := NewWASMHandler(context.Background(), "name", WASMHandlerConfig{ModulePath: writeModule(tt, buildTestWASMModule(1, testWASMAccept, ""))})
+		require.NoError(tt, err)
+		require.NotNil(tt, ch.Close)
+		assert.NoError(tt, ch.Close(context.Background()))
+		_, err = ch.Handler(context.Background(), vsd)
+		assert.Error(tt, err)
+	})
+}
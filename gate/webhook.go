@@ -0,0 +1,202 @@
+package gate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/TBD54566975/ssi-sdk/credential/exchange"
+	"github.com/TBD54566975/ssi-sdk/crypto/jwx"
+	"github.com/google/uuid"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// WebhookHandlerName is the name the webhook handler is built into every HandlerRegistry under
+	WebhookHandlerName = "webhook"
+
+	// WebhookSignatureHeader is the header of a webhook request holding the JWS, with detached payload, by which
+	// the gate's admin DID signs the request body
+	WebhookSignatureHeader = "X-Credential-Gate-Signature"
+
+	// the protected headers of a webhook request's JWS, besides its kid, which bind the signature to the time it was
+	// made, a unique ID, and the request's method and URL, as in https://www.rfc-editor.org/rfc/rfc9449#section-4.2
+	webhookIssuedAtHeader = "iat"
+	webhookIDHeader       = "jti"
+	webhookMethodHeader   = "htm"
+	webhookURLHeader      = "htu"
+
+	defaultWebhookTimeout = 5 * time.Second
+
+	// maxWebhookResponseSize bounds how much of a webhook response is read
+	maxWebhookResponseSize = 1 << 20
+)
+
+// WebhookHandlerConfig configures a custom handler which calls out to an HTTP service to decide whether to accept
+// each credential submitted for its input descriptor.
+//
+// The JSON serialized exchange.VerifiedSubmissionData is POSTed to the URL, signed by the admin DID with a JWS with
+// detached payload in the X-Credential-Gate-Signature header. Besides its kid, the JWS has the protected headers
+// iat, the time the request was signed in seconds since the epoch, jti, a unique ID, htm, the method POST, and htu,
+// the URL. Having verified the signature over the request body, the service must check htm and htu are the method
+// and URL it was called with, that iat is within a short window of its clock, and that it has not seen jti within
+// that window, so a captured request can neither be replayed nor redirected to another service. The service must
+// respond with a 2xx status and a JSON object whose allow property is true to accept the credential, or false to
+// reject it, with an optional reason. Redirects are not followed.
+type WebhookHandlerConfig struct {
+	// URL is where the submission data is POSTed
+	URL string `json:"url"`
+
+	// Timeout is how long each request may take
+	// If empty, requests time out after five seconds
+	Timeout time.Duration `json:"timeout,omitempty"`
+
+	// Signer signs requests on behalf of the admin DID
+	// If empty, the gate's AdminSigner is used, which the gate must then be configured with
+	Signer *jwx.Signer `json:"-"`
+
+	// Client sends requests; it is never allowed to follow redirects
+	// If empty, a default client is used
+	Client *http.Client `json:"-"`
+}
+
+// webhookResponse is the decision of a webhook service
+type webhookResponse struct {
+	Allow  *bool  `json:"allow"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// NewWebhookHandler creates a custom handler which POSTs the submission data of each credential submitted for an
+// input descriptor to a service, accepting the credential if the service allows it
+func NewWebhookHandler(inputDescriptorID string, config WebhookHandlerConfig) (CustomHandler, error) {
+	if config.URL == "" {
+		return CustomHandler{}, errors.New("webhook handler requires a URL")
+	}
+	if u, err := url.Parse(config.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return CustomHandler{}, errors.Errorf("webhook handler URL<%s> is not an HTTP URL", config.URL)
+	}
+	if config.Timeout == 0 {
+		config.Timeout = defaultWebhookTimeout
+	}
+	client := http.Client{}
+	if config.Client != nil {
+		client = *config.Client
+	}
+	// a redirect would send the signed request somewhere other than the URL it is signed for
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	config.Client = &client
+	return CustomHandler{
+		InputDescriptorID: inputDescriptorID,
+		Handler: func(ctx context.Context, vsd exchange.VerifiedSubmissionData) (bool, error) {
+			return callWebhook(ctx, config, vsd)
+		},
+		requiresAdminSigner: config.Signer == nil,
+	}, nil
+}
+
+// newWebhookHandler is the factory of the built-in webhook handler
+func newWebhookHandler(_ context.Context, inputDescriptorID string, params HandlerParams) (CustomHandler, error) {
+	config := WebhookHandlerConfig{URL: params.String("url")}
+	if timeout := params.String("timeout"); timeout != "" {
+		var err error
+		if config.Timeout, err = time.ParseDuration(timeout); err != nil {
+			return CustomHandler{}, errors.Wrap(err, "parsing timeout")
+		}
+	}
+	return NewWebhookHandler(inputDescriptorID, config)
+}
+
+// callWebhook sends a credential's submission data to the webhook service and interprets its decision
+func callWebhook(ctx context.Context, config WebhookHandlerConfig, vsd exchange.VerifiedSubmissionData) (bool, error) {
+	signer := config.Signer
+	if signer == nil {
+		signer = adminSignerFromContext(ctx)
+	}
+	if signer == nil {
+		return false, errors.New("no admin signer to sign webhook request")
+	}
+	body, err := json.Marshal(vsd)
+	if err != nil {
+		return false, errors.Wrap(err, "marshalling submission data")
+	}
+	signature, err := signWebhookRequest(*signer, http.MethodPost, config.URL, body)
+	if err != nil {
+		return false, errors.Wrap(err, "signing webhook request")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, config.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, errors.Wrap(err, "creating webhook request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookSignatureHeader, signature)
+	resp, err := config.Client.Do(req)
+	if err != nil {
+		return false, errors.Wrap(err, "calling webhook")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return false, errors.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+
+	var decision webhookResponse
+	if err = json.NewDecoder(io.LimitReader(resp.Body, maxWebhookResponseSize)).Decode(&decision); err != nil {
+		return false, errors.Wrap(err, "decoding webhook response")
+	}
+	if decision.Allow == nil {
+		return false, errors.New("webhook response has no allow decision")
+	}
+	if !*decision.Allow {
+		logrus.Debugf("webhook denied input descriptor ID %s: %s", vsd.InputDescriptorID, decision.Reason)
+	}
+	return *decision.Allow, nil
+}
+
+// signWebhookRequest signs the body of a webhook request, returning a compact JWS with the body detached whose
+// protected headers bind it to the time it was signed, a unique ID, and the request's method and URL
+func signWebhookRequest(signer jwx.Signer, method, requestURL string, payload []byte) (string, error) {
+	headers := jws.NewHeaders()
+	for k, v := range map[string]any{
+		jws.KeyIDKey:          signer.KID,
+		webhookIssuedAtHeader: time.Now().Unix(),
+		webhookIDHeader:       uuid.NewString(),
+		webhookMethodHeader:   method,
+		webhookURLHeader:      requestURL,
+	} {
+		if err := headers.Set(k, v); err != nil {
+			return "", errors.Wrapf(err, "setting %s header", k)
+		}
+	}
+	signed, err := jws.Sign(nil, jws.WithKey(jwa.SignatureAlgorithm(signer.ALG), signer.PrivateKey, jws.WithProtectedHeaders(headers)),
+		jws.WithDetachedPayload(payload))
+	if err != nil {
+		return "", err
+	}
+	return string(signed), nil
+}
+
+type adminSignerKey struct{}
+
+// withAdminSigner makes the admin signer available to the custom handlers run with the context
+func withAdminSigner(ctx context.Context, signer *jwx.Signer) context.Context {
+	if signer == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, adminSignerKey{}, signer)
+}
+
+func adminSignerFromContext(ctx context.Context) *jwx.Signer {
+	signer, _ := ctx.Value(adminSignerKey{}).(*jwx.Signer)
+	return signer
+}
@@ -0,0 +1,246 @@
+package gate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TBD54566975/ssi-sdk/credential"
+	"github.com/TBD54566975/ssi-sdk/credential/exchange"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookHandler(t *testing.T) {
+	signer := newTestSigner(t)
+	publicKey, err := jwk.PublicKeyOf(signer.PrivateKey)
+	require.NoError(t, err)
+
+	// the service allows submission data whose filtered data is "Satoshi", if the request is signed by the admin, for
+	// the URL it was called with, recently, and has not been seen before. Requests to /redirect are redirected to
+	// /webhook.
+	newService := func(tt *testing.T) *httptest.Server {
+		var mu sync.Mutex
+		seen := make(map[string]bool)
+		service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/redirect" {
+				http.Redirect(w, r, "/webhook", http.StatusTemporaryRedirect)
+				return
+			}
+			body, err := io.ReadAll(r.Body)
+			require.NoError(tt, err)
+			signature := r.Header.Get(WebhookSignatureHeader)
+			if _, err = jws.Verify([]byte(signature), jws.WithKey(jwa.SignatureAlgorithm(signer.ALG), publicKey), jws.WithDetachedPayload(body)); err != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			message, err := jws.Parse([]byte(signature))
+			require.NoError(tt, err)
+			headers := message.Signatures()[0].ProtectedHeaders()
+			method, _ := headers.Get(webhookMethodHeader)
+			requestURL, _ := headers.Get(webhookURLHeader)
+			issuedAt, _ := headers.Get(webhookIssuedAtHeader)
+			id, _ := headers.Get(webhookIDHeader)
+			iat, _ := issuedAt.(float64)
+			mu.Lock()
+			replayed := seen[id.(string)]
+			seen[id.(string)] = true
+			mu.Unlock()
+			if method != r.Method || requestURL != "http://"+r.Host+r.URL.Path || time.Since(time.Unix(int64(iat), 0)) > time.Minute || replayed {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			var vsd exchange.VerifiedSubmissionData
+			require.NoError(tt, json.Unmarshal(body, &vsd))
+			switch vsd.FilteredData {
+			case "slow":
+				time.Sleep(200 * time.Millisecond)
+			case "malformed":
+				_, _ = w.Write([]byte(`{"decision": "allow"}`))
+				return
+			}
+			_ = json.NewEncoder(w).Encode(webhookResponse{Allow: boolPtr(vsd.FilteredData == "Satoshi"), Reason: "unknown name"})
+		}))
+		tt.Cleanup(service.Close)
+		return service
+	}
+	vsd := func(filteredData string) exchange.VerifiedSubmissionData {
+		return exchange.VerifiedSubmissionData{InputDescriptorID: "name", Claim: "claim", FilteredData: filteredData}
+	}
+
+	t.Run("allow and deny", func(tt *testing.T) {
+		ch, err := NewWebhookHandler("name", WebhookHandlerConfig{URL: newService(tt).URL + "/webhook", Signer: &signer})
+		require.NoError(tt, err)
+
+		result, err := ch.Handler(context.Background(), vsd("Satoshi"))
+		assert.NoError(tt, err)
+		assert.True(tt, result)
+
+		result, err = ch.Handler(context.Background(), vsd("Hal"))
+		assert.NoError(tt, err)
+		assert.False(tt, result)
+
+		_, err = ch.Handler(context.Background(), vsd("malformed"))
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "no allow decision")
+	})
+
+	t.Run("signed by the wrong key", func(tt *testing.T) {
+		otherSigner := newTestSigner(tt)
+		ch, err := NewWebhookHandler("name", WebhookHandlerConfig{URL: newService(tt).URL + "/webhook", Signer: &otherSigner})
+		require.NoError(tt, err)
+
+		_, err = ch.Handler(context.Background(), vsd("Satoshi"))
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "status 401")
+	})
+
+	t.Run("requests cannot be replayed or redirected", func(tt *testing.T) {
+		service := newService(tt)
+		var captured *http.Request
+		var capturedBody []byte
+		client := &http.Client{Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			captured = r
+			capturedBody, _ = io.ReadAll(r.Body)
+			r.Body = io.NopCloser(bytes.NewReader(capturedBody))
+			return http.DefaultTransport.RoundTrip(r)
+		})}
+		ch, err := NewWebhookHandler("name", WebhookHandlerConfig{URL: service.URL + "/webhook", Signer: &signer, Client: client})
+		require.NoError(tt, err)
+		result, err := ch.Handler(context.Background(), vsd("Satoshi"))
+		assert.NoError(tt, err)
+		assert.True(tt, result)
+
+		replay := func(url string) int {
+			req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(capturedBody))
+			require.NoError(tt, err)
+			req.Header = captured.Header.Clone()
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(tt, err)
+			defer resp.Body.Close()
+			return resp.StatusCode
+		}
+		assert.Equal(tt, http.StatusUnauthorized, replay(service.URL+"/webhook"))
+		assert.Equal(tt, http.StatusUnauthorized, replay(service.URL+"/other"))
+
+		// the signed request is not followed to where it is redirected
+		ch, err = NewWebhookHandler("name", WebhookHandlerConfig{URL: service.URL + "/redirect", Signer: &signer})
+		require.NoError(tt, err)
+		_, err = ch.Handler(context.Background(), vsd("Satoshi"))
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "status 307")
+	})
+
+	t.Run("timeout", func(tt *testing.T) {
+		ch, err := NewWebhookHandler("name", WebhookHandlerConfig{URL: newService(tt).URL + "/webhook", Signer: &signer, Timeout: 50 * time.Millisecond})
+		require.NoError(tt, err)
+
+		_, err = ch.Handler(context.Background(), vsd("slow"))
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "deadline exceeded")
+	})
+
+	t.Run("invalid config", func(tt *testing.T) {
+		_, err := NewWebhookHandler("name", WebhookHandlerConfig{})
+		assert.Error(tt, err)
+
+		_, err = NewWebhookHandler("name", WebhookHandlerConfig{URL: "ftp://example.com"})
+		assert.Error(tt, err)
+
+		// without a signer of its own, the handler must be run by a gate with an admin signer
+		ch, err := NewWebhookHandler("name", WebhookHandlerConfig{URL: newService(tt).URL + "/webhook"})
+		require.NoError(tt, err)
+		_, err = ch.Handler(context.Background(), vsd("Satoshi"))
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "no admin signer")
+	})
+
+	t.Run("gate with webhook handler", func(tt *testing.T) {
+		def := exchange.PresentationDefinition{
+			ID: "name-definition",
+			InputDescriptors: []exchange.InputDescriptor{{
+				ID:          "name",
+				Constraints: &exchange.Constraints{Fields: []exchange.Field{{Path: []string{"$.vc.credentialSubject.name"}}}},
+			}},
+		}
+		config := CredentialGateConfig{
+			AdminDID:               signer.ID,
+			AdminSigner:            &signer,
+			PresentationDefinition: def,
+			HandlerRegistry:        NewHandlerRegistry(),
+			Handlers: map[string]HandlerReference{
+				"name": {Handler: WebhookHandlerName, Params: map[string]any{"url": newService(tt).URL + "/webhook", "timeout": "1s"}},
+			},
+		}
+		gate, err := NewCredentialGate(config)
+		require.NoError(tt, err)
+
+		submitter := newTestSigner(tt)
+		buildSubmission := func(name string) string {
+			vcJWT, err := credential.SignVerifiableCredentialJWT(submitter, credential.VerifiableCredential{
+				Context:           []any{"https://www.w3.org/2018/credentials/v1"},
+				Type:              []string{"VerifiableCredential"},
+				Issuer:            submitter.ID,
+				IssuanceDate:      time.Now().Format(time.RFC3339),
+				CredentialSubject: map[string]any{"id": submitter.ID, "name": name},
+			})
+			require.NoError(tt, err)
+			return buildTestSubmissionJWT(tt, submitter, signer.ID, def, [][]byte{vcJWT}, nil)
+		}
+
+		result, err := gate.ValidatePresentationSubmission(context.Background(), buildSubmission("Satoshi"))
+		assert.NoError(tt, err)
+		assert.True(tt, result.Valid)
+
+		result, err = gate.ValidatePresentationSubmission(context.Background(), buildSubmission("Hal"))
+		assert.NoError(tt, err)
+		assert.False(tt, result.Valid)
+		assert.Equal(tt, ReasonHandlerRejected, result.Reason.Code)
+
+		// the admin signer must be the admin DID
+		otherSigner := newTestSigner(tt)
+		config.AdminSigner = &otherSigner
+		_, err = NewCredentialGate(config)
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "is not the admin DID")
+
+		// webhook handlers without a signer of their own require the gate to have an admin signer
+		config.AdminSigner = nil
+		err = config.IsValid()
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "handlers.name: handler<webhook> requires an admin signer")
+
+		ch, err := NewWebhookHandler("name", WebhookHandlerConfig{URL: newService(tt).URL + "/webhook"})
+		require.NoError(tt, err)
+		config.Handlers = nil
+		config.CustomHandlers = map[string]CustomHandler{"name": ch}
+		_, err = NewCredentialGate(config)
+		assert.Error(tt, err)
+		assert.Contains(tt, err.Error(), "requires an admin signer")
+
+		ch, err = NewWebhookHandler("name", WebhookHandlerConfig{URL: newService(tt).URL + "/webhook", Signer: &signer})
+		require.NoError(tt, err)
+		config.CustomHandlers = map[string]CustomHandler{"name": ch}
+		_, err = NewCredentialGate(config)
+		assert.NoError(tt, err)
+	})
+}
+
+type roundTripperFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
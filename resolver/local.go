@@ -50,8 +50,14 @@ func getKnownResolver(method didsdk.Method) (resolution.Resolver, error) {
 	return nil, fmt.Errorf("unsupported local resolution method: %s", method)
 }
 
-// getMethodForDID gets a DID method from a did, the second part of the did (e.g. did:test:abcd, the method is 'test')
-func getMethodForDID(did string) (didsdk.Method, error) {
+// IsLocalMethod returns true if DIDs of the given method can be resolved locally
+func IsLocalMethod(method didsdk.Method) bool {
+	_, err := getKnownResolver(method)
+	return err == nil
+}
+
+// GetMethodForDID gets a DID method from a did, the second part of the did (e.g. did:test:abcd, the method is 'test')
+func GetMethodForDID(did string) (didsdk.Method, error) {
 	split := strings.Split(did, ":")
 	if len(split) < 3 {
 		return "", errors.New("malformed did: did has fewer than three parts")
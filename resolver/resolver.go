@@ -10,10 +10,27 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// ErrMethodNotAllowed is returned when resolving a DID of a method the resolver is not allowed to resolve
+var ErrMethodNotAllowed = errors.New("DID method not allowed")
+
 // Resolver can resolve DIDs using a combination of local and universal resolvers
 type Resolver struct {
 	lr resolution.Resolver
 	ur *universalResolver
+
+	// allowedMethods are the only methods the resolver resolves, if set
+	allowedMethods []didsdk.Method
+}
+
+// Option configures a Resolver
+type Option func(r *Resolver)
+
+// WithAllowedMethods restricts the resolver to resolving DIDs of the given methods, whichever resolver supports
+// them, so DIDs of any other method are never resolved, locally or by the universal resolver
+func WithAllowedMethods(methods ...didsdk.Method) Option {
+	return func(r *Resolver) {
+		r.allowedMethods = methods
+	}
 }
 
 func (r *Resolver) Methods() []didsdk.Method {
@@ -33,7 +50,7 @@ func (r *Resolver) Methods() []didsdk.Method {
 
 // NewResolver creates a new ServiceResolver instance which can resolve DIDs using a combination of local and
 // universal resolvers.
-func NewResolver(localResolutionMethods []didsdk.Method, universalResolverURL string) (*Resolver, error) {
+func NewResolver(localResolutionMethods []didsdk.Method, universalResolverURL string, opts ...Option) (*Resolver, error) {
 	if len(localResolutionMethods) == 0 && universalResolverURL == "" {
 		return nil, fmt.Errorf("must provide at least one resolution method")
 	}
@@ -55,26 +72,49 @@ func NewResolver(localResolutionMethods []didsdk.Method, universalResolverURL st
 		}
 	}
 
-	return &Resolver{
+	r := &Resolver{
 		lr: lr,
 		ur: ur,
-	}, nil
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r, nil
 }
 
+// Source is the kind of resolver a DID was resolved with
+type Source string
+
+const (
+	// LocalSource is used for DIDs resolved by the local resolver
+	LocalSource Source = "local"
+	// UniversalSource is used for DIDs resolved by the universal resolver
+	UniversalSource Source = "universal"
+)
+
 // Resolve resolves a DID using a combination of local and universal resolvers. The ordering is as follows:
 // 1. Try to resolve with the local resolver
 // 2. Try to resolve with the universal resolver
 func (r *Resolver) Resolve(ctx context.Context, did string, opts ...resolution.ResolutionOption) (*resolution.ResolutionResult, error) {
-	method, err := getMethodForDID(did)
+	resolved, _, err := r.ResolveWithSource(ctx, did, opts...)
+	return resolved, err
+}
+
+// ResolveWithSource resolves a DID as Resolve does, also returning which resolver the DID was resolved with
+func (r *Resolver) ResolveWithSource(ctx context.Context, did string, opts ...resolution.ResolutionOption) (*resolution.ResolutionResult, Source, error) {
+	method, err := GetMethodForDID(did)
 	if err != nil {
-		return nil, errors.Wrap(err, "getting method for DID")
+		return nil, "", errors.Wrap(err, "getting method for DID")
+	}
+	if len(r.allowedMethods) > 0 && !isSupportMethod(method, r.allowedMethods) {
+		return nil, "", errors.Wrapf(ErrMethodNotAllowed, "resolving DID %s of method %s", did, method)
 	}
 
 	// first, try to resolve with the local resolver
 	if r.lr != nil && isSupportMethod(method, r.lr.Methods()) {
 		locallyResolvedDID, err := r.lr.Resolve(ctx, did, opts...)
 		if err == nil {
-			return locallyResolvedDID, nil
+			return locallyResolvedDID, LocalSource, nil
 		}
 		logrus.WithError(err).Error("error resolving DID with local resolver")
 	}
@@ -83,12 +123,12 @@ func (r *Resolver) Resolve(ctx context.Context, did string, opts ...resolution.R
 	if r.ur != nil && isSupportMethod(method, r.ur.Methods()) {
 		universallyResolvedDID, err := r.ur.Resolve(ctx, did, opts...)
 		if err == nil {
-			return universallyResolvedDID, nil
+			return universallyResolvedDID, UniversalSource, nil
 		}
 		logrus.WithError(err).Error("error resolving DID with universal resolver")
 	}
 
-	return nil, fmt.Errorf("unable to resolve DID %s", did)
+	return nil, "", fmt.Errorf("unable to resolve DID %s", did)
 }
 
 // isSupportMethod checks if a method is supported by a list of methods
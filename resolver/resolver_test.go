@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	didsdk "github.com/TBD54566975/ssi-sdk/did"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"gopkg.in/h2non/gock.v1"
 )
@@ -22,6 +23,12 @@ func TestResolver(t *testing.T) {
 		assert.Contains(tt, err.Error(), "unsupported local resolution method: bad")
 	})
 
+	t.Run("local resolution methods", func(tt *testing.T) {
+		assert.True(tt, IsLocalMethod(didsdk.KeyMethod))
+		assert.True(tt, IsLocalMethod(didsdk.JWKMethod))
+		assert.False(tt, IsLocalMethod(didsdk.IONMethod))
+	})
+
 	t.Run("valid local resolution method", func(tt *testing.T) {
 		resolver, err := NewResolver([]didsdk.Method{"key"}, "")
 		assert.NoError(tt, err)
@@ -115,4 +122,52 @@ func TestResolver(t *testing.T) {
 		assert.NotEmpty(tt, resolved)
 		assert.Equal(tt, knownDIDWeb, resolved.ID)
 	})
+
+	t.Run("resolution source of local and remote DIDs", func(tt *testing.T) {
+		gock.New("https://dev.uniresolver.io").
+			Get("/1.0/methods").
+			Persist().
+			Reply(200).
+			BodyString(`["web"]`)
+
+		gock.New("https://dev.uniresolver.io").
+			Get("/1.0/identifiers/did:web:did.actor:alice").
+			Reply(200).
+			BodyString(`{"didDocument": {"id": "did:web:did.actor:alice"}}`)
+		defer gock.Off()
+
+		resolver, err := NewResolver([]didsdk.Method{"key"}, "https://dev.uniresolver.io")
+		assert.NoError(tt, err)
+
+		_, source, err := resolver.ResolveWithSource(context.Background(), "did:key:z6MkiTBz1ymuepAQ4HEHYSF1H8quG5GLVVQR3djdX3mDooWp")
+		assert.NoError(tt, err)
+		assert.Equal(tt, LocalSource, source)
+
+		_, source, err = resolver.ResolveWithSource(context.Background(), "did:web:did.actor:alice")
+		assert.NoError(tt, err)
+		assert.Equal(tt, UniversalSource, source)
+
+		_, source, err = resolver.ResolveWithSource(context.Background(), "did:ion:unresolvable")
+		assert.Error(tt, err)
+		assert.Empty(tt, source)
+	})
+	t.Run("allowed methods", func(tt *testing.T) {
+		gock.New("https://dev.uniresolver.io").
+			Get("/1.0/methods").
+			Persist().
+			Reply(200).
+			BodyString(`["web"]`)
+		defer gock.Off()
+
+		resolver, err := NewResolver([]didsdk.Method{"key"}, "https://dev.uniresolver.io", WithAllowedMethods(didsdk.KeyMethod))
+		assert.NoError(tt, err)
+
+		_, err = resolver.Resolve(context.Background(), "did:key:z6MkiTBz1ymuepAQ4HEHYSF1H8quG5GLVVQR3djdX3mDooWp")
+		assert.NoError(tt, err)
+
+		// the universal resolver supports did:web, but the method is not allowed, so it is never asked
+		_, err = resolver.Resolve(context.Background(), "did:web:did.actor:alice")
+		assert.Error(tt, err)
+		assert.True(tt, errors.Is(err, ErrMethodNotAllowed))
+	})
 }